@@ -0,0 +1,133 @@
+// Package cache implements the cache management commands for bundle-extract.
+package cache
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/lburgazzoli/olm-extractor/internal/cli"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+	"github.com/lburgazzoli/olm-extractor/pkg/render"
+)
+
+// Config holds all configuration for the cache subcommands.
+type Config struct {
+	Output string       `mapstructure:"output"`
+	All    bool         `mapstructure:"all"`
+	Cache  cache.Config `mapstructure:",squash"`
+}
+
+const longDescription = `Manage the persistent cache of bundle-extract.
+
+Pulled image layers, extracted bundle and catalog content, and parsed catalogs are cached
+by digest in the cache directory, so repeated runs only fetch image manifests. Entries are
+evicted at the end of each 'run' when unused for longer than --cache-ttl, or when the cache
+exceeds --cache-max-size; 'cache prune' applies the same eviction on demand.
+
+All flags can be configured using environment variables with the BUNDLE_EXTRACT_ prefix.
+Flag names are converted to uppercase and dashes are replaced with underscores.`
+
+const exampleUsage = `  # Evict entries unused for more than 7 days, and shrink the cache to 10Gi
+  bundle-extract cache prune --cache-dir ~/.cache/bundle-extract
+
+  # Evict entries unused for more than a day, from the cache set in the environment
+  export BUNDLE_EXTRACT_CACHE_DIR=~/.cache/bundle-extract
+  bundle-extract cache prune --cache-ttl 24h
+
+  # Remove everything
+  bundle-extract cache prune --cache-dir ~/.cache/bundle-extract --all`
+
+// NewCommand creates the cache command group.
+func NewCommand() *cobra.Command {
+	v := cli.NewViper()
+
+	cmd := &cobra.Command{
+		Use:     "cache",
+		Short:   "Manage the persistent image and catalog cache",
+		Long:    longDescription,
+		Example: exampleUsage,
+		Args:    cobra.NoArgs,
+	}
+
+	cmd.PersistentFlags().StringP("output", "o", render.FormatTable, "Output format: table, json or yaml")
+	cmd.PersistentFlags().String("cache-dir", "", "Directory of the persistent image and catalog cache")
+
+	cmd.AddCommand(newPruneCommand(v))
+
+	return cmd
+}
+
+// newPruneCommand creates the "cache prune" subcommand.
+func newPruneCommand(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Evict expired and least recently used cache entries",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg Config
+
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return fmt.Errorf("failed to bind flags: %w", err)
+			}
+
+			if err := v.Unmarshal(&cfg); err != nil {
+				return fmt.Errorf("failed to parse configuration: %w", err)
+			}
+
+			if err := render.ValidateFormat(cfg.Output); err != nil {
+				return err
+			}
+
+			if cfg.Cache.Dir == "" {
+				return fmt.Errorf("cache directory is not set, use --cache-dir")
+			}
+
+			opts, err := cfg.Cache.PruneOptions()
+			if err != nil {
+				return err
+			}
+			opts.All = cfg.All
+
+			result, err := cache.New(cfg.Cache.Dir).Prune(opts)
+			if err != nil {
+				return fmt.Errorf("failed to prune cache: %w", err)
+			}
+
+			return render.Value(cmd.OutOrStdout(), cfg.Output, result, func() ([]string, [][]string) {
+				return []string{"REMOVED", "FREED", "REMAINING", "SIZE"}, [][]string{{
+					strconv.Itoa(result.Removed),
+					formatBytes(result.FreedBytes),
+					strconv.Itoa(result.Remaining),
+					formatBytes(result.TotalBytes),
+				}}
+			})
+		},
+	}
+
+	cmd.Flags().Duration("cache-ttl", cache.DefaultTTL, "Evict cache entries unused for longer than this duration (0 disables)")
+	cmd.Flags().String("cache-max-size", cache.DefaultMaxSize, "Evict least recently used cache entries beyond this size (empty disables)")
+	cmd.Flags().Bool("all", false, "Evict all cache entries")
+
+	return cmd
+}
+
+// formatBytes formats a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,245 @@
+// Package catalog implements the catalog browsing commands for bundle-extract.
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/lburgazzoli/olm-extractor/internal/cli"
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+	"github.com/lburgazzoli/olm-extractor/pkg/render"
+)
+
+// Config holds all configuration for the catalog subcommands.
+type Config struct {
+	Output   string                `mapstructure:"output"`
+	TempDir  string                `mapstructure:"temp-dir"`
+	Channel  string                `mapstructure:"channel"`
+	Registry bundle.RegistryConfig `mapstructure:",squash"`
+	Cache    cache.Config          `mapstructure:",squash"`
+}
+
+const longDescription = `Browse the content of an OLM catalog image.
+
+These commands load a File-Based Catalog (FBC) or legacy SQLite index image, or a local
+FBC directory or file, and list what can be resolved from it with 'run --catalog': packages,
+their channels and channel heads, and the versions and bundle images available in each channel.
+
+All flags can be configured using environment variables with the BUNDLE_EXTRACT_ prefix.
+Flag names are converted to uppercase and dashes are replaced with underscores.`
+
+const exampleUsage = `  # List all packages in a catalog
+  bundle-extract catalog packages quay.io/operatorhubio/catalog:latest
+
+  # Show the channels of a package, including their heads and the default channel
+  bundle-extract catalog channels quay.io/operatorhubio/catalog:latest prometheus
+
+  # List versions and bundle images in the package's default channel
+  bundle-extract catalog versions quay.io/operatorhubio/catalog:latest prometheus
+
+  # List packages of a local FBC directory
+  bundle-extract catalog packages ./catalog
+
+  # List packages of a catalog image saved as an OCI layout
+  bundle-extract catalog packages oci:./catalog-layout:latest
+
+  # List versions in a specific channel as JSON
+  bundle-extract catalog versions quay.io/operatorhubio/catalog:latest prometheus \
+    --channel beta -o json`
+
+const tempDirPerms = 0750
+
+// NewCommand creates the catalog command group.
+func NewCommand() *cobra.Command {
+	v := cli.NewViper()
+
+	cmd := &cobra.Command{
+		Use:     "catalog",
+		Short:   "Browse packages, channels and versions of a catalog image",
+		Long:    longDescription,
+		Example: exampleUsage,
+		Args:    cobra.NoArgs,
+	}
+
+	cmd.PersistentFlags().StringP("output", "o", render.FormatTable, "Output format: table, json or yaml")
+	cmd.PersistentFlags().String("temp-dir", "", "Directory for temporary files (defaults to system temp directory)")
+	cmd.PersistentFlags().Bool("registry-insecure", false, "Allow plain HTTP and skip TLS verification for all registries")
+	cmd.PersistentFlags().StringArray("registry-insecure-host", []string{}, "Registry host[:port] to allow plain HTTP and skip TLS verification for (repeatable)")
+	cmd.PersistentFlags().String("registry-ca-file", "", "PEM bundle of certificate authorities trusted for all registries")
+	cmd.PersistentFlags().StringArray("registry-host-ca-file", []string{}, "PEM bundle trusted for a single registry, as host[:port]=path (repeatable)")
+	cmd.PersistentFlags().String("registries-conf", "", "containers registries.conf with mirrors to try before source registries (defaults to the system one, if any)")
+	cmd.PersistentFlags().StringArray("mirror-set", []string{}, "ImageDigestMirrorSet, ImageTagMirrorSet or ImageContentSourcePolicy file (repeatable)")
+	cmd.PersistentFlags().String("platform", "", "Platform (os/arch[/variant]) to select from multi-platform images (defaults to linux/amd64)")
+	cmd.PersistentFlags().String("registry-username", "", "Username for registry authentication")
+	cmd.PersistentFlags().String("registry-password", "", "Password for registry authentication")
+	cmd.PersistentFlags().String("registry-token", "", "Bearer token for registry authentication")
+	cmd.PersistentFlags().String("registry-auth-file", "", "containers auth file (auth.json) with per-registry credentials (defaults to $REGISTRY_AUTH_FILE or podman's, if any)")
+	cmd.PersistentFlags().Int("registry-retries", registry.DefaultRetries, "Number of times failed registry requests are retried (0 disables retries)")
+	cmd.PersistentFlags().Duration("registry-retry-delay", registry.DefaultRetryDelay, "Delay before the first retry of a failed registry request, doubled on each further retry")
+	cmd.PersistentFlags().Duration("registry-request-timeout", registry.DefaultRequestTimeout, "Time a registry has to answer a single request before it is retried (0 disables)")
+	cmd.PersistentFlags().Duration("registry-timeout", 0, "Time the extraction of an image may take, including retries (0 disables)")
+	cmd.PersistentFlags().String("cache-dir", "", "Directory of the persistent image and catalog cache (disabled when empty)")
+
+	cmd.AddCommand(newPackagesCommand(v))
+	cmd.AddCommand(newChannelsCommand(v))
+	cmd.AddCommand(newVersionsCommand(v))
+
+	return cmd
+}
+
+// newPackagesCommand creates the "catalog packages" subcommand.
+func newPackagesCommand(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:          "packages <catalog>",
+		Short:        "List packages available in a catalog",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd, v)
+			if err != nil {
+				return err
+			}
+
+			fbc, err := catalog.Load(cmd.Context(), args[0], cfg.Registry, cfg.TempDir)
+			if err != nil {
+				return err
+			}
+
+			packages := catalog.ListPackages(fbc)
+
+			return render.Value(cmd.OutOrStdout(), cfg.Output, packages, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(packages))
+				for _, p := range packages {
+					rows = append(rows, []string{p.Name, p.DefaultChannel, strings.Join(p.Channels, ",")})
+				}
+
+				return []string{"PACKAGE", "DEFAULT CHANNEL", "CHANNELS"}, rows
+			})
+		},
+	}
+}
+
+// newChannelsCommand creates the "catalog channels" subcommand.
+func newChannelsCommand(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:          "channels <catalog> <package>",
+		Short:        "List channels of a package with their heads",
+		Args:         cobra.ExactArgs(2), //nolint:mnd
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd, v)
+			if err != nil {
+				return err
+			}
+
+			fbc, err := catalog.Load(cmd.Context(), args[0], cfg.Registry, cfg.TempDir)
+			if err != nil {
+				return err
+			}
+
+			channels, err := catalog.ListChannels(fbc, args[1])
+			if err != nil {
+				return fmt.Errorf("failed to list channels: %w", err)
+			}
+
+			return render.Value(cmd.OutOrStdout(), cfg.Output, channels, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(channels))
+				for _, c := range channels {
+					head := c.Head
+					if c.HeadError != "" {
+						head = "<error: " + c.HeadError + ">"
+					}
+
+					rows = append(rows, []string{c.Name, strconv.FormatBool(c.Default), head, strconv.Itoa(c.Entries)})
+				}
+
+				return []string{"CHANNEL", "DEFAULT", "HEAD", "ENTRIES"}, rows
+			})
+		},
+	}
+}
+
+// newVersionsCommand creates the "catalog versions" subcommand.
+func newVersionsCommand(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "versions <catalog> <package>",
+		Short:        "List versions and bundle images in a channel",
+		Args:         cobra.ExactArgs(2), //nolint:mnd
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd, v)
+			if err != nil {
+				return err
+			}
+
+			fbc, err := catalog.Load(cmd.Context(), args[0], cfg.Registry, cfg.TempDir)
+			if err != nil {
+				return err
+			}
+
+			bundles, err := catalog.ListBundles(fbc, args[1], cfg.Channel)
+			if err != nil {
+				return fmt.Errorf("failed to list versions: %w", err)
+			}
+
+			return render.Value(cmd.OutOrStdout(), cfg.Output, bundles, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(bundles))
+				for _, b := range bundles {
+					head := ""
+					if b.Head {
+						head = "*"
+					}
+
+					rows = append(rows, []string{b.Version, b.Name, head, b.Image})
+				}
+
+				return []string{"VERSION", "BUNDLE", "HEAD", "IMAGE"}, rows
+			})
+		},
+	}
+
+	cmd.Flags().String("channel", "", "Channel to list (defaults to package's defaultChannel)")
+
+	return cmd
+}
+
+// loadConfig binds the command flags to viper and unmarshals the resulting configuration.
+func loadConfig(cmd *cobra.Command, v *viper.Viper) (Config, error) {
+	var cfg Config
+
+	if err := v.BindPFlags(cmd.Flags()); err != nil {
+		return cfg, fmt.Errorf("failed to bind flags: %w", err)
+	}
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	if err := render.ValidateFormat(cfg.Output); err != nil {
+		return cfg, err
+	}
+
+	cfg.Registry.CacheDir = cfg.Cache.Dir
+	cfg.Registry.OnMirrorPull = func(imageRef string, source string) {
+		fmt.Fprintf(os.Stderr, "info: pulled %s from mirror %s\n", imageRef, source)
+	}
+	cfg.Registry.OnRetry = func(imageRef string, retry registry.Retry) {
+		fmt.Fprintf(os.Stderr, "warning: pulling %s: %s\n", imageRef, retry)
+	}
+
+	if cfg.TempDir != "" {
+		if err := os.MkdirAll(cfg.TempDir, tempDirPerms); err != nil {
+			return cfg, fmt.Errorf("failed to create temp-dir: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/lburgazzoli/olm-extractor/cmd/cache"
+	"github.com/lburgazzoli/olm-extractor/cmd/catalog"
 	"github.com/lburgazzoli/olm-extractor/cmd/krm"
 	"github.com/lburgazzoli/olm-extractor/cmd/run"
 	"github.com/lburgazzoli/olm-extractor/internal/version"
@@ -24,6 +26,10 @@ This tool can operate in two modes:
    and writing generated manifests to stdout. Configuration comes from
    the functionConfig in the ResourceList.
 
+The catalog subcommand can be used to browse the packages, channels and versions
+available in a catalog image before extracting them, and the cache subcommand manages
+the persistent cache of pulled images and parsed catalogs.
+
 Registry authentication uses standard Docker credentials from ~/.docker/config.json and
 supports Docker credential helpers (osxkeychain on macOS, etc.) for automatic keychain integration.
 
@@ -42,6 +48,8 @@ func main() {
 	// Add subcommands
 	rootCmd.AddCommand(run.NewCommand())
 	rootCmd.AddCommand(krm.NewCommand())
+	rootCmd.AddCommand(catalog.NewCommand())
+	rootCmd.AddCommand(cache.NewCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -2,6 +2,7 @@
 package run
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -10,24 +11,37 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"k8s.io/apimachinery/pkg/runtime"
+
 	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
 	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
 	"github.com/lburgazzoli/olm-extractor/pkg/certmanager"
 	"github.com/lburgazzoli/olm-extractor/pkg/extract"
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
 	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/lock"
+	"github.com/lburgazzoli/olm-extractor/pkg/overrides"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
 	"github.com/lburgazzoli/olm-extractor/pkg/render"
 )
 
 // Config holds all configuration for the run subcommand.
 type Config struct {
-	Namespace   string                `mapstructure:"namespace"`
-	Include     []string              `mapstructure:"include"`
-	Exclude     []string              `mapstructure:"exclude"`
-	TempDir     string                `mapstructure:"temp-dir"`
-	Catalog     string                `mapstructure:"catalog"`
-	Channel     string                `mapstructure:"channel"`
-	CertManager certmanager.Config    `mapstructure:",squash"`
-	Registry    bundle.RegistryConfig `mapstructure:",squash"`
+	Namespace           string                `mapstructure:"namespace"`
+	WatchNamespaces     []string              `mapstructure:"watch-namespaces"`
+	ConfigFile          string                `mapstructure:"config-file"`
+	Include             []string              `mapstructure:"include"`
+	Exclude             []string              `mapstructure:"exclude"`
+	TempDir             string                `mapstructure:"temp-dir"`
+	Catalog             string                `mapstructure:"catalog"`
+	Channel             string                `mapstructure:"channel"`
+	ResolveDependencies bool                  `mapstructure:"resolve-dependencies"`
+	ImageMap            imagemap.Config       `mapstructure:",squash"`
+	CertManager         certmanager.Config    `mapstructure:",squash"`
+	Registry            bundle.RegistryConfig `mapstructure:",squash"`
+	Cache               cache.Config          `mapstructure:",squash"`
+	Lock                lock.Config           `mapstructure:",squash"`
 }
 
 const longDescription = `Extract Kubernetes manifests from an OLM bundle and output installation-ready YAML.
@@ -58,9 +72,50 @@ const exampleUsage = `  # Extract all resources from a bundle directory
   # Extract from a catalog (specific version)
   bundle-extract run --catalog quay.io/catalog:latest ack-acm-controller:0.0.10 -n my-namespace
 
+  # Extract from a catalog (highest version matching a semver constraint)
+  bundle-extract run --catalog quay.io/catalog:latest 'ack-acm-controller:>=0.0.8 <0.1' -n my-namespace
+
   # Extract from a catalog (specific channel)
   bundle-extract run --catalog quay.io/catalog:latest --channel stable ack-acm-controller -n my-namespace
 
+  # Extract from a bundle image saved as an OCI archive (oci:<dir>[:tag] and docker-archive:<file> also work)
+  bundle-extract run -n my-namespace oci-archive:./bundle.tar
+
+  # Extract from a local FBC catalog directory (or a single FBC file)
+  bundle-extract run --catalog ./catalog ack-acm-controller -n my-namespace
+
+  # Extract from a registry using a private CA, and a plain HTTP mirror
+  bundle-extract run --registry-host-ca-file registry.internal:5000=/etc/pki/internal-ca.pem \
+    --registry-insecure-host mirror.lab:5000 registry.internal:5000/ops/bundle:v1.0.0 -n my-namespace
+
+  # Extract in a disconnected environment, pulling through the mirrors of an ImageDigestMirrorSet
+  bundle-extract run --mirror-set ./idms.yaml --catalog registry.redhat.io/redhat/redhat-operator-index:v4.16 \
+    my-operator -n my-namespace
+
+  # Extract from a catalog, pulling the bundle image even if the catalog embeds its manifests
+  bundle-extract run --catalog quay.io/catalog:latest --pull-bundles my-operator -n my-namespace
+
+  # Extract from a catalog together with the operators the package depends on
+  bundle-extract run --catalog quay.io/catalog:latest --resolve-dependencies my-operator -n my-namespace
+
+  # Extract only if the bundle image is signed with a cosign key
+  bundle-extract run -n my-namespace --verify-key ./cosign.pub quay.io/example/operator-bundle:v1.0.0
+
+  # Pin the resolved catalog bundles in a lock file, reused by later runs
+  bundle-extract run --catalog quay.io/catalog:latest --lock-file bundle-extract.lock my-operator -n my-namespace
+
+  # Watch namespaces other than the target namespace, as an OperatorGroup would
+  bundle-extract run -n my-namespace --watch-namespaces team-a,team-b quay.io/example/operator-bundle:v1.0.0
+
+  # Set env, resources, tolerations, ... on the operator deployments, as a Subscription config would
+  bundle-extract run -n my-namespace --config-file config.yaml quay.io/example/operator-bundle:v1.0.0
+
+  # Rewrite operator and operand images to a mirror registry, warning about unmapped images
+  bundle-extract run -n my-namespace --image-map image-map.yaml --image-map-strict quay.io/example/operator-bundle:v1.0.0
+
+  # Extract only from images pinned by digest
+  bundle-extract run -n my-namespace --require-digest quay.io/example/operator-bundle@sha256:<digest>
+
   # Extract without cert-manager integration
   bundle-extract run -n my-namespace --cert-manager-enabled=false ./bundle
 
@@ -75,6 +130,10 @@ const exampleUsage = `  # Extract all resources from a bundle directory
   bundle-extract run -n my-namespace --registry-username user --registry-password pass \
     quay.io/private/operator:v1.0.0
 
+  # Extract with the per-registry credentials of a podman auth file
+  bundle-extract run -n my-namespace --registry-auth-file ${XDG_RUNTIME_DIR}/containers/auth.json \
+    quay.io/private/operator:v1.0.0
+
   # Filter to include only Deployments and Services
   bundle-extract run -n my-namespace --include '.kind == "Deployment"' \
     --include '.kind == "Service"' ./bundle
@@ -105,17 +164,42 @@ func NewCommand() *cobra.Command {
 
 	// Define flags
 	cmd.Flags().StringP("namespace", "n", "", "Target namespace for installation (required)")
+	cmd.Flags().StringSlice("watch-namespaces", []string{}, "Namespaces the operator watches, or '*' for all (defaults to all namespaces if supported, else the target namespace)")
+	cmd.Flags().String("config-file", "", "Subscription-style config (env, resources, nodeSelector, tolerations, ...) applied to the operator deployments")
 	cmd.Flags().StringArray("include", []string{}, "jq expression to include resources (repeatable, acts as OR)")
 	cmd.Flags().StringArray("exclude", []string{}, "jq expression to exclude resources (repeatable, acts as OR)")
-	cmd.Flags().String("temp-dir", "", "Directory for temporary files and cache (defaults to system temp directory)")
-	cmd.Flags().String("catalog", "", "Catalog image to resolve bundle from (enables catalog mode)")
+	cmd.Flags().String("temp-dir", "", "Directory for temporary files (defaults to system temp directory)")
+	cmd.Flags().String("catalog", "", "Catalog image, or local FBC directory or file, to resolve bundle from (enables catalog mode)")
 	cmd.Flags().String("channel", "", "Channel to use when resolving from catalog (defaults to package's defaultChannel)")
+	cmd.Flags().Bool("resolve-dependencies", false, "Resolve and extract the operators the package depends on (catalog mode only)")
+	cmd.Flags().Bool("pull-bundles", false, "Pull bundle images even when the catalog embeds their manifests (catalog mode only)")
+	cmd.Flags().String("image-map", "", "Image map file of mirror sets and per-image overrides rewriting images of deployments and RELATED_IMAGE_* env to mirrors")
+	cmd.Flags().Bool("image-map-strict", false, "Warn about images that match no mapping of the image map")
 	cmd.Flags().Bool("cert-manager-enabled", true, "Enable cert-manager integration for webhook certificates")
 	cmd.Flags().String("cert-manager-issuer-name", "", "Name of the cert-manager Issuer or ClusterIssuer")
 	cmd.Flags().String("cert-manager-issuer-kind", "", "Kind of cert-manager issuer: Issuer or ClusterIssuer")
-	cmd.Flags().Bool("registry-insecure", false, "Allow insecure connections to registries")
+	cmd.Flags().Bool("registry-insecure", false, "Allow plain HTTP and skip TLS verification for all registries")
+	cmd.Flags().StringArray("registry-insecure-host", []string{}, "Registry host[:port] to allow plain HTTP and skip TLS verification for (repeatable)")
+	cmd.Flags().String("registry-ca-file", "", "PEM bundle of certificate authorities trusted for all registries")
+	cmd.Flags().StringArray("registry-host-ca-file", []string{}, "PEM bundle trusted for a single registry, as host[:port]=path (repeatable)")
+	cmd.Flags().String("registries-conf", "", "containers registries.conf with mirrors to try before source registries (defaults to the system one, if any)")
+	cmd.Flags().StringArray("mirror-set", []string{}, "ImageDigestMirrorSet, ImageTagMirrorSet or ImageContentSourcePolicy file (repeatable)")
+	cmd.Flags().String("platform", "", "Platform (os/arch[/variant]) to select from multi-platform images (defaults to linux/amd64)")
+	cmd.Flags().String("verify-key", "", "PEM public key that bundle and catalog images must carry a valid cosign signature for")
+	cmd.Flags().Bool("require-digest", false, "Refuse bundle and catalog image references that are not pinned by digest")
+	cmd.Flags().String("lock-file", "", "Lock file pinning the resolved bundles, written on first use and reused on later runs (e.g. "+lock.DefaultFile+")")
+	cmd.Flags().Bool("update-lock", false, "Resolve the bundles again and rewrite the lock file")
 	cmd.Flags().String("registry-username", "", "Username for registry authentication")
 	cmd.Flags().String("registry-password", "", "Password for registry authentication")
+	cmd.Flags().String("registry-token", "", "Bearer token for registry authentication")
+	cmd.Flags().String("registry-auth-file", "", "containers auth file (auth.json) with per-registry credentials (defaults to $REGISTRY_AUTH_FILE or podman's, if any)")
+	cmd.Flags().Int("registry-retries", registry.DefaultRetries, "Number of times failed registry requests are retried (0 disables retries)")
+	cmd.Flags().Duration("registry-retry-delay", registry.DefaultRetryDelay, "Delay before the first retry of a failed registry request, doubled on each further retry")
+	cmd.Flags().Duration("registry-request-timeout", registry.DefaultRequestTimeout, "Time a registry has to answer a single request before it is retried (0 disables)")
+	cmd.Flags().Duration("registry-timeout", 0, "Time the extraction of an image may take, including retries (0 disables)")
+	cmd.Flags().String("cache-dir", "", "Directory of the persistent image and catalog cache (disabled when empty)")
+	cmd.Flags().Duration("cache-ttl", cache.DefaultTTL, "Evict cache entries unused for longer than this duration (0 disables)")
+	cmd.Flags().String("cache-max-size", cache.DefaultMaxSize, "Evict least recently used cache entries beyond this size (empty disables)")
 
 	// Bind flags to viper for environment variable support
 	_ = viper.BindPFlags(cmd.Flags())
@@ -144,31 +228,96 @@ func execute(ctx context.Context, input string) error {
 		}
 	}
 
-	// Phase 1: Resolve bundle source
-	bundleImageOrDir, err := catalog.ResolveBundleSource(
-		ctx,
-		input,
-		cfg.Catalog,
-		cfg.Channel,
-		cfg.Registry,
-		cfg.TempDir,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to resolve bundle source: %w", err)
+	cfg.Registry.CacheDir = cfg.Cache.Dir
+	cfg.Registry.OnMirrorPull = func(imageRef string, source string) {
+		fmt.Fprintf(os.Stderr, "info: pulled %s from mirror %s\n", imageRef, source)
+	}
+	cfg.Registry.OnVerified = func(imageRef string, digest string) {
+		fmt.Fprintf(os.Stderr, "info: verified signature of %s (%s)\n", imageRef, digest)
+	}
+	cfg.Registry.OnRetry = func(imageRef string, retry registry.Retry) {
+		fmt.Fprintf(os.Stderr, "warning: pulling %s: %s\n", imageRef, retry)
+	}
+	cfg.ImageMap.OnUnmatched = func(image string) {
+		fmt.Fprintf(os.Stderr, "warning: image %s matched no mapping of the image map\n", image)
 	}
 
-	// Phase 2: Load bundle
-	b, err := bundle.Load(ctx, bundleImageOrDir, cfg.Registry, cfg.TempDir)
+	pruneOptions, err := cfg.Cache.PruneOptions()
 	if err != nil {
-		return fmt.Errorf("failed to load bundle: %w", err)
+		return err
+	}
+
+	var deploymentConfig *overrides.Config
+	if cfg.ConfigFile != "" {
+		deploymentConfig, err = overrides.Load(cfg.ConfigFile)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Phase 3: Extract manifests
-	objects, err := extract.Manifests(b, cfg.Namespace)
+	// Phase 1: Resolve bundle sources, reusing the lock file if any
+	lockRequest := lock.Request{
+		Source:              input,
+		Catalog:             cfg.Catalog,
+		Channel:             cfg.Channel,
+		ResolveDependencies: cfg.ResolveDependencies,
+		Platform:            cfg.Registry.Platform,
+	}
+
+	sources, err := cfg.Lock.Sources(ctx, lockRequest, cfg.Registry, cfg.TempDir)
 	if err != nil {
-		return fmt.Errorf("failed to extract manifests: %w", err)
+		return err
+	}
+
+	if sources == nil {
+		sources, err = catalog.ResolveBundles(
+			ctx,
+			input,
+			cfg.Catalog,
+			cfg.Channel,
+			cfg.ResolveDependencies,
+			cfg.Registry,
+			cfg.TempDir,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to resolve bundle source: %w", err)
+		}
+	}
+
+	// Phase 2 & 3: Load bundles and extract manifests
+	objectSets := make([][]runtime.Object, 0, len(sources))
+	digests := make([]string, 0, len(sources))
+	for i, source := range sources {
+		b, digest, err := source.LoadBundle(ctx, cfg.Registry, cfg.TempDir)
+		if err != nil {
+			return fmt.Errorf("failed to load bundle: %w", err)
+		}
+
+		digests = append(digests, digest)
+
+		// The config targets the requested operator, which comes last, not its dependencies
+		sourceConfig := deploymentConfig
+		if i < len(sources)-1 {
+			sourceConfig = nil
+		}
+
+		objects, err := extract.Manifests(b, cfg.Namespace, cfg.WatchNamespaces, sourceConfig)
+		if err != nil {
+			return fmt.Errorf("failed to extract manifests: %w", err)
+		}
+
+		if err := extract.AnnotateProvenance(objects, source.Provenance(digest)); err != nil {
+			return fmt.Errorf("failed to annotate manifests: %w", err)
+		}
+
+		// CSVs are not rendered, so their related images are only checked by the image map
+		cfg.ImageMap.RelatedImages = append(cfg.ImageMap.RelatedImages, imagemap.RelatedImages(b.CSV)...)
+
+		objectSets = append(objectSets, objects)
 	}
 
+	objects := extract.Merge(objectSets...)
+
 	// Phase 4: Convert to unstructured
 	unstructuredObjects, err := kube.ConvertToUnstructured(objects)
 	if err != nil {
@@ -181,16 +330,33 @@ func execute(ctx context.Context, input string) error {
 		cfg.Namespace,
 		cfg.Include,
 		cfg.Exclude,
+		cfg.ImageMap,
 		cfg.CertManager,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to apply transformations: %w", err)
 	}
 
-	// Phase 6: Render output as YAML
-	if err := render.YAML(os.Stdout, unstructuredObjects); err != nil {
+	// Phase 6: Render output as YAML, written only once the lock file is recorded
+	var out bytes.Buffer
+	if err := render.YAML(&out, unstructuredObjects); err != nil {
 		return fmt.Errorf("failed to render YAML: %w", err)
 	}
 
+	if err := cfg.Lock.Record(lockRequest, sources, digests); err != nil {
+		return err
+	}
+
+	if _, err := out.WriteTo(os.Stdout); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	// Evicting stale entries does not affect the output, so failures are only reported
+	if cfg.Registry.CacheDir != "" {
+		if _, err := cache.New(cfg.Registry.CacheDir).Prune(pruneOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to prune cache: %v\n", err)
+		}
+	}
+
 	return nil
 }
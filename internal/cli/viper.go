@@ -0,0 +1,19 @@
+// Package cli contains helpers shared by the bundle-extract commands.
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// NewViper returns a viper instance reading BUNDLE_EXTRACT_ environment variables.
+// Command groups use a dedicated instance so that flag bindings do not clash with the run subcommand.
+func NewViper() *viper.Viper {
+	v := viper.New()
+	v.SetEnvPrefix("BUNDLE_EXTRACT")
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+
+	return v
+}
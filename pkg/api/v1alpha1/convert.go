@@ -1,21 +1,40 @@
 package v1alpha1
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
 	"github.com/lburgazzoli/olm-extractor/pkg/certmanager"
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
+	"github.com/lburgazzoli/olm-extractor/pkg/lock"
+	"github.com/lburgazzoli/olm-extractor/pkg/overrides"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
 )
 
 // Config holds all configuration for the application.
 // This is the internal representation used by the extraction pipeline.
 type Config struct {
-	Namespace   string
-	Include     []string
-	Exclude     []string
-	TempDir     string
-	Catalog     string
-	Channel     string
-	CertManager certmanager.Config
-	Registry    bundle.RegistryConfig
+	Namespace           string
+	WatchNamespaces     []string
+	DeploymentConfig    *overrides.Config
+	ImageMap            imagemap.Config
+	Include             []string
+	Exclude             []string
+	TempDir             string
+	Catalog             string
+	Channel             string
+	ResolveDependencies bool
+	CertManager         certmanager.Config
+	Registry            bundle.RegistryConfig
+	Cache               cache.Config
+	Lock                lock.Config
 }
 
 // ToConfig converts an Extractor to the internal Config structure and returns the source input.
@@ -24,28 +43,70 @@ type Config struct {
 // - input is either the bundle image or package[:version] depending on mode.
 func (e *Extractor) ToConfig(tempDir string) (Config, string, error) {
 	cfg := Config{
-		Namespace: e.Spec.Namespace,
-		Include:   e.Spec.Include,
-		Exclude:   e.Spec.Exclude,
-		TempDir:   tempDir,
+		Namespace:        e.Spec.Namespace,
+		WatchNamespaces:  e.Spec.WatchNamespaces,
+		DeploymentConfig: e.Spec.Config.toOverrides(),
+		Include:          e.Spec.Include,
+		Exclude:          e.Spec.Exclude,
+		TempDir:          tempDir,
 		CertManager: certmanager.Config{
 			Enabled:    boolValue(e.Spec.CertManager.Enabled, true),
 			IssuerName: e.Spec.CertManager.IssuerName,
 			IssuerKind: e.Spec.CertManager.IssuerKind,
 		},
 		Registry: bundle.RegistryConfig{
-			Insecure: e.Spec.Registry.Insecure,
-			Username: e.Spec.Registry.Username,
-			Password: e.Spec.Registry.Password,
+			Insecure:       e.Spec.Registry.Insecure,
+			CAFile:         e.Spec.Registry.CAFile,
+			Username:       e.Spec.Registry.Username,
+			Password:       e.Spec.Registry.Password,
+			RegistriesConf: e.Spec.Registry.RegistriesConf,
+			MirrorSets:     e.Spec.Registry.MirrorSets,
+			Platform:       e.Spec.Registry.Platform,
+			RequireDigest:  e.Spec.Registry.RequireDigest,
+			AuthFile:       e.Spec.Registry.AuthFile,
+			Retries:        intValue(e.Spec.Registry.Retries, registry.DefaultRetries),
+			RetryDelay:     durationValue(e.Spec.Registry.RetryDelay, registry.DefaultRetryDelay),
+			RequestTimeout: durationValue(e.Spec.Registry.RequestTimeout, registry.DefaultRequestTimeout),
+			Timeout:        durationValue(e.Spec.Registry.Timeout, 0),
 		},
 	}
 
+	if err := e.Spec.Registry.resolveCredentials(&cfg.Registry); err != nil {
+		return Config{}, "", err
+	}
+
+	cfg.Cache = cache.Config{
+		Dir:     e.Spec.Cache.Dir,
+		TTL:     durationValue(e.Spec.Cache.TTL, cache.DefaultTTL),
+		MaxSize: stringValue(e.Spec.Cache.MaxSize, cache.DefaultMaxSize),
+	}
+
+	if e.Spec.Verification != nil {
+		cfg.Registry.VerifyKey = e.Spec.Verification.Key
+	}
+
+	if e.Spec.ImageMap != nil {
+		cfg.ImageMap = imagemap.Config{
+			File:   e.Spec.ImageMap.File,
+			Strict: e.Spec.ImageMap.Strict,
+		}
+	}
+
+	if e.Spec.Lock != nil {
+		cfg.Lock = lock.Config{
+			File:   e.Spec.Lock.File,
+			Update: e.Spec.Lock.Update,
+		}
+	}
+
 	var input string
 
 	if e.Spec.Catalog != nil {
 		// Catalog mode: source is package[:version]
 		cfg.Catalog = e.Spec.Catalog.Source
 		cfg.Channel = e.Spec.Catalog.Channel
+		cfg.ResolveDependencies = e.Spec.Catalog.ResolveDependencies
+		cfg.Registry.PullBundles = e.Spec.Catalog.PullBundles
 		input = e.Spec.Source
 	} else {
 		// Bundle mode: source is bundle image
@@ -55,6 +116,90 @@ func (e *Extractor) ToConfig(tempDir string) (Config, string, error) {
 	return cfg, input, nil
 }
 
+// resolveCredentials sets the credentials of cfg, reading the referenced secrets, and the
+// per-registry settings.
+func (r RegistryConfig) resolveCredentials(cfg *bundle.RegistryConfig) error {
+	if r.Password != "" && r.PasswordFrom != nil {
+		return errors.New("registry password and passwordFrom are mutually exclusive")
+	}
+
+	password, err := r.PasswordFrom.value()
+	if err != nil {
+		return fmt.Errorf("failed to read registry password: %w", err)
+	}
+
+	if password != "" {
+		cfg.Password = password
+	}
+
+	cfg.Token, err = r.TokenFrom.value()
+	if err != nil {
+		return fmt.Errorf("failed to read registry token: %w", err)
+	}
+
+	cfg.Hosts = make([]bundle.RegistryHostConfig, 0, len(r.Hosts))
+	for _, h := range r.Hosts {
+		password, err := h.PasswordFrom.value()
+		if err != nil {
+			return fmt.Errorf("failed to read password of registry %s: %w", h.Host, err)
+		}
+
+		token, err := h.TokenFrom.value()
+		if err != nil {
+			return fmt.Errorf("failed to read token of registry %s: %w", h.Host, err)
+		}
+
+		cfg.Hosts = append(cfg.Hosts, bundle.RegistryHostConfig{
+			Host:     h.Host,
+			Insecure: h.Insecure,
+			CAFile:   h.CAFile,
+			Username: h.Username,
+			Password: password,
+			Token:    token,
+		})
+	}
+
+	return nil
+}
+
+// value returns the referenced secret, or an empty string if s is nil.
+func (s *SecretSource) value() (string, error) {
+	switch {
+	case s == nil:
+		return "", nil
+	case s.Env != "" && s.File != "":
+		return "", errors.New("env and file are mutually exclusive")
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+
+		return v, nil
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", errors.New("either env or file must be set")
+	}
+}
+
+// toOverrides converts the deployment config to the overrides applied to the deployments.
+func (c *DeploymentConfig) toOverrides() *overrides.Config {
+	if c == nil {
+		return nil
+	}
+
+	return &overrides.Config{
+		Deployment:         c.Deployment,
+		SubscriptionConfig: c.SubscriptionConfig,
+	}
+}
+
 // boolValue returns the value of a bool pointer, or defaultVal if the pointer is nil.
 func boolValue(ptr *bool, defaultVal bool) bool {
 	if ptr == nil {
@@ -63,3 +208,30 @@ func boolValue(ptr *bool, defaultVal bool) bool {
 
 	return *ptr
 }
+
+// intValue returns the value of an int pointer, or defaultVal if the pointer is nil.
+func intValue(ptr *int, defaultVal int) int {
+	if ptr == nil {
+		return defaultVal
+	}
+
+	return *ptr
+}
+
+// durationValue returns the value of a duration pointer, or defaultVal if the pointer is nil.
+func durationValue(ptr *metav1.Duration, defaultVal time.Duration) time.Duration {
+	if ptr == nil {
+		return defaultVal
+	}
+
+	return ptr.Duration
+}
+
+// stringValue returns the value of a string pointer, or defaultVal if the pointer is nil.
+func stringValue(ptr *string, defaultVal string) string {
+	if ptr == nil {
+		return defaultVal
+	}
+
+	return *ptr
+}
@@ -0,0 +1,144 @@
+package v1alpha1_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/api/v1alpha1"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestToConfigCredentials(t *testing.T) {
+	newExtractor := func(registry v1alpha1.RegistryConfig) *v1alpha1.Extractor {
+		return &v1alpha1.Extractor{
+			Spec: v1alpha1.ExtractorSpec{
+				Source:    "quay.io/example/bundle:v1.0.0",
+				Namespace: "operators",
+				Registry:  registry,
+			},
+		}
+	}
+
+	t.Run("reads passwords and tokens from the environment and files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		t.Setenv("TEST_REGISTRY_PASSWORD", "secret")
+
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		g.Expect(os.WriteFile(tokenFile, []byte("token\n"), 0600)).To(Succeed())
+
+		cfg, _, err := newExtractor(v1alpha1.RegistryConfig{
+			Username:     "user",
+			PasswordFrom: &v1alpha1.SecretSource{Env: "TEST_REGISTRY_PASSWORD"},
+			Hosts: []v1alpha1.RegistryHostConfig{{
+				Host:      "registry.internal:5000",
+				TokenFrom: &v1alpha1.SecretSource{File: tokenFile},
+			}},
+		}).ToConfig(t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Registry.Username).To(Equal("user"))
+		g.Expect(cfg.Registry.Password).To(Equal("secret"))
+		g.Expect(cfg.Registry.Hosts).To(HaveLen(1))
+		g.Expect(cfg.Registry.Hosts[0].Token).To(Equal("token"))
+	})
+
+	t.Run("fails for unset environment variables", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, _, err := newExtractor(v1alpha1.RegistryConfig{
+			PasswordFrom: &v1alpha1.SecretSource{Env: "TEST_REGISTRY_PASSWORD_UNSET"},
+		}).ToConfig(t.TempDir())
+
+		g.Expect(err).To(MatchError(ContainSubstring("is not set")))
+	})
+
+	t.Run("rejects both password and passwordFrom", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, _, err := newExtractor(v1alpha1.RegistryConfig{
+			Password:     "inline",
+			PasswordFrom: &v1alpha1.SecretSource{Env: "TEST_REGISTRY_PASSWORD"},
+		}).ToConfig(t.TempDir())
+
+		g.Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+	})
+}
+
+func TestToConfigRetries(t *testing.T) {
+	t.Run("defaults to the registry retry policy", func(t *testing.T) {
+		g := NewWithT(t)
+
+		e := &v1alpha1.Extractor{Spec: v1alpha1.ExtractorSpec{Source: "quay.io/example/bundle:v1.0.0", Namespace: "operators"}}
+
+		cfg, _, err := e.ToConfig(t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Registry.Retries).To(Equal(registry.DefaultRetries))
+		g.Expect(cfg.Registry.RetryDelay).To(Equal(registry.DefaultRetryDelay))
+		g.Expect(cfg.Registry.RequestTimeout).To(Equal(registry.DefaultRequestTimeout))
+		g.Expect(cfg.Registry.Timeout).To(BeZero())
+	})
+
+	t.Run("allows disabling retries", func(t *testing.T) {
+		g := NewWithT(t)
+
+		retries := 0
+		e := &v1alpha1.Extractor{Spec: v1alpha1.ExtractorSpec{
+			Source:    "quay.io/example/bundle:v1.0.0",
+			Namespace: "operators",
+			Registry: v1alpha1.RegistryConfig{
+				Retries: &retries,
+				Timeout: &metav1.Duration{Duration: 5 * time.Minute},
+			},
+		}}
+
+		cfg, _, err := e.ToConfig(t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Registry.Retries).To(BeZero())
+		g.Expect(cfg.Registry.Timeout).To(Equal(5 * time.Minute))
+	})
+}
+
+func TestToConfigDeploymentConfig(t *testing.T) {
+	t.Run("leaves deployments unchanged by default", func(t *testing.T) {
+		g := NewWithT(t)
+
+		e := &v1alpha1.Extractor{Spec: v1alpha1.ExtractorSpec{Source: "quay.io/example/bundle:v1.0.0", Namespace: "operators"}}
+
+		cfg, _, err := e.ToConfig(t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.DeploymentConfig).To(BeNil())
+	})
+
+	t.Run("converts the subscription config", func(t *testing.T) {
+		g := NewWithT(t)
+
+		e := &v1alpha1.Extractor{Spec: v1alpha1.ExtractorSpec{
+			Source:    "quay.io/example/bundle:v1.0.0",
+			Namespace: "operators",
+			Config: &v1alpha1.DeploymentConfig{
+				Deployment: "example-operator",
+				SubscriptionConfig: operatorsv1alpha1.SubscriptionConfig{
+					NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+				},
+			},
+		}}
+
+		cfg, _, err := e.ToConfig(t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.DeploymentConfig.Deployment).To(Equal("example-operator"))
+		g.Expect(cfg.DeploymentConfig.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+	})
+}
@@ -5,6 +5,8 @@
 package v1alpha1
 
 import (
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -12,7 +14,7 @@ import (
 type ExtractorSpec struct {
 	// Source is either a bundle image or package name, depending on whether Catalog is set
 	// - Bundle mode (no catalog): quay.io/example/operator-bundle:v1.0.0
-	// - Catalog mode (with catalog): prometheus:0.56.0
+	// - Catalog mode (with catalog): prometheus:0.56.0, prometheus:~0.56 or prometheus:>=0.56 <0.60
 	Source string `json:"source"`
 
 	// Catalog enables catalog mode when present. When set, Source is interpreted as package[:version]
@@ -22,6 +24,17 @@ type ExtractorSpec struct {
 	// Namespace is the target namespace for installation
 	Namespace string `json:"namespace"`
 
+	// WatchNamespaces are the namespaces the operator watches, as configured by an OLM OperatorGroup,
+	// or "*" alone for all namespaces. Defaults to all namespaces if the CSV supports it, and to
+	// Namespace otherwise
+	// +optional
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// Config overrides the deployments of the requested operator, not of its dependencies, as the
+	// spec.config of an OLM Subscription does
+	// +optional
+	Config *DeploymentConfig `json:"config,omitempty"`
+
 	// Include contains jq expressions to include resources (repeatable, acts as OR)
 	// +optional
 	Include []string `json:"include,omitempty"`
@@ -30,6 +43,10 @@ type ExtractorSpec struct {
 	// +optional
 	Exclude []string `json:"exclude,omitempty"`
 
+	// ImageMap rewrites the images of the operator deployments to mirrors
+	// +optional
+	ImageMap *ImageMapConfig `json:"imageMap,omitempty"`
+
 	// CertManager configures cert-manager integration for webhook certificates
 	// +optional
 	CertManager CertManagerConfig `json:"certManager,omitempty"`
@@ -37,16 +54,81 @@ type ExtractorSpec struct {
 	// Registry contains registry authentication and connection options
 	// +optional
 	Registry RegistryConfig `json:"registry,omitempty"`
+
+	// Cache configures the persistent image and catalog cache
+	// +optional
+	Cache CacheConfig `json:"cache,omitempty"`
+
+	// Verification requires bundle and catalog images to be signed
+	// +optional
+	Verification *VerificationConfig `json:"verification,omitempty"`
+
+	// Lock pins the resolved bundles in a lock file reused by later runs
+	// +optional
+	Lock *LockConfig `json:"lock,omitempty"`
+}
+
+// DeploymentConfig configures the operator deployments like the spec.config of an OLM Subscription:
+// env, envFrom, volumes, volumeMounts, tolerations, resources, nodeSelector, affinity and annotations
+// are merged into the deployments as OLM merges them.
+type DeploymentConfig struct {
+	// Deployment restricts the config to the deployment with this name in the CSV install strategy
+	// (defaults to all deployments)
+	// +optional
+	Deployment string `json:"deployment,omitempty"`
+
+	operatorsv1alpha1.SubscriptionConfig `json:",inline"`
+}
+
+// ImageMapConfig configures the rewriting of images to mirrors.
+type ImageMapConfig struct {
+	// File is the image map, which must be visible to the function, with ImageDigestMirrorSet,
+	// ImageTagMirrorSet or ImageContentSourcePolicy resources and per-image overrides
+	File string `json:"file"`
+
+	// Strict reports a warning result for each image that matched no mapping
+	// +optional
+	Strict bool `json:"strict,omitempty"`
+}
+
+// LockConfig configures the lock file pinning the resolved bundles.
+type LockConfig struct {
+	// File is the path of the lock file, which must be visible to the function. It is written
+	// when it does not exist and reused as long as the source, catalog, channel, dependency
+	// resolution and platform do not change
+	File string `json:"file"`
+
+	// Update resolves the bundles again and rewrites the lock file
+	// +optional
+	Update bool `json:"update,omitempty"`
+}
+
+// VerificationConfig configures the signature verification of bundle and catalog images.
+type VerificationConfig struct {
+	// Key is a PEM public key file, which must be visible to the function, that images must carry
+	// a valid cosign-style signature for. Signatures are read from the registry serving the image
+	Key string `json:"key"`
 }
 
 // CatalogSource configures catalog-based bundle resolution.
 type CatalogSource struct {
-	// Source is the catalog container image reference (e.g., quay.io/catalog:latest)
+	// Source is the catalog container image reference (e.g., quay.io/catalog:latest),
+	// or a local FBC directory or file (e.g., ./catalog)
 	Source string `json:"source"`
 
 	// Channel specifies the channel to use when resolving from catalog (defaults to package's defaultChannel)
 	// +optional
 	Channel string `json:"channel,omitempty"`
+
+	// ResolveDependencies resolves the operators the package depends on (olm.package.required and
+	// olm.gvk.required) from the same catalog and extracts them together with the package
+	// +optional
+	ResolveDependencies bool `json:"resolveDependencies,omitempty"`
+
+	// PullBundles pulls bundle images even when the catalog embeds their manifests as
+	// olm.bundle.object properties, which are used instead by default
+	// +optional
+	PullBundles bool `json:"pullBundles,omitempty"`
 }
 
 // CertManagerConfig configures cert-manager integration for webhook certificates.
@@ -66,19 +148,128 @@ type CertManagerConfig struct {
 	IssuerKind string `json:"issuerKind,omitempty"`
 }
 
+// CacheConfig configures the persistent image and catalog cache.
+type CacheConfig struct {
+	// Dir enables the cache rooted at this directory, which must be visible to the function.
+	// Defaults to the BUNDLE_EXTRACT_CACHE_DIR environment variable; caching is disabled when both are empty
+	// +optional
+	Dir string `json:"dir,omitempty"`
+
+	// TTL evicts entries unused for longer than this duration (default: 168h, 0 disables)
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// MaxSize evicts least recently used entries beyond this size (default: 10Gi, empty disables)
+	// +optional
+	MaxSize *string `json:"maxSize,omitempty"`
+}
+
 // RegistryConfig contains registry authentication and connection options.
 type RegistryConfig struct {
-	// Insecure allows insecure connections to registries (HTTP or self-signed certificates)
+	// Insecure allows insecure connections to all registries (plain HTTP and no TLS verification)
 	// +optional
 	Insecure bool `json:"insecure,omitempty"`
 
+	// CAFile is a PEM bundle of certificate authorities trusted for all registries
+	// +optional
+	CAFile string `json:"caFile,omitempty"`
+
+	// Hosts configures connection options for specific registries
+	// +optional
+	Hosts []RegistryHostConfig `json:"hosts,omitempty"`
+
+	// RegistriesConf is a containers registries.conf file whose mirrors are tried before the
+	// source registries (defaults to the registries.conf used by containers tools, if any)
+	// +optional
+	RegistriesConf string `json:"registriesConf,omitempty"`
+
+	// MirrorSets lists ImageDigestMirrorSet, ImageTagMirrorSet or ImageContentSourcePolicy files
+	// +optional
+	MirrorSets []string `json:"mirrorSets,omitempty"`
+
+	// RequireDigest refuses bundle and catalog image references that are not pinned by digest
+	// +optional
+	RequireDigest bool `json:"requireDigest,omitempty"`
+
+	// Platform selects the image of multi-platform indexes, in os/arch[/variant] format (default: linux/amd64)
+	// +optional
+	Platform string `json:"platform,omitempty"`
+
+	// Retries is the number of times failed registry requests are retried (default: 4, 0 disables retries)
+	// +optional
+	Retries *int `json:"retries,omitempty"`
+
+	// RetryDelay is the delay before the first retry, doubled on each further retry (default: 1s)
+	// +optional
+	RetryDelay *metav1.Duration `json:"retryDelay,omitempty"`
+
+	// RequestTimeout is the time a registry has to answer a single request before it is retried (default: 1m, 0 disables)
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// Timeout bounds the time the extraction of an image may take, including retries (0 or unset disables)
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
 	// Username for registry authentication (uses Docker config and credential helpers by default)
 	// +optional
 	Username string `json:"username,omitempty"`
 
-	// Password for registry authentication (uses Docker config and credential helpers by default)
+	// Password for registry authentication (uses Docker config and credential helpers by default).
+	// Prefer PasswordFrom, which keeps the password out of the function configuration
 	// +optional
 	Password string `json:"password,omitempty"`
+
+	// PasswordFrom reads the password from an environment variable or a file, exclusive with Password
+	// +optional
+	PasswordFrom *SecretSource `json:"passwordFrom,omitempty"`
+
+	// TokenFrom reads a bearer token for the source registry from an environment variable or a file
+	// +optional
+	TokenFrom *SecretSource `json:"tokenFrom,omitempty"`
+
+	// AuthFile is a containers auth file (auth.json), which must be visible to the function, with
+	// per-registry credentials (defaults to $REGISTRY_AUTH_FILE or podman's auth.json, if any)
+	// +optional
+	AuthFile string `json:"authFile,omitempty"`
+}
+
+// SecretSource references a secret value kept outside of the function configuration.
+// Exactly one of Env and File must be set.
+type SecretSource struct {
+	// Env is the name of an environment variable holding the value, which must be passed to the function
+	// +optional
+	Env string `json:"env,omitempty"`
+
+	// File is a file holding the value, which must be visible to the function. Trailing newlines are ignored
+	// +optional
+	File string `json:"file,omitempty"`
+}
+
+// RegistryHostConfig contains connection options for a single registry.
+type RegistryHostConfig struct {
+	// Host is the registry host with optional port, as it appears in image references
+	Host string `json:"host"`
+
+	// Insecure allows plain HTTP and skips TLS verification for this registry only
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CAFile is a PEM bundle of certificate authorities trusted for this registry
+	// +optional
+	CAFile string `json:"caFile,omitempty"`
+
+	// Username for this registry, used with PasswordFrom
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// PasswordFrom reads the password for this registry from an environment variable or a file
+	// +optional
+	PasswordFrom *SecretSource `json:"passwordFrom,omitempty"`
+
+	// TokenFrom reads a bearer token for this registry from an environment variable or a file
+	// +optional
+	TokenFrom *SecretSource `json:"tokenFrom,omitempty"`
 }
 
 // Extractor is the configuration for extracting manifests from OLM bundles or catalogs.
@@ -3,58 +3,241 @@ package bundle
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/operator-framework/api/pkg/manifests"
 
 	"github.com/lburgazzoli/olm-extractor/pkg/registry"
 )
 
-// RegistryConfig contains registry authentication and connection options.
+// RegistryConfig contains registry authentication, connection and caching options.
 type RegistryConfig struct {
 	Insecure bool   `mapstructure:"registry-insecure"`
+	CAFile   string `mapstructure:"registry-ca-file"`
 	Username string `mapstructure:"registry-username"`
 	Password string `mapstructure:"registry-password"`
+
+	// Token is a bearer token for the source registry, taking precedence over Username and Password.
+	Token string `mapstructure:"registry-token"`
+
+	// AuthFile is a containers auth file (auth.json) to read registry credentials from.
+	// When empty, $REGISTRY_AUTH_FILE or podman's auth.json is used if it exists.
+	AuthFile string `mapstructure:"registry-auth-file"`
+
+	// InsecureHosts lists registries (host[:port]) for which insecure connections are allowed.
+	InsecureHosts []string `mapstructure:"registry-insecure-host"`
+
+	// HostCAFiles lists CA bundles trusted for a single registry, in host[:port]=path format.
+	HostCAFiles []string `mapstructure:"registry-host-ca-file"`
+
+	// RegistriesConf is a containers registries.conf file whose mirrors are tried before the
+	// source registries. When empty, the default registries.conf is used if it exists.
+	RegistriesConf string `mapstructure:"registries-conf"`
+
+	// MirrorSets lists ImageDigestMirrorSet, ImageTagMirrorSet or ImageContentSourcePolicy files.
+	MirrorSets []string `mapstructure:"mirror-set"`
+
+	// Platform selects the image of multi-platform indexes, in os/arch[/variant] format.
+	Platform string `mapstructure:"platform"`
+
+	// VerifyKey is a PEM public key that bundle and catalog images must carry a valid
+	// cosign-style signature for. Verification is disabled when empty.
+	VerifyKey string `mapstructure:"verify-key"`
+
+	// RequireDigest refuses bundle and catalog image references that are not pinned by digest.
+	RequireDigest bool `mapstructure:"require-digest"`
+
+	// PullBundles pulls bundle images in catalog mode even when the catalog embeds their manifests.
+	PullBundles bool `mapstructure:"pull-bundles"`
+
+	// Retries is the number of times failed registry requests are retried, 0 disables retries.
+	Retries int `mapstructure:"registry-retries"`
+
+	// RetryDelay is the delay before the first retry, doubled on each further retry.
+	RetryDelay time.Duration `mapstructure:"registry-retry-delay"`
+
+	// RequestTimeout is the time a registry has to answer a single request, 0 disables it.
+	RequestTimeout time.Duration `mapstructure:"registry-request-timeout"`
+
+	// Timeout bounds the time the extraction of an image may take, 0 disables it.
+	Timeout time.Duration `mapstructure:"registry-timeout"`
+
+	// Hosts configures connection settings per registry.
+	// It is populated by the KRM function configuration rather than bound to flags.
+	Hosts []RegistryHostConfig `mapstructure:"-"`
+
+	// OnMirrorPull is called with the requested and the pulled reference when an image is served by
+	// a mirror, so callers can report it. It is set by the caller rather than bound to a flag.
+	OnMirrorPull func(imageRef string, source string) `mapstructure:"-"`
+
+	// OnVerified is called with the requested reference and the digest whose signature was verified,
+	// so callers can report it. It is set by the caller rather than bound to a flag.
+	OnVerified func(imageRef string, digest string) `mapstructure:"-"`
+
+	// OnRetry is called with the requested reference before a failed registry request is retried,
+	// so callers can report it. It is set by the caller rather than bound to a flag.
+	OnRetry func(imageRef string, retry registry.Retry) `mapstructure:"-"`
+
+	// CacheDir enables the persistent image cache when non-empty.
+	// It is set from the cache configuration rather than bound to a flag directly.
+	CacheDir string `mapstructure:"-"`
+}
+
+// RegistryHostConfig contains connection options and credentials for a single registry.
+type RegistryHostConfig struct {
+	Host     string
+	Insecure bool
+	CAFile   string
+	Username string
+	Password string
+	Token    string
+}
+
+// hostConfigs merges the per-registry settings from all sources, keyed by host.
+func (c RegistryConfig) hostConfigs() (map[string]registry.HostConfig, error) {
+	hosts := make(map[string]registry.HostConfig)
+
+	for _, h := range c.Hosts {
+		hosts[h.Host] = registry.HostConfig{
+			Insecure: h.Insecure,
+			CAFile:   h.CAFile,
+			Username: h.Username,
+			Password: h.Password,
+			Token:    h.Token,
+		}
+	}
+
+	for _, host := range c.InsecureHosts {
+		hc := hosts[host]
+		hc.Insecure = true
+		hosts[host] = hc
+	}
+
+	for _, entry := range c.HostCAFiles {
+		host, caFile, ok := strings.Cut(entry, "=")
+		if !ok || host == "" || caFile == "" {
+			return nil, fmt.Errorf("invalid registry CA file %q, expected host=path", entry)
+		}
+
+		hc := hosts[host]
+		hc.CAFile = caFile
+		hosts[host] = hc
+	}
+
+	return hosts, nil
+}
+
+// mirrorRules loads the mirror rules from registries.conf and the mirror set files.
+// Mirror set rules come first, so they take precedence over registries.conf rules for the same source.
+func (c RegistryConfig) mirrorRules() ([]registry.MirrorRule, error) {
+	rules, err := registry.LoadMirrorSets(c.MirrorSets...)
+	if err != nil {
+		return nil, err
+	}
+
+	path := c.RegistriesConf
+	if path == "" {
+		path = registry.DefaultRegistriesConfPath()
+	}
+
+	if path == "" {
+		return rules, nil
+	}
+
+	confRules, err := registry.LoadRegistriesConf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rules, confRules...), nil
 }
 
 // BundleResource encapsulates all resources associated with a loaded bundle.
-// It manages temporary directories, providing a single cleanup method that is
-// safe to call even on partially initialized resources.
+// It provides a single cleanup method that is safe to call even on partially
+// initialized resources.
 type BundleResource struct {
-	dir    string
-	tmpDir string
+	dir      string
+	resource registry.Resource
 }
 
-// Dir returns the directory path containing the unpacked bundle.
+// Dir returns the directory path containing the unpacked bundle, or an empty string when an
+// image was extracted in memory.
 func (br *BundleResource) Dir() string {
 	return br.dir
 }
 
+// FS returns the content of the bundle, wherever it is held.
+func (br *BundleResource) FS() fs.FS {
+	if br.dir != "" {
+		return os.DirFS(br.dir)
+	}
+
+	return br.resource.FS()
+}
+
+// Digest returns the digest the image reference resolved to, which is the digest of the index for
+// multi-platform images, or an empty string for directories.
+func (br *BundleResource) Digest() string {
+	return br.resource.Digest()
+}
+
+// ManifestDigest returns the manifest digest of the extracted image, which is the image of the
+// selected platform for multi-platform images, or an empty string for directories.
+func (br *BundleResource) ManifestDigest() string {
+	return br.resource.ManifestDigest()
+}
+
+// Source returns the image reference the bundle was pulled from, which differs from the
+// requested reference when a mirror served it. Returns an empty string for directories.
+func (br *BundleResource) Source() string {
+	return br.resource.Source()
+}
+
+// FromMirror returns true if the bundle image was served by a configured mirror.
+func (br *BundleResource) FromMirror() bool {
+	return br.resource.FromMirror()
+}
+
+// VerifiedDigest returns the digest whose signature was verified, or an empty string when
+// verification is disabled or for directories.
+func (br *BundleResource) VerifiedDigest() string {
+	return br.resource.VerifiedDigest()
+}
+
 // Cleanup releases all resources held by the BundleResource.
 // It is idempotent and safe to call on zero-value or partially initialized resources.
 func (br *BundleResource) Cleanup() {
-	if br.tmpDir != "" {
-		_ = os.RemoveAll(br.tmpDir)
-	}
+	br.resource.Cleanup()
 }
 
 // Load loads an OLM bundle from a directory path or container image reference.
-// For image references, temporary files are automatically cleaned up after loading.
+// For image references, the extracted content is released after loading.
 // tempDir specifies where temporary files should be created (empty string uses system default).
 func Load(ctx context.Context, input string, config RegistryConfig, tempDir string) (*manifests.Bundle, error) {
+	bundle, _, err := LoadWithDigest(ctx, input, config, tempDir)
+
+	return bundle, err
+}
+
+// LoadWithDigest loads an OLM bundle like Load, and also returns the digest the bundle image
+// reference resolved to, or an empty string for directories.
+func LoadWithDigest(ctx context.Context, input string, config RegistryConfig, tempDir string) (*manifests.Bundle, string, error) {
 	resource, err := resolve(ctx, input, config, tempDir)
 	defer resource.Cleanup()
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	bundle, err := manifests.GetBundleFromDir(resource.dir)
+	bundle, err := LoadFS(resource.FS())
 	if err != nil {
-		return nil, fmt.Errorf("failed to load bundle from directory: %w", err)
+		return nil, "", fmt.Errorf("failed to load bundle from %s: %w", input, err)
 	}
 
-	return bundle, nil
+	return bundle, resource.Digest(), nil
 }
 
 // getBundlePathPrefixes returns the default path prefixes for OLM bundles.
@@ -64,10 +247,16 @@ func getBundlePathPrefixes() []string {
 
 // resolve resolves the input to a BundleResource.
 // If input is a directory, returns a BundleResource with only dir set.
-// If input is a container image reference, pulls and extracts it to a temp directory.
+// If input is a container image reference, pulls and extracts it.
+// Image references may use the oci:, oci-archive: or docker-archive: transports to read
+// an image from disk instead of a registry.
 func resolve(ctx context.Context, input string, config RegistryConfig, tempDir string) (BundleResource, error) {
 	info, err := os.Stat(input)
 	if err == nil && info.IsDir() {
+		if config.VerifyKey != "" {
+			return BundleResource{}, fmt.Errorf("cannot verify the signature of bundle directory %s", input)
+		}
+
 		// Input is already a directory, return resource with only dir set
 		// Zero values for other fields are safe for Cleanup()
 		return BundleResource{dir: input}, nil
@@ -77,7 +266,7 @@ func resolve(ctx context.Context, input string, config RegistryConfig, tempDir s
 	return ExtractImage(ctx, input, config, tempDir, getBundlePathPrefixes())
 }
 
-// ExtractImage pulls a container image and extracts it to a temporary directory.
+// ExtractImage pulls a container image and extracts it in memory, or into the cache when enabled.
 // Returns a BundleResource containing all created resources.
 // On error, returns a partial BundleResource that is safe to clean up.
 // This is exported for use by the catalog package.
@@ -94,23 +283,91 @@ func ExtractImage(
 		registry.WithPathPrefixes(pathPrefixes),
 	}
 
+	if config.CacheDir != "" {
+		opts = append(opts, registry.WithCacheDir(config.CacheDir))
+	}
+
+	if config.Platform != "" {
+		opts = append(opts, registry.WithPlatform(config.Platform))
+	}
+
+	if config.VerifyKey != "" {
+		opts = append(opts, registry.WithVerifyKey(config.VerifyKey))
+	}
+
+	if config.RequireDigest {
+		opts = append(opts, registry.WithRequireDigest(true))
+	}
+
+	opts = append(opts, registry.WithRetryPolicy(registry.RetryPolicy{
+		Retries:        config.Retries,
+		Delay:          config.RetryDelay,
+		RequestTimeout: config.RequestTimeout,
+	}))
+
+	if config.Timeout > 0 {
+		opts = append(opts, registry.WithTimeout(config.Timeout))
+	}
+
+	if config.OnRetry != nil {
+		opts = append(opts, registry.WithOnRetry(func(r registry.Retry) {
+			config.OnRetry(imageRef, r)
+		}))
+	}
+
 	if config.Insecure {
 		opts = append(opts, registry.WithInsecure(true))
 	}
 
+	if config.CAFile != "" {
+		opts = append(opts, registry.WithCAFile(config.CAFile))
+	}
+
+	hosts, err := config.hostConfigs()
+	if err != nil {
+		return BundleResource{}, err
+	}
+
+	for host, hostConfig := range hosts {
+		opts = append(opts, registry.WithHostConfig(host, hostConfig))
+	}
+
+	mirrors, err := config.mirrorRules()
+	if err != nil {
+		return BundleResource{}, fmt.Errorf("failed to load mirror configuration: %w", err)
+	}
+
+	opts = append(opts, registry.WithMirrors(mirrors...))
+
 	if config.Username != "" && config.Password != "" {
 		opts = append(opts, registry.WithAuth(config.Username, config.Password))
 	}
 
+	if config.Token != "" {
+		opts = append(opts, registry.WithToken(config.Token))
+	}
+
+	if config.AuthFile != "" {
+		opts = append(opts, registry.WithAuthFile(config.AuthFile))
+	}
+
 	// Extract image using registry package
 	resource, err := registry.ExtractImage(ctx, imageRef, opts...)
 	if err != nil {
 		return BundleResource{}, fmt.Errorf("failed to extract image: %w", err)
 	}
 
+	if resource.FromMirror() && config.OnMirrorPull != nil {
+		config.OnMirrorPull(imageRef, resource.Source())
+	}
+
+	if resource.VerifiedDigest() != "" && config.OnVerified != nil {
+		config.OnVerified(imageRef, resource.VerifiedDigest())
+	}
+
 	// Convert registry.Resource to BundleResource
 	return BundleResource{
-		dir:    resource.Dir(),
-		tmpDir: resource.Dir(), // Both point to the same temp dir
+		dir:      resource.Dir(),
+		resource: resource,
 	}, nil
 }
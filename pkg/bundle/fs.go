@@ -0,0 +1,263 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/operator-framework/api/pkg/encoding"
+	"github.com/operator-framework/api/pkg/manifests"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// decoderBufferSize is the number of bytes the YAML or JSON decoder inspects to detect JSON.
+const decoderBufferSize = 30
+
+// LoadFS loads an OLM bundle from a file system, such as an image extracted in memory.
+// It follows the rules of manifests.GetBundleFromDir: the bundle is made of the objects in the
+// directory of the first CSV found, and its package and channels come from the annotations file.
+func LoadFS(fsys fs.FS) (*manifests.Bundle, error) {
+	l := fsLoader{fsys: fsys}
+
+	errs := make([]error, 0)
+	if err := fs.WalkDir(fsys, ".", l.walk(&errs)); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch {
+	case !l.foundCSV:
+		errs = append(errs, errors.New("unable to find a csv in bundle"))
+	case l.bundle == nil:
+		errs = append(errs, errors.New("unable to load bundle"))
+	default:
+		if err := l.computeSize(); err != nil {
+			errs = append(errs, err)
+		}
+
+		l.addAnnotations()
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return l.bundle, nil
+}
+
+// fsLoader holds the state of a bundle being loaded from a file system.
+type fsLoader struct {
+	fsys        fs.FS
+	bundle      *manifests.Bundle
+	foundCSV    bool
+	annotations manifests.AnnotationsFile
+}
+
+// walk returns a WalkDirFunc loading the annotations file and the bundle of the first CSV found.
+// Errors of single files are collected in errs so that the walk continues.
+func (l *fsLoader) walk(errs *[]error) fs.WalkDirFunc {
+	return func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			*errs = append(*errs, err)
+
+			return nil
+		}
+
+		if d.IsDir() {
+			if name != "." && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		if err := l.loadFile(name, d); err != nil {
+			*errs = append(*errs, err)
+		}
+
+		return nil
+	}
+}
+
+// loadFile reads the annotations file, or loads the bundle if name is a CSV.
+func (l *fsLoader) loadFile(name string, d fs.DirEntry) error {
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return fmt.Errorf("unable to load file %s: %w", name, err)
+	}
+
+	if strings.HasPrefix(d.Name(), "annotations") {
+		annotations := manifests.AnnotationsFile{}
+		if err := yaml.Unmarshal(data, &annotations); err != nil {
+			return fmt.Errorf("unable to load the annotations file %s: %w", name, err)
+		}
+
+		l.annotations = annotations
+	}
+
+	obj := unstructured.Unstructured{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), decoderBufferSize).Decode(&obj); err != nil {
+		return nil //nolint:nilerr // files that are not Kubernetes objects are ignored
+	}
+
+	if obj.GetKind() != operatorsv1alpha1.ClusterServiceVersionKind {
+		return nil
+	}
+
+	l.foundCSV = true
+
+	b, err := loadFSBundle(l.fsys, obj.GetName(), path.Dir(name))
+	if b == nil || b.CSV == nil {
+		return errors.Join(err, errors.New("no bundle csv found"))
+	}
+
+	l.bundle = b
+
+	if err != nil {
+		return fmt.Errorf("error loading objs in directory: %w", err)
+	}
+
+	return nil
+}
+
+// addAnnotations sets the package and channels of the bundle from the annotations file.
+func (l *fsLoader) addAnnotations() {
+	if len(l.bundle.Channels) == 0 {
+		l.bundle.Channels = strings.Split(l.annotations.Annotations.Channels, ",")
+	}
+
+	if l.bundle.DefaultChannel == "" {
+		l.bundle.DefaultChannel = l.annotations.Annotations.DefaultChannelName
+	}
+
+	l.bundle.Package = l.annotations.Annotations.PackageName
+}
+
+// computeSize sets the size and the compressed size of the bundle files.
+func (l *fsLoader) computeSize() error {
+	return fs.WalkDir(l.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(l.fsys, name)
+		if err != nil {
+			return err
+		}
+
+		compressed, err := encoding.GzipBase64Encode(data)
+		if err != nil {
+			return err
+		}
+
+		l.bundle.Size += int64(len(data))
+		l.bundle.CompressedSize += int64(len(compressed))
+
+		return nil
+	})
+}
+
+// loadFSBundle loads the objects of dir, the directory of the CSV named csvName, as a bundle.
+func loadFSBundle(fsys fs.FS, csvName string, dir string) (*manifests.Bundle, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	b := &manifests.Bundle{
+		Name: csvName,
+	}
+
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+
+		if e.IsDir() {
+			errs = append(errs, fmt.Errorf("bundle manifests dir contains directory: %s", name))
+
+			continue
+		}
+
+		if strings.HasPrefix(e.Name(), ".") {
+			errs = append(errs, fmt.Errorf("bundle manifests dir has hidden file: %s", name))
+
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to load file %s: %w", name, err))
+
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := yaml.NewYAMLToJSONDecoder(bytes.NewReader(data)).Decode(obj); err != nil {
+			errs = append(errs, fmt.Errorf("unable to decode object: %w", err))
+
+			continue
+		}
+
+		b.Objects = append(b.Objects, obj)
+
+		if err := addTypedObject(b, obj, e.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, errors.Join(errs...)
+}
+
+// addTypedObject decodes the CSV and the CRDs of a bundle into their typed representation.
+func addTypedObject(b *manifests.Bundle, obj *unstructured.Unstructured, fileName string, data []byte) error {
+	decoder := yaml.NewYAMLToJSONDecoder(bytes.NewReader(data))
+
+	switch obj.GetKind() {
+	case operatorsv1alpha1.ClusterServiceVersionKind:
+		if b.CSV != nil {
+			return errors.New("invalid bundle: contains multiple CSVs")
+		}
+
+		csv := operatorsv1alpha1.ClusterServiceVersion{}
+		if err := decoder.Decode(&csv); err != nil {
+			return fmt.Errorf("unable to parse CSV %s: %w", fileName, err)
+		}
+
+		b.CSV = &csv
+
+	case "CustomResourceDefinition":
+		switch version := obj.GetAPIVersion(); version {
+		case apiextensionsv1beta1.SchemeGroupVersion.String():
+			crd := apiextensionsv1beta1.CustomResourceDefinition{}
+			if err := decoder.Decode(&crd); err != nil {
+				return fmt.Errorf("unable to parse CRD %s: %w", fileName, err)
+			}
+
+			b.V1beta1CRDs = append(b.V1beta1CRDs, &crd)
+
+		case apiextensionsv1.SchemeGroupVersion.String():
+			crd := apiextensionsv1.CustomResourceDefinition{}
+			if err := decoder.Decode(&crd); err != nil {
+				return fmt.Errorf("unable to parse CRD %s: %w", fileName, err)
+			}
+
+			b.V1CRDs = append(b.V1CRDs, &crd)
+
+		default:
+			return fmt.Errorf("unsupported CRD version %s for %s", version, fileName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package bundle_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testCSV = `apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: example.v1.0.0
+spec:
+  version: 1.0.0
+`
+	testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+`
+	testAnnotations = `annotations:
+  operators.operatorframework.io.bundle.package.v1: example
+  operators.operatorframework.io.bundle.channels.v1: stable,fast
+  operators.operatorframework.io.bundle.channel.default.v1: stable
+`
+)
+
+func TestLoadFS(t *testing.T) {
+	t.Run("loads the bundle of the CSV directory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := bundle.LoadFS(fstest.MapFS{
+			"manifests/example.clusterserviceversion.yaml": {Data: []byte(testCSV)},
+			"manifests/widgets.crd.yaml":                   {Data: []byte(testCRD)},
+			"metadata/annotations.yaml":                    {Data: []byte(testAnnotations)},
+			"metadata/.hidden/ignored.yaml":                {Data: []byte("kind: Ignored")},
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("example.v1.0.0"))
+		g.Expect(b.CSV).ToNot(BeNil())
+		g.Expect(b.V1CRDs).To(HaveLen(1))
+		g.Expect(b.Objects).To(HaveLen(2))
+		g.Expect(b.Package).To(Equal("example"))
+		g.Expect(b.Channels).To(Equal([]string{"stable", "fast"}))
+		g.Expect(b.DefaultChannel).To(Equal("stable"))
+	})
+
+	t.Run("fails without a CSV", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := bundle.LoadFS(fstest.MapFS{
+			"manifests/widgets.crd.yaml": {Data: []byte(testCRD)},
+		})
+
+		g.Expect(err).To(MatchError(ContainSubstring("unable to find a csv")))
+	})
+
+	t.Run("rejects directories next to the CSV", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := bundle.LoadFS(fstest.MapFS{
+			"manifests/example.clusterserviceversion.yaml": {Data: []byte(testCSV)},
+			"manifests/nested/widgets.crd.yaml":            {Data: []byte(testCRD)},
+		})
+
+		g.Expect(err).To(MatchError(ContainSubstring("bundle manifests dir contains directory")))
+	})
+}
@@ -0,0 +1,43 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/operator-framework/api/pkg/manifests"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// FromObjects builds an OLM bundle of packageName from the JSON or YAML encoded manifests of its
+// objects, such as the olm.bundle.object properties of a catalog, without pulling the bundle image.
+// The objects must include the CSV, which the bundle is named after.
+func FromObjects(packageName string, objects [][]byte) (*manifests.Bundle, error) {
+	b := &manifests.Bundle{
+		Package: packageName,
+	}
+
+	for i, data := range objects {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.NewYAMLToJSONDecoder(bytes.NewReader(data)).Decode(obj); err != nil {
+			return nil, fmt.Errorf("unable to decode object %d: %w", i, err)
+		}
+
+		b.Objects = append(b.Objects, obj)
+		b.Size += int64(len(data))
+
+		if err := addTypedObject(b, obj, obj.GetKind()+" "+obj.GetName(), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.CSV == nil {
+		return nil, errors.New("unable to find a csv in bundle")
+	}
+
+	b.Name = b.CSV.GetName()
+
+	return b, nil
+}
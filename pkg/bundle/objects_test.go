@@ -0,0 +1,35 @@
+package bundle_test
+
+import (
+	"testing"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFromObjects(t *testing.T) {
+	t.Run("builds the bundle of the CSV", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := bundle.FromObjects("example", [][]byte{
+			[]byte(testCRD),
+			[]byte(`{"apiVersion":"operators.coreos.com/v1alpha1","kind":"ClusterServiceVersion","metadata":{"name":"example.v1.0.0"}}`),
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("example.v1.0.0"))
+		g.Expect(b.Package).To(Equal("example"))
+		g.Expect(b.CSV).ToNot(BeNil())
+		g.Expect(b.V1CRDs).To(HaveLen(1))
+		g.Expect(b.Objects).To(HaveLen(2))
+	})
+
+	t.Run("fails without a CSV", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := bundle.FromObjects("example", [][]byte{[]byte(testCRD)})
+
+		g.Expect(err).To(MatchError(ContainSubstring("unable to find a csv")))
+	})
+}
@@ -0,0 +1,282 @@
+// Package cache implements a persistent, content-addressed cache for pulled images and
+// derived artifacts such as extracted image content and parsed catalogs.
+//
+// Entries are stored as <dir>/<kind>/<key>, where key is derived from a content digest so
+// that an entry never needs to be invalidated, only evicted. The modification time of an
+// entry records when it was last used and drives eviction.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// dirPerms are the permissions of cache directories.
+	dirPerms = 0750
+
+	// tmpPrefix prefixes entries that are still being populated.
+	tmpPrefix = ".tmp-"
+)
+
+// Cache is a persistent cache rooted at a directory.
+type Cache struct {
+	dir string
+}
+
+// PruneOptions configures cache eviction.
+// Zero values disable the corresponding criterion.
+type PruneOptions struct {
+	// MaxAge evicts entries that have not been used for longer than this duration.
+	MaxAge time.Duration
+
+	// MaxSize evicts the least recently used entries until the total size is at most this many bytes.
+	MaxSize int64
+
+	// All evicts every entry.
+	All bool
+}
+
+// PruneResult summarizes the outcome of a prune operation.
+type PruneResult struct {
+	Removed    int   `json:"removed"`
+	FreedBytes int64 `json:"freedBytes"`
+	Remaining  int   `json:"remaining"`
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// entry is a single cache entry considered for eviction.
+type entry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// New returns a cache rooted at dir. The directory is created lazily.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Dir returns the root directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Lookup returns the path of the entry identified by kind and key, if present.
+// A hit marks the entry as recently used.
+func (c *Cache) Lookup(kind string, key string) (string, bool) {
+	path := c.path(kind, key)
+
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return path, true
+}
+
+// Store populates the entry identified by kind and key and returns its path.
+// populate receives a path that does not exist yet and must create either a file or a
+// directory there. The entry only becomes visible once populate succeeds, so readers never
+// observe partial content. If a concurrent writer stored the same entry first, its content
+// is kept.
+func (c *Cache) Store(kind string, key string, populate func(path string) error) (string, error) {
+	kindDir := filepath.Join(c.dir, kind)
+	if err := os.MkdirAll(kindDir, dirPerms); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(kindDir, tmpPrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary cache entry: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	tmpPath := filepath.Join(tmpDir, "entry")
+	if err := populate(tmpPath); err != nil {
+		return "", err
+	}
+
+	path := c.path(kind, key)
+	if err := os.Rename(tmpPath, path); err != nil {
+		// Another process may have stored the same content in the meantime
+		if _, statErr := os.Stat(path); statErr == nil {
+			return path, nil
+		}
+
+		return "", fmt.Errorf("failed to store cache entry: %w", err)
+	}
+
+	return path, nil
+}
+
+// Prune evicts cache entries according to opts.
+// Entries that are still being populated are only removed once they exceed MaxAge,
+// so that concurrent runs are not disrupted.
+func (c *Cache) Prune(opts PruneOptions) (PruneResult, error) {
+	result := PruneResult{}
+
+	entries, err := c.entries()
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	remaining := make([]entry, 0, len(entries))
+
+	for _, e := range entries {
+		expired := opts.MaxAge > 0 && now.Sub(e.lastUsed) > opts.MaxAge
+		inProgress := strings.HasPrefix(filepath.Base(e.path), tmpPrefix)
+
+		if expired || (opts.All && !inProgress) {
+			if err := c.remove(e, &result); err != nil {
+				return result, err
+			}
+
+			continue
+		}
+
+		remaining = append(remaining, e)
+	}
+
+	if opts.MaxSize > 0 {
+		// Least recently used entries first
+		sort.SliceStable(remaining, func(i int, j int) bool {
+			return remaining[i].lastUsed.Before(remaining[j].lastUsed)
+		})
+
+		total := int64(0)
+		for _, e := range remaining {
+			total += e.size
+		}
+
+		kept := make([]entry, 0, len(remaining))
+
+		for _, e := range remaining {
+			if total > opts.MaxSize && !strings.HasPrefix(filepath.Base(e.path), tmpPrefix) {
+				if err := c.remove(e, &result); err != nil {
+					return result, err
+				}
+
+				total -= e.size
+
+				continue
+			}
+
+			kept = append(kept, e)
+		}
+
+		remaining = kept
+	}
+
+	for _, e := range remaining {
+		result.Remaining++
+		result.TotalBytes += e.size
+	}
+
+	return result, nil
+}
+
+// path returns the location of the entry identified by kind and key.
+func (c *Cache) path(kind string, key string) string {
+	return filepath.Join(c.dir, kind, key)
+}
+
+// remove deletes a cache entry and records it in result.
+func (c *Cache) remove(e entry, result *PruneResult) error {
+	if err := os.RemoveAll(e.path); err != nil {
+		return fmt.Errorf("failed to remove cache entry %s: %w", e.path, err)
+	}
+
+	result.Removed++
+	result.FreedBytes += e.size
+
+	return nil
+}
+
+// entries lists all entries of all kinds in the cache.
+func (c *Cache) entries() ([]entry, error) {
+	kinds, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	entries := make([]entry, 0)
+
+	for _, kind := range kinds {
+		if !kind.IsDir() {
+			continue
+		}
+
+		kindDir := filepath.Join(c.dir, kind.Name())
+
+		items, err := os.ReadDir(kindDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache directory: %w", err)
+		}
+
+		for _, item := range items {
+			info, err := item.Info()
+			if err != nil {
+				continue
+			}
+
+			path := filepath.Join(kindDir, item.Name())
+
+			size, err := diskUsage(path)
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, entry{
+				path:     path,
+				size:     size,
+				lastUsed: info.ModTime(),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// diskUsage returns the total size of the regular files below path.
+func diskUsage(path string) (int64, error) {
+	size := int64(0)
+
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of cache entry %s: %w", path, err)
+	}
+
+	return size, nil
+}
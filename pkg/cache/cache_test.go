@@ -0,0 +1,184 @@
+package cache_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+
+	. "github.com/onsi/gomega"
+)
+
+func storeFile(t *testing.T, c *cache.Cache, kind string, key string, size int, lastUsed time.Time) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	path, err := c.Store(kind, key, func(path string) error {
+		return os.WriteFile(path, make([]byte, size), 0600)
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.Chtimes(path, lastUsed, lastUsed)).To(Succeed())
+
+	return path
+}
+
+func TestStore(t *testing.T) {
+	t.Run("stores and looks up entries", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+
+		_, ok := c.Lookup("images", "abc")
+		g.Expect(ok).To(BeFalse())
+
+		stored, err := c.Store("images", "abc", func(path string) error {
+			if err := os.Mkdir(path, 0750); err != nil {
+				return err
+			}
+
+			return os.WriteFile(filepath.Join(path, "file"), []byte("content"), 0600)
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		found, ok := c.Lookup("images", "abc")
+		g.Expect(ok).To(BeTrue())
+		g.Expect(found).To(Equal(stored))
+		g.Expect(filepath.Join(found, "file")).To(BeARegularFile())
+	})
+
+	t.Run("does not expose entries that failed to populate", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+
+		_, err := c.Store("images", "abc", func(path string) error {
+			_ = os.WriteFile(path, []byte("partial"), 0600)
+
+			return errors.New("download failed")
+		})
+		g.Expect(err).To(MatchError("download failed"))
+
+		_, ok := c.Lookup("images", "abc")
+		g.Expect(ok).To(BeFalse())
+
+		entries, err := os.ReadDir(filepath.Join(c.Dir(), "images"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(BeEmpty())
+	})
+
+	t.Run("keeps existing entry on concurrent store", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+		first := storeFile(t, c, "layers", "abc", 1, time.Now())
+
+		second, err := c.Store("layers", "abc", func(path string) error {
+			if err := os.Mkdir(path, 0750); err != nil {
+				return err
+			}
+
+			return os.WriteFile(filepath.Join(path, "file"), []byte("other"), 0600)
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(second).To(Equal(first))
+		g.Expect(first).To(BeARegularFile())
+	})
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("evicts entries unused for longer than max age", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+		old := storeFile(t, c, "layers", "old", 10, time.Now().Add(-48*time.Hour))
+		recent := storeFile(t, c, "layers", "recent", 20, time.Now())
+
+		result, err := c.Prune(cache.PruneOptions{MaxAge: 24 * time.Hour})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result).To(Equal(cache.PruneResult{Removed: 1, FreedBytes: 10, Remaining: 1, TotalBytes: 20}))
+		g.Expect(old).ToNot(BeAnExistingFile())
+		g.Expect(recent).To(BeAnExistingFile())
+	})
+
+	t.Run("evicts least recently used entries beyond max size", func(t *testing.T) {
+		g := NewWithT(t)
+
+		now := time.Now()
+		c := cache.New(t.TempDir())
+		oldest := storeFile(t, c, "layers", "a", 100, now.Add(-3*time.Hour))
+		older := storeFile(t, c, "images", "b", 100, now.Add(-2*time.Hour))
+		newest := storeFile(t, c, "catalogs", "c", 100, now.Add(-1*time.Hour))
+
+		result, err := c.Prune(cache.PruneOptions{MaxSize: 150})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Removed).To(Equal(2))
+		g.Expect(result.TotalBytes).To(Equal(int64(100)))
+		g.Expect(oldest).ToNot(BeAnExistingFile())
+		g.Expect(older).ToNot(BeAnExistingFile())
+		g.Expect(newest).To(BeAnExistingFile())
+	})
+
+	t.Run("lookup refreshes last use", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+		path := storeFile(t, c, "layers", "abc", 10, time.Now().Add(-48*time.Hour))
+
+		_, ok := c.Lookup("layers", "abc")
+		g.Expect(ok).To(BeTrue())
+
+		result, err := c.Prune(cache.PruneOptions{MaxAge: 24 * time.Hour})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Removed).To(BeZero())
+		g.Expect(path).To(BeAnExistingFile())
+	})
+
+	t.Run("evicts everything with all", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := cache.New(t.TempDir())
+		storeFile(t, c, "layers", "a", 10, time.Now())
+		storeFile(t, c, "images", "b", 10, time.Now())
+
+		result, err := c.Prune(cache.PruneOptions{All: true})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result).To(Equal(cache.PruneResult{Removed: 2, FreedBytes: 20}))
+	})
+
+	t.Run("handles missing cache directory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := cache.New(filepath.Join(t.TempDir(), "missing")).Prune(cache.PruneOptions{All: true})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result).To(Equal(cache.PruneResult{}))
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("parses max size quantity", func(t *testing.T) {
+		g := NewWithT(t)
+
+		opts, err := cache.Config{TTL: time.Hour, MaxSize: "1Gi"}.PruneOptions()
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(opts).To(Equal(cache.PruneOptions{MaxAge: time.Hour, MaxSize: 1 << 30}))
+	})
+
+	t.Run("rejects invalid max size", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := cache.Config{MaxSize: "lots"}.PruneOptions()
+
+		g.Expect(err).To(MatchError(ContainSubstring("invalid cache-max-size")))
+	})
+}
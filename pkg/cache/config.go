@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// DefaultTTL is how long unused entries are kept by default.
+	DefaultTTL = 7 * 24 * time.Hour
+
+	// DefaultMaxSize is the default upper bound of the cache size.
+	DefaultMaxSize = "10Gi"
+)
+
+// Config holds the cache settings shared by the commands.
+type Config struct {
+	// Dir is the cache directory. Caching is disabled when empty.
+	Dir     string        `mapstructure:"cache-dir"`
+	TTL     time.Duration `mapstructure:"cache-ttl"`
+	MaxSize string        `mapstructure:"cache-max-size"`
+}
+
+// PruneOptions converts the TTL and size settings to eviction options.
+// MaxSize accepts Kubernetes quantities such as 512Mi or 10Gi.
+func (c Config) PruneOptions() (PruneOptions, error) {
+	opts := PruneOptions{
+		MaxAge: c.TTL,
+	}
+
+	if c.MaxSize != "" {
+		q, err := resource.ParseQuantity(c.MaxSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cache-max-size %q: %w", c.MaxSize, err)
+		}
+
+		opts.MaxSize = q.Value()
+	}
+
+	return opts, nil
+}
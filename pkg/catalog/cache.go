@@ -0,0 +1,93 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+)
+
+// catalogsKind holds parsed catalogs serialized as FBC JSON, keyed by catalog image digest.
+const catalogsKind = "catalogs"
+
+// loadCachedCatalog returns the parsed catalog of an extracted catalog image from the cache,
+// parsing and storing it on a miss. Parsing large catalogs, or converting SQLite indexes, is
+// often slower than pulling them, so the parsed form is cached on top of the image content.
+func loadCachedCatalog(
+	ctx context.Context,
+	c *cache.Cache,
+	resource bundle.BundleResource,
+	tempDir string,
+) (*declcfg.DeclarativeConfig, error) {
+	// The manifest digest identifies the catalog content of the selected platform
+	key := strings.ReplaceAll(resource.ManifestDigest(), ":", "-") + ".json"
+
+	if path, ok := c.Lookup(catalogsKind, key); ok {
+		cfg, err := readCatalogFile(path)
+		if err == nil {
+			return cfg, nil
+		}
+		// A corrupted entry is not fatal, the catalog is parsed again below
+	}
+
+	info, err := os.Stat(resource.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extracted catalog: %w", err)
+	}
+
+	// The extracted content is shared through the cache, so it is loaded like a local
+	// catalog: a SQLite index is copied rather than migrated in place.
+	cfg, err := loadLocal(ctx, resource.Dir(), info, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Storing is best effort, failing to do so only costs parsing the catalog again next time
+	_, _ = c.Store(catalogsKind, key, func(path string) error {
+		return writeCatalogFile(path, cfg)
+	})
+
+	return cfg, nil
+}
+
+// readCatalogFile loads a catalog serialized by writeCatalogFile.
+func readCatalogFile(path string) (*declcfg.DeclarativeConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached catalog: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	cfg, err := declcfg.LoadReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cached catalog: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// writeCatalogFile serializes a catalog as FBC JSON.
+func writeCatalogFile(path string, cfg *declcfg.DeclarativeConfig) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create cached catalog: %w", err)
+	}
+
+	err = declcfg.WriteJSON(*cfg, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write cached catalog: %w", err)
+	}
+
+	return nil
+}
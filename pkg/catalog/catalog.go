@@ -2,24 +2,121 @@ package catalog
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/operator-framework/api/pkg/manifests"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+	"github.com/lburgazzoli/olm-extractor/pkg/extract"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
 	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
 )
 
-var catalogPathPrefixes = []string{"/configs/"} //nolint:gochecknoglobals
+// catalogPathPrefixes covers both file-based catalogs and legacy SQLite index images.
+var catalogPathPrefixes = []string{"/configs/", "/database/"} //nolint:gochecknoglobals
 
 // Config holds catalog resolution configuration.
 type Config struct {
-	CatalogImage string
+	CatalogImage string // Catalog image reference, or a local FBC directory or file
 	PackageName  string
 	Version      string // Optional
 	Channel      string // Optional, defaults to package's defaultChannel
+
+	// ResolveDependencies enables resolution of the bundles required by the package
+	// through olm.package.required and olm.gvk.required properties.
+	ResolveDependencies bool
+}
+
+// BundleSource is a bundle to extract, along with how it was resolved from a catalog.
+// Catalog fields are empty in direct mode.
+type BundleSource struct {
+	// Input is the bundle image reference or directory.
+	Input string
+
+	// Catalog is the catalog reference the bundle was resolved from.
+	Catalog string
+
+	// CatalogDigest is the digest the catalog image reference resolved to, empty for local catalogs.
+	CatalogDigest string
+
+	// Package, Channel and Version identify the bundle in the catalog.
+	Package string
+	Channel string
+	Version string
+
+	// Digest pins the digest of the bundle image, when it was read from a lock file.
+	Digest string
+
+	// Objects are the manifests of the bundle embedded in the catalog as olm.bundle.object
+	// properties. When they include the CSV, the bundle is built from them instead of pulling its image.
+	Objects [][]byte
+}
+
+// Reference returns the reference the bundle is loaded from, which is Input pinned to Digest
+// when it is set.
+func (s BundleSource) Reference() string {
+	if s.Digest == "" {
+		return s.Input
+	}
+
+	ref, err := name.ParseReference(s.Input)
+	if err != nil {
+		return s.Input
+	}
+
+	return ref.Context().Digest(s.Digest).String()
+}
+
+// LoadBundle loads the bundle: from the manifests embedded in the catalog when available, unless
+// registryConfig.PullBundles is set, or from its image otherwise. It also returns the digest the
+// bundle image reference resolved to, which is only known for embedded manifests when the image is
+// referenced by digest, as catalogs do, or pinned by a lock file.
+func (s BundleSource) LoadBundle(
+	ctx context.Context,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) (*manifests.Bundle, string, error) {
+	if len(s.Objects) == 0 || registryConfig.PullBundles {
+		return bundle.LoadWithDigest(ctx, s.Reference(), registryConfig, tempDir)
+	}
+
+	b, err := bundle.FromObjects(s.Package, s.Objects)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load bundle %s from catalog: %w", s.Input, err)
+	}
+
+	digest := s.Digest
+	if ref, err := name.NewDigest(s.Input); digest == "" && err == nil {
+		digest = ref.DigestStr()
+	}
+
+	return b, digest, nil
+}
+
+// Provenance describes where the resources extracted from the bundle come from, given the
+// digest the bundle image reference resolved to.
+func (s BundleSource) Provenance(bundleDigest string) extract.Provenance {
+	return extract.Provenance{
+		CatalogImage:  s.Catalog,
+		CatalogDigest: s.CatalogDigest,
+		Package:       s.Package,
+		Channel:       s.Channel,
+		Version:       s.Version,
+		BundleImage:   s.Input,
+		BundleDigest:  bundleDigest,
+	}
 }
 
 // ResolveBundleSource determines the bundle source from input and configuration.
@@ -33,29 +130,73 @@ func ResolveBundleSource(
 	registryConfig bundle.RegistryConfig,
 	tempDir string,
 ) (string, error) {
+	sources, err := ResolveBundleSources(ctx, input, catalogImage, channel, false, registryConfig, tempDir)
+	if err != nil {
+		return "", err
+	}
+
+	return sources[len(sources)-1], nil
+}
+
+// ResolveBundleSources determines the bundle sources from input and configuration.
+// It behaves like ResolveBundleSource, but when resolveDependencies is set in catalog mode the
+// bundles required by the package are resolved from the same catalog as well.
+// Sources are returned in install order: dependencies first and the requested bundle last.
+func ResolveBundleSources(
+	ctx context.Context,
+	input string,
+	catalogImage string,
+	channel string,
+	resolveDependencies bool,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) ([]string, error) {
+	sources, err := ResolveBundles(ctx, input, catalogImage, channel, resolveDependencies, registryConfig, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Map(sources, func(s BundleSource) string {
+		return s.Input
+	}), nil
+}
+
+// ResolveBundles behaves like ResolveBundleSources, but also returns the catalog, package, channel
+// and version each bundle was resolved from, so that rendered resources can record their provenance.
+func ResolveBundles(
+	ctx context.Context,
+	input string,
+	catalogImage string,
+	channel string,
+	resolveDependencies bool,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) ([]BundleSource, error) {
 	if catalogImage != "" {
 		packageName, packageVersion := parsePackageReference(input)
 
 		cfg := Config{
-			CatalogImage: catalogImage,
-			PackageName:  packageName,
-			Version:      packageVersion,
-			Channel:      channel,
+			CatalogImage:        catalogImage,
+			PackageName:         packageName,
+			Version:             packageVersion,
+			Channel:             channel,
+			ResolveDependencies: resolveDependencies,
 		}
 
-		bundleImage, err := ResolveBundleImage(ctx, cfg, registryConfig, tempDir)
+		sources, err := resolveBundles(ctx, cfg, registryConfig, tempDir)
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve bundle from catalog: %w", err)
+			return nil, fmt.Errorf("failed to resolve bundle from catalog: %w", err)
 		}
 
-		return bundleImage, nil
+		return sources, nil
 	}
 
-	return input, nil
+	return []BundleSource{{Input: input}}, nil
 }
 
 // parsePackageReference parses a package reference in the format package[:version].
-// Returns the package name and optionally the version.
+// Returns the package name and optionally the version, which may be a bundle name or
+// a semver constraint such as "1.2.3", "~1.2" or ">=0.56 <0.60".
 //
 //nolint:nonamedreturns // Named returns required to avoid confusing-results linter error
 func parsePackageReference(ref string) (pkgName string, pkgVersion string) {
@@ -70,65 +211,251 @@ func parsePackageReference(ref string) (pkgName string, pkgVersion string) {
 }
 
 // ResolveBundleImage resolves a package reference to a bundle image reference.
-// It pulls the catalog image, parses the FBC format, finds the requested package/version,
+// It loads the catalog (image or local path), parses the FBC format, finds the requested package/version,
 // and returns the bundle image reference.
 func ResolveBundleImage(ctx context.Context, config Config, registryConfig bundle.RegistryConfig, tempDir string) (string, error) {
-	// Pull and extract catalog image with catalog-specific path prefixes
-	bundleResource, err := bundle.ExtractImage(ctx, config.CatalogImage, registryConfig, tempDir, catalogPathPrefixes)
+	config.ResolveDependencies = false
+
+	bundleImages, err := ResolveBundleImages(ctx, config, registryConfig, tempDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract catalog image: %w", err)
+		return "", err
+	}
+
+	return bundleImages[0], nil
+}
+
+// ResolveBundleImages resolves a package reference to bundle image references.
+// When config.ResolveDependencies is set, the images of all bundles the package depends on are
+// included, ordered so that dependencies come before their dependents.
+func ResolveBundleImages(ctx context.Context, config Config, registryConfig bundle.RegistryConfig, tempDir string) ([]string, error) {
+	sources, err := resolveBundles(ctx, config, registryConfig, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Map(sources, func(s BundleSource) string {
+		return s.Input
+	}), nil
+}
+
+// resolveBundles resolves a package reference to the sources of its bundle and, when
+// config.ResolveDependencies is set, of its dependencies, ordered like ResolveBundleImages.
+func resolveBundles(ctx context.Context, config Config, registryConfig bundle.RegistryConfig, tempDir string) ([]BundleSource, error) {
+	catalog, catalogDigest, err := load(ctx, config.CatalogImage, registryConfig, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve package/channel/version to a bundle
+	b, err := Resolve(catalog, config.PackageName, config.Channel, config.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := []*declcfg.Bundle{b}
+	if config.ResolveDependencies {
+		bundles, err = ResolveDependencies(catalog, b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
+		}
+	}
+
+	sources := make([]BundleSource, 0, len(bundles))
+	for _, b := range bundles {
+		// The bundle image is stored in the bundle's Image field
+		if b.Image == "" {
+			return nil, fmt.Errorf("bundle %q has no image reference", b.Name)
+		}
+
+		// The requested channel only applies to the requested package
+		channel := ""
+		if b.Package == config.PackageName {
+			channel = config.Channel
+		}
+
+		sources = append(sources, BundleSource{
+			Input:         b.Image,
+			Catalog:       config.CatalogImage,
+			CatalogDigest: catalogDigest,
+			Package:       b.Package,
+			Channel:       bundleChannel(catalog, b, channel),
+			Version:       bundleVersion(b),
+			Objects:       bundleObjects(b),
+		})
+	}
+
+	return sources, nil
+}
+
+// EmbeddedObjects loads the catalog catalogRef pinned to catalogDigest, when set, and returns the
+// manifests embedded in its bundles keyed by bundle image, so that bundles pinned by a lock file
+// are built from the same manifests as when they were resolved. Bundles whose embedded manifests
+// do not include the CSV are left out, as they are pulled.
+func EmbeddedObjects(
+	ctx context.Context,
+	catalogRef string,
+	catalogDigest string,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) (map[string][][]byte, error) {
+	// Local images are not pinned by reference, but their digest must still match
+	pinned := catalogRef
+	if ref, err := name.ParseReference(catalogRef); err == nil && catalogDigest != "" && !registry.IsLocalReference(catalogRef) {
+		pinned = ref.Context().Digest(catalogDigest).String()
 	}
-	defer bundleResource.Cleanup()
 
-	// Load FBC from extracted directory
-	catalog, err := loadCatalog(ctx, bundleResource.Dir())
+	catalog, digest, err := load(ctx, pinned, registryConfig, tempDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to load catalog: %w", err)
+		return nil, err
 	}
 
+	if digest != catalogDigest {
+		return nil, fmt.Errorf("catalog %s resolved to %s instead of %s", catalogRef, digest, catalogDigest)
+	}
+
+	objects := make(map[string][][]byte)
+	for i := range catalog.Bundles {
+		if o := bundleObjects(&catalog.Bundles[i]); o != nil {
+			objects[catalog.Bundles[i].Image] = o
+		}
+	}
+
+	return objects, nil
+}
+
+// Resolve resolves a package reference to a bundle in an already loaded catalog.
+// channelName defaults to the package's defaultChannel when empty, and version
+// defaults to the channel head when empty.
+func Resolve(cfg *declcfg.DeclarativeConfig, packageName string, channelName string, version string) (*declcfg.Bundle, error) {
 	// Find package by name
-	pkg, err := findPackage(catalog, config.PackageName)
+	pkg, err := findPackage(cfg, packageName)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Determine channel
-	channelName := config.Channel
 	if channelName == "" {
 		if pkg.DefaultChannel == "" {
-			return "", fmt.Errorf("package %q has no defaultChannel and --channel was not specified", config.PackageName)
+			return nil, fmt.Errorf("package %q has no defaultChannel and --channel was not specified", packageName)
 		}
 		channelName = pkg.DefaultChannel
 	}
 
 	// Find channel
-	channel, err := findChannel(catalog, config.PackageName, channelName)
+	channel, err := findChannel(cfg, packageName, channelName)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Find bundle entry
-	bundleName, err := findBundleInChannel(channel, config.Version)
+	bundleName, err := findBundleInChannel(cfg, channel, version)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Extract bundle image reference
-	bundleImage, err := extractBundleImage(catalog, bundleName)
+	return findBundle(cfg, packageName, bundleName)
+}
+
+// Load loads a catalog and parses its FBC declarative config.
+// catalogRef is either a local FBC directory or file, or a catalog image reference that is
+// pulled and extracted, possibly from disk through the oci:, oci-archive: or docker-archive:
+// transports. Extracted content is released after loading.
+func Load(ctx context.Context, catalogRef string, registryConfig bundle.RegistryConfig, tempDir string) (*declcfg.DeclarativeConfig, error) {
+	cfg, _, err := load(ctx, catalogRef, registryConfig, tempDir)
+
+	return cfg, err
+}
+
+// load loads a catalog like Load, and also returns the digest the catalog image reference
+// resolved to, or an empty string for local catalogs.
+func load(
+	ctx context.Context,
+	catalogRef string,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) (*declcfg.DeclarativeConfig, string, error) {
+	// Local paths take precedence, mirroring how bundles accept a local directory
+	if info, err := os.Stat(catalogRef); err == nil {
+		if registryConfig.VerifyKey != "" {
+			return nil, "", fmt.Errorf("cannot verify the signature of local catalog %s", catalogRef)
+		}
+
+		cfg, err := loadLocal(ctx, catalogRef, info, tempDir)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load catalog from %s: %w", catalogRef, err)
+		}
+
+		return cfg, "", nil
+	}
+
+	// Pull and extract catalog image with catalog-specific path prefixes
+	bundleResource, err := bundle.ExtractImage(ctx, catalogRef, registryConfig, tempDir, catalogPathPrefixes)
 	if err != nil {
-		return "", err
+		return nil, "", fmt.Errorf("failed to extract catalog image: %w", err)
+	}
+	defer bundleResource.Cleanup()
+
+	// Reuse the parsed catalog of the same image digest when caching is enabled
+	if registryConfig.CacheDir != "" && bundleResource.ManifestDigest() != "" {
+		cfg, err := loadCachedCatalog(ctx, cache.New(registryConfig.CacheDir), bundleResource, tempDir)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load catalog: %w", err)
+		}
+
+		return cfg, bundleResource.Digest(), nil
+	}
+
+	// Load FBC from the extracted content
+	cfg, err := loadCatalog(ctx, bundleResource.FS(), tempDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load catalog: %w", err)
 	}
 
-	return bundleImage, nil
+	return cfg, bundleResource.Digest(), nil
 }
 
-// loadCatalog loads the FBC declarative config from a directory.
-// Catalog images typically have FBC files in a `/configs` subdirectory.
-func loadCatalog(ctx context.Context, dir string) (*declcfg.DeclarativeConfig, error) {
+// loadLocal loads the declarative config from a local directory or a single FBC file.
+// A SQLite index found locally is copied before loading, so that the schema migration
+// never modifies the user's file.
+func loadLocal(ctx context.Context, path string, info os.FileInfo, tempDir string) (*declcfg.DeclarativeConfig, error) {
+	if info.IsDir() {
+		return loadCatalog(ctx, os.DirFS(path), tempDir)
+	}
+
+	parent, name := os.DirFS(filepath.Dir(path)), filepath.Base(path)
+	if isSQLiteFile(parent, name) {
+		return loadSQLiteCatalogCopy(ctx, parent, name, tempDir)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	cfg, err := declcfg.LoadReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// loadCatalog loads the declarative config from the content of a catalog.
+// Catalog images typically have FBC files in a `/configs` subdirectory, while legacy
+// index images ship a SQLite database at `/database/index.db`, which is loaded from a
+// copy in tempDir.
+func loadCatalog(ctx context.Context, fsys fs.FS, tempDir string) (*declcfg.DeclarativeConfig, error) {
 	// Try loading from /configs subdirectory first (common for catalog images)
-	configsDir := dir + "/configs"
-	if info, err := os.Stat(configsDir); err == nil && info.IsDir() {
-		cfg, err := declcfg.LoadFS(ctx, os.DirFS(configsDir))
+	if info, err := fs.Stat(fsys, "configs"); err == nil && info.IsDir() {
+		configs, err := fs.Sub(fsys, "configs")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read configs directory: %w", err)
+		}
+
+		cfg, err := declcfg.LoadFS(ctx, configs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse catalog from configs directory: %w", err)
 		}
@@ -136,8 +463,18 @@ func loadCatalog(ctx context.Context, dir string) (*declcfg.DeclarativeConfig, e
 		return cfg, nil
 	}
 
+	// Then try a legacy SQLite index database
+	if isSQLiteIndex(fsys) {
+		cfg, err := loadSQLiteCatalogCopy(ctx, fsys, sqliteIndexPath, tempDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse catalog from SQLite index: %w", err)
+		}
+
+		return cfg, nil
+	}
+
 	// Fallback to root directory
-	cfg, err := declcfg.LoadFS(ctx, os.DirFS(dir))
+	cfg, err := declcfg.LoadFS(ctx, fsys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse catalog: %w", err)
 	}
@@ -178,44 +515,99 @@ func findChannel(cfg *declcfg.DeclarativeConfig, packageName string, channelName
 	return &ch, nil
 }
 
-// findBundleInChannel finds a bundle in a channel by version or returns the latest.
-func findBundleInChannel(channel *declcfg.Channel, version string) (string, error) {
+// findBundleInChannel finds a bundle in a channel by version or returns the channel head.
+// The head is resolved from the channel's upgrade graph rather than from entry order,
+// since FBC does not guarantee any particular ordering of channel entries.
+func findBundleInChannel(cfg *declcfg.DeclarativeConfig, channel *declcfg.Channel, version string) (string, error) {
 	if version != "" {
-		// Find specific version
-		entry, found := slices.Find(channel.Entries, func(e declcfg.ChannelEntry) bool {
-			return e.Name == version
-		})
-		if !found {
-			return "", fmt.Errorf("version %q not found in channel %q", version, channel.Name)
-		}
+		return findBundleByVersion(cfg, channel, version)
+	}
+
+	head, err := ChannelHead(cfg, channel)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve channel head: %w", err)
+	}
+
+	return head, nil
+}
+
+// findBundle finds a bundle by package and name in the catalog.
+func findBundle(cfg *declcfg.DeclarativeConfig, packageName string, bundleName string) (*declcfg.Bundle, error) {
+	b, found := slices.Find(cfg.Bundles, func(b declcfg.Bundle) bool {
+		return b.Package == packageName && b.Name == bundleName
+	})
+	if !found {
+		return nil, fmt.Errorf("bundle %q not found in catalog", bundleName)
+	}
 
-		return entry.Name, nil
+	return &b, nil
+}
+
+// bundleChannel returns the channel a bundle was resolved from: channelName when set, then the
+// package's defaultChannel when it contains the bundle, then the first channel containing it.
+func bundleChannel(cfg *declcfg.DeclarativeConfig, b *declcfg.Bundle, channelName string) string {
+	if channelName != "" {
+		return channelName
 	}
 
-	// Return the head of the channel (latest version)
-	if len(channel.Entries) == 0 {
-		return "", fmt.Errorf("channel %q has no entries", channel.Name)
+	containing := slices.Filter(cfg.Channels, func(c declcfg.Channel) bool {
+		return c.Package == b.Package && slices.Any(c.Entries, func(e declcfg.ChannelEntry) bool {
+			return e.Name == b.Name
+		})
+	})
+	if len(containing) == 0 {
+		return ""
 	}
 
-	// The channel head is typically the first entry or explicitly marked
-	// In FBC, the head is usually the entry without a replaces field pointing to it
-	// For simplicity, we'll use the first entry as it's typically the latest
-	return channel.Entries[0].Name, nil
+	if pkg, err := findPackage(cfg, b.Package); err == nil {
+		if ch, found := slices.Find(containing, func(c declcfg.Channel) bool {
+			return c.Name == pkg.DefaultChannel
+		}); found {
+			return ch.Name
+		}
+	}
+
+	return containing[0].Name
 }
 
-// extractBundleImage extracts the bundle image reference from a bundle's properties.
-func extractBundleImage(cfg *declcfg.DeclarativeConfig, bundleName string) (string, error) {
-	bundleEntry, found := slices.Find(cfg.Bundles, func(b declcfg.Bundle) bool {
-		return b.Name == bundleName
+// bundleVersion returns the olm.package version of a bundle, or an empty string when it has none.
+func bundleVersion(b *declcfg.Bundle) string {
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return ""
+	}
+
+	p, found := slices.Find(props.Packages, func(p property.Package) bool {
+		return p.PackageName == b.Package
 	})
 	if !found {
-		return "", fmt.Errorf("bundle %q not found in catalog", bundleName)
+		return ""
 	}
 
-	// The bundle image is stored in the bundle's Image field
-	if bundleEntry.Image == "" {
-		return "", fmt.Errorf("bundle %q has no image reference", bundleName)
+	return p.Version
+}
+
+// bundleObjects returns the manifests embedded in a bundle as olm.bundle.object properties, or nil
+// when they do not include the CSV. Catalogs only carrying olm.csv.metadata lack the install strategy
+// of the CSV, so their bundles must be pulled.
+func bundleObjects(b *declcfg.Bundle) [][]byte {
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return nil
+	}
+
+	objects := slices.Map(props.BundleObjects, func(o property.BundleObject) []byte {
+		return o.Data
+	})
+
+	hasCSV := slices.Any(objects, func(data []byte) bool {
+		meta := metav1.TypeMeta{}
+
+		return json.Unmarshal(data, &meta) == nil && meta.Kind == operatorsv1alpha1.ClusterServiceVersionKind
+	})
+	if !hasCSV {
+		return nil
 	}
 
-	return bundleEntry.Image, nil
+	return objects
 }
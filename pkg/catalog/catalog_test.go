@@ -0,0 +1,181 @@
+package catalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+)
+
+func writeCatalogFile(t *testing.T, path string, write declcfg.WriteFunc) {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	g.Expect(os.MkdirAll(filepath.Dir(path), 0750)).To(Succeed())
+
+	f, err := os.Create(path)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	g.Expect(write(*newVersionedCatalog(), f)).To(Succeed())
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("loads local FBC directory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		writeCatalogFile(t, filepath.Join(dir, testPackage, "catalog.yaml"), declcfg.WriteYAML)
+
+		cfg, err := catalog.Load(t.Context(), dir, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Packages).To(HaveLen(1))
+		g.Expect(cfg.Bundles).To(HaveLen(6))
+	})
+
+	t.Run("prefers configs subdirectory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		writeCatalogFile(t, filepath.Join(dir, "configs", testPackage, "catalog.json"), declcfg.WriteJSON)
+		g.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a catalog"), 0600)).To(Succeed())
+
+		cfg, err := catalog.Load(t.Context(), dir, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Bundles).To(HaveLen(6))
+	})
+
+	t.Run("loads single FBC file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		path := filepath.Join(t.TempDir(), "catalog.json")
+		writeCatalogFile(t, path, declcfg.WriteJSON)
+
+		cfg, err := catalog.Load(t.Context(), path, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := catalog.Resolve(cfg, testPackage, "", "~1.2")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Image).To(Equal("quay.io/example/op.v1.2.3"))
+	})
+
+	t.Run("returns error for invalid FBC file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		path := filepath.Join(t.TempDir(), "catalog.yaml")
+		g.Expect(os.WriteFile(path, []byte("schema: [invalid"), 0600)).To(Succeed())
+
+		_, err := catalog.Load(t.Context(), path, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).To(MatchError(ContainSubstring("failed to parse catalog file")))
+	})
+}
+
+func TestResolveBundleSources(t *testing.T) {
+	t.Run("resolves package from local catalog", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		writeCatalogFile(t, filepath.Join(dir, "catalog.yaml"), declcfg.WriteYAML)
+
+		sources, err := catalog.ResolveBundleSources(
+			t.Context(), testPackage+":0.56.0", dir, "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(Equal([]string{"quay.io/example/op.v0.56.0"}))
+	})
+
+	t.Run("returns input as-is without catalog", func(t *testing.T) {
+		g := NewWithT(t)
+
+		sources, err := catalog.ResolveBundleSources(
+			t.Context(), "./bundle", "", "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(Equal([]string{"./bundle"}))
+	})
+}
+
+func TestResolveBundles(t *testing.T) {
+	t.Run("records how the bundle was resolved", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		writeCatalogFile(t, filepath.Join(dir, "catalog.yaml"), declcfg.WriteYAML)
+
+		sources, err := catalog.ResolveBundles(
+			t.Context(), testPackage+":~1.2", dir, "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(Equal([]catalog.BundleSource{{
+			Input:   "quay.io/example/op.v1.2.3",
+			Catalog: dir,
+			Package: testPackage,
+			Channel: "stable",
+			Version: "1.2.3",
+		}}))
+	})
+
+	t.Run("builds bundles from the manifests embedded in the catalog", func(t *testing.T) {
+		g := NewWithT(t)
+
+		const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+		cfg := newVersionedCatalog()
+		head := &cfg.Bundles[len(cfg.Bundles)-1]
+		head.Image = "quay.io/example/op@" + digest
+		head.Properties = append(head.Properties,
+			property.MustBuildBundleObject([]byte(`{"apiVersion":"operators.coreos.com/v1alpha1","kind":"ClusterServiceVersion","metadata":{"name":"op.v1.3.0"}}`)),
+		)
+
+		path := filepath.Join(t.TempDir(), "catalog.json")
+		f, err := os.Create(path)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(declcfg.WriteJSON(*cfg, f)).To(Succeed())
+		g.Expect(f.Close()).To(Succeed())
+
+		sources, err := catalog.ResolveBundles(
+			t.Context(), testPackage, path, "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(HaveLen(1))
+		g.Expect(sources[0].Objects).To(HaveLen(1))
+
+		b, bundleDigest, err := sources[0].LoadBundle(t.Context(), bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.3.0"))
+		g.Expect(b.Package).To(Equal(testPackage))
+		g.Expect(bundleDigest).To(Equal(digest))
+	})
+
+	t.Run("returns input as-is without catalog", func(t *testing.T) {
+		g := NewWithT(t)
+
+		sources, err := catalog.ResolveBundles(
+			t.Context(), "./bundle", "", "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(Equal([]catalog.BundleSource{{Input: "./bundle"}}))
+	})
+}
@@ -0,0 +1,216 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver/v4"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
+)
+
+// dependencyResolver walks olm.package.required and olm.gvk.required properties of bundles.
+// Dependencies declared in a bundle's metadata/dependencies.yaml are rendered into these
+// properties when the catalog is built, so both sources are covered.
+type dependencyResolver struct {
+	cfg *declcfg.DeclarativeConfig
+
+	// selected maps a package name to the bundle chosen for it.
+	selected map[string]*declcfg.Bundle
+
+	// ordered holds the selected bundles with dependencies before their dependents.
+	ordered []*declcfg.Bundle
+}
+
+// ResolveDependencies resolves the bundles required by root, transitively.
+// Returns the bundles in install order: dependencies first and root last.
+//
+// Required packages are resolved by selecting the highest version within the required
+// versionRange, from the defaultChannel when possible and from any other channel otherwise.
+// Required GVKs are satisfied by any already selected bundle providing them, otherwise by the
+// head of the defaultChannel of a package that provides them. A dependency cycle is tolerated,
+// as OLM installs such operators together.
+func ResolveDependencies(cfg *declcfg.DeclarativeConfig, root *declcfg.Bundle) ([]*declcfg.Bundle, error) {
+	r := &dependencyResolver{
+		cfg:      cfg,
+		selected: make(map[string]*declcfg.Bundle),
+	}
+
+	if err := r.visit(root); err != nil {
+		return nil, err
+	}
+
+	return r.ordered, nil
+}
+
+// visit selects b and resolves its dependencies before appending it to the install order.
+func (r *dependencyResolver) visit(b *declcfg.Bundle) error {
+	// Select before recursing so that dependency cycles terminate.
+	r.selected[b.Package] = b
+
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to parse properties of bundle %q: %w", b.Name, err)
+	}
+
+	for _, req := range props.PackagesRequired {
+		if err := r.requirePackage(b, req); err != nil {
+			return err
+		}
+	}
+
+	for _, req := range props.GVKsRequired {
+		if err := r.requireGVK(b, req); err != nil {
+			return err
+		}
+	}
+
+	r.ordered = append(r.ordered, b)
+
+	return nil
+}
+
+// requirePackage satisfies an olm.package.required dependency of b.
+func (r *dependencyResolver) requirePackage(b *declcfg.Bundle, req property.PackageRequired) error {
+	versionRange, err := semver.ParseRange(req.VersionRange)
+	if err != nil {
+		return fmt.Errorf(
+			"bundle %q has invalid versionRange %q for package %q: %w",
+			b.Name, req.VersionRange, req.PackageName, err,
+		)
+	}
+
+	if existing, ok := r.selected[req.PackageName]; ok {
+		v, ok := bundleVersions(r.cfg, req.PackageName)[existing.Name]
+		if !ok || !versionRange(v) {
+			return fmt.Errorf(
+				"bundle %q requires package %q in range %q, which conflicts with selected bundle %q",
+				b.Name, req.PackageName, req.VersionRange, existing.Name,
+			)
+		}
+
+		return nil
+	}
+
+	dep, err := r.highestInRange(req.PackageName, versionRange)
+	if err != nil {
+		return fmt.Errorf("failed to resolve package %q required by bundle %q: %w", req.PackageName, b.Name, err)
+	}
+
+	return r.visit(dep)
+}
+
+// requireGVK satisfies an olm.gvk.required dependency of b.
+func (r *dependencyResolver) requireGVK(b *declcfg.Bundle, req property.GVKRequired) error {
+	gvk := property.GVK(req)
+
+	// Prefer bundles that are already part of the install set, including b itself.
+	for _, selected := range r.selected {
+		if providesGVK(selected, gvk) {
+			return nil
+		}
+	}
+
+	packageNames := make([]string, 0, len(r.cfg.Packages))
+	for _, p := range r.cfg.Packages {
+		packageNames = append(packageNames, p.Name)
+	}
+
+	sort.Strings(packageNames)
+
+	for _, name := range packageNames {
+		if _, ok := r.selected[name]; ok {
+			continue
+		}
+
+		dep, err := Resolve(r.cfg, name, "", "")
+		if err != nil || !providesGVK(dep, gvk) {
+			continue
+		}
+
+		return r.visit(dep)
+	}
+
+	return fmt.Errorf(
+		"no package in catalog provides %s/%s, Kind=%s required by bundle %q",
+		req.Group, req.Version, req.Kind, b.Name,
+	)
+}
+
+// highestInRange returns the highest version of a package matching versionRange.
+// The defaultChannel is preferred, as OLM does; other channels are only searched when
+// no version in the defaultChannel satisfies the range.
+func (r *dependencyResolver) highestInRange(packageName string, versionRange semver.Range) (*declcfg.Bundle, error) {
+	pkg, err := findPackage(r.cfg, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := bundleVersions(r.cfg, packageName)
+
+	if pkg.DefaultChannel != "" {
+		channel, err := findChannel(r.cfg, packageName, pkg.DefaultChannel)
+		if err != nil {
+			return nil, err
+		}
+
+		if name, ok := highestEntryInRange([]declcfg.Channel{*channel}, versions, versionRange); ok {
+			return findBundle(r.cfg, packageName, name)
+		}
+	}
+
+	others := slices.Filter(r.cfg.Channels, func(c declcfg.Channel) bool {
+		return c.Package == packageName && c.Name != pkg.DefaultChannel
+	})
+
+	name, ok := highestEntryInRange(others, versions, versionRange)
+	if !ok {
+		return nil, fmt.Errorf("no version in any channel of package %q satisfies the required range", packageName)
+	}
+
+	return findBundle(r.cfg, packageName, name)
+}
+
+// highestEntryInRange returns the name of the highest version entry of the channels matching versionRange.
+func highestEntryInRange(channels []declcfg.Channel, versions map[string]semver.Version, versionRange semver.Range) (string, bool) {
+	var (
+		bestName    string
+		bestVersion semver.Version
+		found       bool
+	)
+
+	for _, channel := range channels {
+		for _, entry := range channel.Entries {
+			v, ok := versions[entry.Name]
+			if !ok || !versionRange(v) {
+				continue
+			}
+
+			if !found || v.GT(bestVersion) {
+				bestName = entry.Name
+				bestVersion = v
+				found = true
+			}
+		}
+	}
+
+	return bestName, found
+}
+
+// providesGVK returns true if the bundle declares the given olm.gvk property.
+func providesGVK(b *declcfg.Bundle, gvk property.GVK) bool {
+	props, err := property.Parse(b.Properties)
+	if err != nil {
+		return false
+	}
+
+	for _, provided := range props.GVKs {
+		if provided == gvk {
+			return true
+		}
+	}
+
+	return false
+}
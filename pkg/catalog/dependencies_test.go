@@ -0,0 +1,228 @@
+package catalog_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+)
+
+func newPackageBundle(pkg string, version string, props ...property.Property) declcfg.Bundle {
+	value, _ := json.Marshal(property.Package{PackageName: pkg, Version: version})
+
+	return declcfg.Bundle{
+		Schema:     declcfg.SchemaBundle,
+		Name:       pkg + ".v" + version,
+		Package:    pkg,
+		Image:      "quay.io/example/" + pkg + ":v" + version,
+		Properties: append([]property.Property{{Type: property.TypePackage, Value: value}}, props...),
+	}
+}
+
+func requiresPackage(pkg string, versionRange string) property.Property {
+	value, _ := json.Marshal(property.PackageRequired{PackageName: pkg, VersionRange: versionRange})
+
+	return property.Property{Type: property.TypePackageRequired, Value: value}
+}
+
+func requiresGVK(group string, version string, kind string) property.Property {
+	value, _ := json.Marshal(property.GVKRequired{Group: group, Version: version, Kind: kind})
+
+	return property.Property{Type: property.TypeGVKRequired, Value: value}
+}
+
+func providesGVK(group string, version string, kind string) property.Property {
+	value, _ := json.Marshal(property.GVK{Group: group, Version: version, Kind: kind})
+
+	return property.Property{Type: property.TypeGVK, Value: value}
+}
+
+func addPackage(cfg *declcfg.DeclarativeConfig, bundles ...declcfg.Bundle) {
+	name := bundles[0].Package
+	cfg.Packages = append(cfg.Packages, declcfg.Package{Schema: declcfg.SchemaPackage, Name: name, DefaultChannel: "stable"})
+
+	entries := make([]declcfg.ChannelEntry, 0, len(bundles))
+	for i, b := range bundles {
+		entry := declcfg.ChannelEntry{Name: b.Name}
+		if i > 0 {
+			entry.Replaces = bundles[i-1].Name
+		}
+
+		entries = append(entries, entry)
+	}
+
+	cfg.Channels = append(cfg.Channels, declcfg.Channel{Schema: declcfg.SchemaChannel, Name: "stable", Package: name, Entries: entries})
+	cfg.Bundles = append(cfg.Bundles, bundles...)
+}
+
+func TestResolveDependencies(t *testing.T) {
+	t.Run("returns only the root bundle when it has no dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0"))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(1))
+		g.Expect(bundles[0].Name).To(Equal("app.v1.0.0"))
+	})
+
+	t.Run("resolves required packages transitively in install order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0", requiresPackage("common", ">=1.0.0 <2.0.0")))
+		addPackage(cfg,
+			newPackageBundle("common", "1.0.0"),
+			newPackageBundle("common", "1.5.0", requiresPackage("base", ">=0.1.0")),
+			newPackageBundle("common", "2.0.0"),
+		)
+		addPackage(cfg, newPackageBundle("base", "0.2.0"))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(3))
+		g.Expect(bundles[0].Name).To(Equal("base.v0.2.0"))
+		g.Expect(bundles[1].Name).To(Equal("common.v1.5.0"))
+		g.Expect(bundles[2].Name).To(Equal("app.v1.0.0"))
+	})
+
+	t.Run("resolves required GVKs from the providing package", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0", requiresGVK("example.com", "v1", "Widget")))
+		addPackage(cfg, newPackageBundle("unrelated", "1.0.0"))
+		addPackage(cfg, newPackageBundle("widgets", "3.0.0", providesGVK("example.com", "v1", "Widget")))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(2))
+		g.Expect(bundles[0].Name).To(Equal("widgets.v3.0.0"))
+		g.Expect(bundles[1].Name).To(Equal("app.v1.0.0"))
+	})
+
+	t.Run("shares a dependency required by multiple packages", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0",
+			requiresPackage("left", ">=1.0.0"),
+			requiresPackage("right", ">=1.0.0"),
+		))
+		addPackage(cfg, newPackageBundle("left", "1.0.0", requiresPackage("common", ">=1.0.0")))
+		addPackage(cfg, newPackageBundle("right", "1.0.0", requiresPackage("common", "<2.0.0")))
+		addPackage(cfg, newPackageBundle("common", "1.1.0"))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(4))
+		g.Expect(bundles[0].Name).To(Equal("common.v1.1.0"))
+		g.Expect(bundles[3].Name).To(Equal("app.v1.0.0"))
+	})
+
+	t.Run("resolves required packages from other channels", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0", requiresPackage("common", ">=2.0.0")))
+		addPackage(cfg, newPackageBundle("common", "1.0.0"))
+
+		// The satisfying versions are only published in channels other than the defaultChannel
+		cfg.Bundles = append(cfg.Bundles, newPackageBundle("common", "2.0.0"), newPackageBundle("common", "2.1.0"))
+		cfg.Channels = append(cfg.Channels,
+			declcfg.Channel{Schema: declcfg.SchemaChannel, Name: "fast", Package: "common", Entries: []declcfg.ChannelEntry{
+				{Name: "common.v2.0.0", Replaces: "common.v1.0.0"},
+			}},
+			declcfg.Channel{Schema: declcfg.SchemaChannel, Name: "candidate", Package: "common", Entries: []declcfg.ChannelEntry{
+				{Name: "common.v2.1.0", Replaces: "common.v2.0.0"},
+			}},
+		)
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(2))
+		g.Expect(bundles[0].Name).To(Equal("common.v2.1.0"))
+	})
+
+	t.Run("prefers the defaultChannel for required packages", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0", requiresPackage("common", ">=1.0.0")))
+		addPackage(cfg, newPackageBundle("common", "1.0.0"))
+
+		cfg.Bundles = append(cfg.Bundles, newPackageBundle("common", "2.0.0"))
+		cfg.Channels = append(cfg.Channels, declcfg.Channel{
+			Schema: declcfg.SchemaChannel, Name: "fast", Package: "common",
+			Entries: []declcfg.ChannelEntry{{Name: "common.v2.0.0", Replaces: "common.v1.0.0"}},
+		})
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundles, err := catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles[0].Name).To(Equal("common.v1.0.0"))
+	})
+
+	t.Run("returns error for conflicting version ranges", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0",
+			requiresPackage("common", ">=2.0.0"),
+			requiresPackage("other", ">=1.0.0"),
+		))
+		addPackage(cfg, newPackageBundle("other", "1.0.0", requiresPackage("common", "<2.0.0")))
+		addPackage(cfg, newPackageBundle("common", "1.0.0"), newPackageBundle("common", "2.0.0"))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).To(MatchError(ContainSubstring("conflicts with selected bundle")))
+	})
+
+	t.Run("returns error for unsatisfiable GVK", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := &declcfg.DeclarativeConfig{}
+		addPackage(cfg, newPackageBundle("app", "1.0.0", requiresGVK("example.com", "v1", "Widget")))
+
+		root, err := catalog.Resolve(cfg, "app", "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = catalog.ResolveDependencies(cfg, root)
+
+		g.Expect(err).To(MatchError(ContainSubstring("no package in catalog provides example.com/v1, Kind=Widget")))
+	})
+}
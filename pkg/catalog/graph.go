@@ -0,0 +1,275 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// ErrMultipleHeads is returned when a channel upgrade graph has more than one head.
+var ErrMultipleHeads = errors.New("multiple channel heads found")
+
+// ErrCycle is returned when a channel upgrade graph contains a cycle.
+var ErrCycle = errors.New("upgrade graph contains a cycle")
+
+// channelGraph is the upgrade graph of a single channel.
+// An edge from A to B means that A upgrades from B, either because A replaces B,
+// A lists B in skips, or B's version falls within A's skipRange.
+type channelGraph struct {
+	channel  *declcfg.Channel
+	entries  map[string]declcfg.ChannelEntry
+	versions map[string]semver.Version
+	outgoing map[string][]string
+	incoming map[string][]string
+}
+
+// ChannelHead returns the name of the channel head: the single entry that no other
+// entry in the channel replaces or skips.
+// Returns an error if the channel is empty, has multiple heads, or contains a cycle.
+func ChannelHead(cfg *declcfg.DeclarativeConfig, channel *declcfg.Channel) (string, error) {
+	graph, err := newChannelGraph(channel, bundleVersions(cfg, channel.Package))
+	if err != nil {
+		return "", err
+	}
+
+	return graph.head()
+}
+
+// newChannelGraph builds the upgrade graph of a channel.
+// versions maps bundle names to their olm.package version and is used to evaluate skipRange.
+// Edges pointing at entries that are not part of the channel are ignored, as OLM allows
+// replaces/skips to reference bundles that have been pruned from the catalog.
+func newChannelGraph(channel *declcfg.Channel, versions map[string]semver.Version) (*channelGraph, error) {
+	if len(channel.Entries) == 0 {
+		return nil, fmt.Errorf("channel %q has no entries", channel.Name)
+	}
+
+	g := &channelGraph{
+		channel:  channel,
+		entries:  make(map[string]declcfg.ChannelEntry, len(channel.Entries)),
+		versions: versions,
+		outgoing: make(map[string][]string, len(channel.Entries)),
+		incoming: make(map[string][]string, len(channel.Entries)),
+	}
+
+	for _, entry := range channel.Entries {
+		if _, exists := g.entries[entry.Name]; exists {
+			return nil, fmt.Errorf("duplicate entry %q in channel %q", entry.Name, channel.Name)
+		}
+
+		g.entries[entry.Name] = entry
+	}
+
+	for _, entry := range channel.Entries {
+		if entry.Replaces != "" {
+			g.addEdge(entry.Name, entry.Replaces)
+		}
+
+		for _, skip := range entry.Skips {
+			g.addEdge(entry.Name, skip)
+		}
+
+		if entry.SkipRange != "" {
+			if err := g.addSkipRangeEdges(entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := g.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// addEdge records that from upgrades from to, ignoring self-references, unknown entries
+// and duplicate edges.
+func (g *channelGraph) addEdge(from string, to string) {
+	if from == to {
+		return
+	}
+
+	if _, ok := g.entries[to]; !ok {
+		return
+	}
+
+	for _, existing := range g.outgoing[from] {
+		if existing == to {
+			return
+		}
+	}
+
+	g.outgoing[from] = append(g.outgoing[from], to)
+	g.incoming[to] = append(g.incoming[to], from)
+}
+
+// addSkipRangeEdges adds an edge from entry to every lower-versioned entry within its skipRange.
+// Only lower versions are considered so that overlapping ranges do not produce spurious cycles.
+func (g *channelGraph) addSkipRangeEdges(entry declcfg.ChannelEntry) error {
+	skipRange, err := semver.ParseRange(entry.SkipRange)
+	if err != nil {
+		return fmt.Errorf("invalid skipRange %q for entry %q: %w", entry.SkipRange, entry.Name, err)
+	}
+
+	fromVersion, hasVersion := g.versions[entry.Name]
+
+	for _, other := range g.channel.Entries {
+		otherVersion, ok := g.versions[other.Name]
+		if !ok || !skipRange(otherVersion) {
+			continue
+		}
+
+		if hasVersion && otherVersion.GTE(fromVersion) {
+			continue
+		}
+
+		g.addEdge(entry.Name, other.Name)
+	}
+
+	return nil
+}
+
+// head returns the single entry with no incoming edges.
+func (g *channelGraph) head() (string, error) {
+	heads := make([]string, 0, 1)
+
+	for _, entry := range g.channel.Entries {
+		if len(g.incoming[entry.Name]) == 0 {
+			heads = append(heads, entry.Name)
+		}
+	}
+
+	switch len(heads) {
+	case 0:
+		// Unreachable after checkCycles, kept as a safeguard.
+		return "", fmt.Errorf("channel %q: %w", g.channel.Name, ErrCycle)
+	case 1:
+		return heads[0], nil
+	default:
+		sort.Strings(heads)
+
+		return "", fmt.Errorf("channel %q: %w: %s", g.channel.Name, ErrMultipleHeads, strings.Join(heads, ", "))
+	}
+}
+
+// reachable returns the names of all entries that can be upgraded to from the given entry,
+// including the entry itself.
+func (g *channelGraph) reachable(from string) map[string]bool {
+	seen := map[string]bool{from: true}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, next := range g.outgoing[name] {
+			if seen[next] {
+				continue
+			}
+
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+
+	return seen
+}
+
+// checkCycles returns an error describing the first cycle found in the graph.
+func (g *channelGraph) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(g.entries))
+	path := make([]string, 0, len(g.entries))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+
+					break
+				}
+			}
+
+			cycle := append(append([]string{}, path[start:]...), name)
+
+			return fmt.Errorf("channel %q: %w: %s", g.channel.Name, ErrCycle, strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, next := range g.outgoing[name] {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, entry := range g.channel.Entries {
+		if state[entry.Name] != unvisited {
+			continue
+		}
+
+		if err := visit(entry.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bundleVersions returns the olm.package version of every bundle in the given package.
+// Bundles without a parseable version are omitted.
+func bundleVersions(cfg *declcfg.DeclarativeConfig, packageName string) map[string]semver.Version {
+	versions := make(map[string]semver.Version)
+
+	for _, b := range cfg.Bundles {
+		if b.Package != packageName {
+			continue
+		}
+
+		props, err := property.Parse(b.Properties)
+		if err != nil {
+			continue
+		}
+
+		for _, p := range props.Packages {
+			if p.PackageName != packageName {
+				continue
+			}
+
+			v, err := semver.Parse(p.Version)
+			if err != nil {
+				continue
+			}
+
+			versions[b.Name] = v
+
+			break
+		}
+	}
+
+	return versions
+}
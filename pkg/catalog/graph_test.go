@@ -0,0 +1,150 @@
+package catalog_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+)
+
+const testPackage = "test-operator"
+
+func newBundle(name string, version string) declcfg.Bundle {
+	value, _ := json.Marshal(property.Package{PackageName: testPackage, Version: version})
+
+	return declcfg.Bundle{
+		Schema:  declcfg.SchemaBundle,
+		Name:    name,
+		Package: testPackage,
+		Image:   "quay.io/example/" + name,
+		Properties: []property.Property{
+			{Type: property.TypePackage, Value: value},
+		},
+	}
+}
+
+func newCatalog(entries []declcfg.ChannelEntry, bundles ...declcfg.Bundle) (*declcfg.DeclarativeConfig, *declcfg.Channel) {
+	ch := declcfg.Channel{
+		Schema:  declcfg.SchemaChannel,
+		Name:    "stable",
+		Package: testPackage,
+		Entries: entries,
+	}
+
+	cfg := &declcfg.DeclarativeConfig{
+		Packages: []declcfg.Package{{Schema: declcfg.SchemaPackage, Name: testPackage, DefaultChannel: "stable"}},
+		Channels: []declcfg.Channel{ch},
+		Bundles:  bundles,
+	}
+
+	return cfg, &cfg.Channels[0]
+}
+
+func TestChannelHead(t *testing.T) {
+	t.Run("resolves head from replaces regardless of entry order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog([]declcfg.ChannelEntry{
+			{Name: "op.v1.0.0"},
+			{Name: "op.v1.2.0", Replaces: "op.v1.1.0"},
+			{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+		})
+
+		head, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(head).To(Equal("op.v1.2.0"))
+	})
+
+	t.Run("considers skips", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog([]declcfg.ChannelEntry{
+			{Name: "op.v1.0.0"},
+			{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+			{Name: "op.v1.2.0", Replaces: "op.v1.0.0", Skips: []string{"op.v1.1.0"}},
+		})
+
+		head, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(head).To(Equal("op.v1.2.0"))
+	})
+
+	t.Run("considers skipRange using bundle versions", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog(
+			[]declcfg.ChannelEntry{
+				{Name: "op.v1.0.0"},
+				{Name: "op.v1.1.0"},
+				{Name: "op.v2.0.0", SkipRange: ">=1.0.0 <2.0.0"},
+			},
+			newBundle("op.v1.0.0", "1.0.0"),
+			newBundle("op.v1.1.0", "1.1.0"),
+			newBundle("op.v2.0.0", "2.0.0"),
+		)
+
+		head, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(head).To(Equal("op.v2.0.0"))
+	})
+
+	t.Run("ignores replaces pointing outside the channel", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog([]declcfg.ChannelEntry{
+			{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+		})
+
+		head, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(head).To(Equal("op.v1.1.0"))
+	})
+
+	t.Run("returns error for multiple heads", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog([]declcfg.ChannelEntry{
+			{Name: "op.v1.0.0"},
+			{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+			{Name: "op.v1.2.0", Replaces: "op.v1.0.0"},
+		})
+
+		_, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).To(MatchError(catalog.ErrMultipleHeads))
+		g.Expect(err.Error()).To(ContainSubstring("op.v1.1.0, op.v1.2.0"))
+	})
+
+	t.Run("returns error for cycles", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog([]declcfg.ChannelEntry{
+			{Name: "op.v1.0.0", Replaces: "op.v1.1.0"},
+			{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+		})
+
+		_, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).To(MatchError(catalog.ErrCycle))
+	})
+
+	t.Run("returns error for empty channel", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, ch := newCatalog(nil)
+
+		_, err := catalog.ChannelHead(cfg, ch)
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("has no entries"))
+	})
+}
@@ -0,0 +1,165 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
+)
+
+// PackageInfo summarizes a package available in a catalog.
+type PackageInfo struct {
+	Name           string   `json:"name"`
+	DefaultChannel string   `json:"defaultChannel,omitempty"`
+	Channels       []string `json:"channels"`
+}
+
+// ChannelInfo summarizes a channel of a package.
+// Head is empty and HeadError is set when the channel head cannot be determined.
+type ChannelInfo struct {
+	Name      string `json:"name"`
+	Default   bool   `json:"default"`
+	Head      string `json:"head,omitempty"`
+	HeadError string `json:"headError,omitempty"`
+	Entries   int    `json:"entries"`
+}
+
+// BundleInfo summarizes a bundle entry of a channel.
+type BundleInfo struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Image     string   `json:"image,omitempty"`
+	Head      bool     `json:"head"`
+	Replaces  string   `json:"replaces,omitempty"`
+	Skips     []string `json:"skips,omitempty"`
+	SkipRange string   `json:"skipRange,omitempty"`
+}
+
+// ListPackages returns all packages in the catalog, sorted by name.
+func ListPackages(cfg *declcfg.DeclarativeConfig) []PackageInfo {
+	packages := slices.Map(cfg.Packages, func(p declcfg.Package) PackageInfo {
+		channels := make([]string, 0)
+		for _, ch := range cfg.Channels {
+			if ch.Package == p.Name {
+				channels = append(channels, ch.Name)
+			}
+		}
+
+		sort.Strings(channels)
+
+		return PackageInfo{
+			Name:           p.Name,
+			DefaultChannel: p.DefaultChannel,
+			Channels:       channels,
+		}
+	})
+
+	sort.Slice(packages, func(i int, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+
+	return packages
+}
+
+// ListChannels returns all channels of a package, sorted by name.
+// Channels whose head cannot be resolved are still listed, with HeadError describing why.
+func ListChannels(cfg *declcfg.DeclarativeConfig, packageName string) ([]ChannelInfo, error) {
+	pkg, err := findPackage(cfg, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]ChannelInfo, 0)
+
+	for i := range cfg.Channels {
+		ch := &cfg.Channels[i]
+		if ch.Package != packageName {
+			continue
+		}
+
+		info := ChannelInfo{
+			Name:    ch.Name,
+			Default: ch.Name == pkg.DefaultChannel,
+			Entries: len(ch.Entries),
+		}
+
+		head, err := ChannelHead(cfg, ch)
+		if err != nil {
+			info.HeadError = err.Error()
+		} else {
+			info.Head = head
+		}
+
+		channels = append(channels, info)
+	}
+
+	sort.Slice(channels, func(i int, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+
+	return channels, nil
+}
+
+// ListBundles returns all bundle entries of a channel, sorted by version (highest first).
+// channelName defaults to the package's defaultChannel when empty.
+func ListBundles(cfg *declcfg.DeclarativeConfig, packageName string, channelName string) ([]BundleInfo, error) {
+	pkg, err := findPackage(cfg, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if channelName == "" {
+		if pkg.DefaultChannel == "" {
+			return nil, fmt.Errorf("package %q has no defaultChannel and --channel was not specified", packageName)
+		}
+		channelName = pkg.DefaultChannel
+	}
+
+	channel, err := findChannel(cfg, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := bundleVersions(cfg, packageName)
+
+	// An unresolvable head is not fatal for listing purposes.
+	head, _ := ChannelHead(cfg, channel)
+
+	bundles := slices.Map(channel.Entries, func(e declcfg.ChannelEntry) BundleInfo {
+		info := BundleInfo{
+			Name:      e.Name,
+			Head:      e.Name == head,
+			Replaces:  e.Replaces,
+			Skips:     e.Skips,
+			SkipRange: e.SkipRange,
+		}
+
+		if v, ok := versions[e.Name]; ok {
+			info.Version = v.String()
+		}
+
+		if b, err := findBundle(cfg, packageName, e.Name); err == nil {
+			info.Image = b.Image
+		}
+
+		return info
+	})
+
+	sort.SliceStable(bundles, func(i int, j int) bool {
+		vi, iok := versions[bundles[i].Name]
+		vj, jok := versions[bundles[j].Name]
+
+		switch {
+		case iok && jok:
+			return vi.GT(vj)
+		case iok != jok:
+			return iok
+		default:
+			return bundles[i].Name < bundles[j].Name
+		}
+	})
+
+	return bundles, nil
+}
@@ -0,0 +1,82 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestListPackages(t *testing.T) {
+	t.Run("lists packages with their channels", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := newVersionedCatalog()
+		cfg.Packages = append(cfg.Packages, declcfg.Package{Schema: declcfg.SchemaPackage, Name: "another-operator"})
+
+		packages := catalog.ListPackages(cfg)
+
+		g.Expect(packages).To(HaveLen(2))
+		g.Expect(packages[0].Name).To(Equal("another-operator"))
+		g.Expect(packages[0].Channels).To(BeEmpty())
+		g.Expect(packages[1].Name).To(Equal(testPackage))
+		g.Expect(packages[1].DefaultChannel).To(Equal("stable"))
+		g.Expect(packages[1].Channels).To(Equal([]string{"stable"}))
+	})
+}
+
+func TestListChannels(t *testing.T) {
+	t.Run("lists channels with heads and default flag", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg := newVersionedCatalog()
+		cfg.Channels = append(cfg.Channels, declcfg.Channel{
+			Schema:  declcfg.SchemaChannel,
+			Name:    "broken",
+			Package: testPackage,
+			Entries: []declcfg.ChannelEntry{{Name: "op.v1.2.0"}, {Name: "op.v1.3.0"}},
+		})
+
+		channels, err := catalog.ListChannels(cfg, testPackage)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(channels).To(HaveLen(2))
+		g.Expect(channels[0].Name).To(Equal("broken"))
+		g.Expect(channels[0].Default).To(BeFalse())
+		g.Expect(channels[0].Head).To(BeEmpty())
+		g.Expect(channels[0].HeadError).To(ContainSubstring("multiple channel heads"))
+		g.Expect(channels[1].Name).To(Equal("stable"))
+		g.Expect(channels[1].Default).To(BeTrue())
+		g.Expect(channels[1].Head).To(Equal("op.v1.3.0"))
+		g.Expect(channels[1].Entries).To(Equal(6))
+	})
+
+	t.Run("returns error for unknown package", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := catalog.ListChannels(newVersionedCatalog(), "missing")
+
+		g.Expect(err).To(MatchError(ContainSubstring(`package "missing" not found`)))
+	})
+}
+
+func TestListBundles(t *testing.T) {
+	t.Run("lists bundles sorted by version with images", func(t *testing.T) {
+		g := NewWithT(t)
+
+		bundles, err := catalog.ListBundles(newVersionedCatalog(), testPackage, "")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(bundles).To(HaveLen(6))
+		g.Expect(bundles[0].Name).To(Equal("op.v1.3.0"))
+		g.Expect(bundles[0].Version).To(Equal("1.3.0"))
+		g.Expect(bundles[0].Image).To(Equal("quay.io/example/op.v1.3.0"))
+		g.Expect(bundles[0].Head).To(BeTrue())
+		g.Expect(bundles[0].Replaces).To(Equal("op.v1.2.3"))
+		g.Expect(bundles[5].Name).To(Equal("op.v0.55.0"))
+		g.Expect(bundles[5].Head).To(BeFalse())
+	})
+}
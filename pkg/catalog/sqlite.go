@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/pkg/sqlite"
+
+	// Pure Go SQLite driver, so that SQLite indexes can be read from statically linked binaries.
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// sqliteHeader is the magic string every SQLite database file starts with.
+	sqliteHeader = "SQLite format 3\x00"
+
+	// sqliteIndexPath is the conventional location of the database in legacy SQLite index images.
+	sqliteIndexPath = "database/index.db"
+
+	// sqliteDriverName is the database/sql driver name registered by modernc.org/sqlite.
+	sqliteDriverName = "sqlite"
+
+	// sqliteForeignKeys enables foreign keys on every pooled connection, as the migrations
+	// and queries may run on any of them.
+	sqliteForeignKeys = "?_pragma=foreign_keys(1)"
+)
+
+// isSQLiteIndex returns true if the file system contains a legacy SQLite index database.
+func isSQLiteIndex(fsys fs.FS) bool {
+	info, err := fs.Stat(fsys, sqliteIndexPath)
+
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isSQLiteFile returns true if the named file is a SQLite database.
+func isSQLiteFile(fsys fs.FS, name string) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+
+	return string(header) == sqliteHeader
+}
+
+// loadSQLiteCatalogCopy loads the named SQLite index database from a copy in tempDir, leaving the
+// original file untouched. SQLite needs a file on disk, so this also serves indexes held in memory.
+func loadSQLiteCatalogCopy(ctx context.Context, fsys fs.FS, name string, tempDir string) (*declcfg.DeclarativeConfig, error) {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite index %s: %w", name, err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dst, err := os.CreateTemp(tempDir, "index-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary SQLite index: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy SQLite index: %w", err)
+	}
+
+	return loadSQLiteCatalog(ctx, dst.Name())
+}
+
+// loadSQLiteCatalog loads a legacy SQLite index database and converts it to a declarative config,
+// so that package, channel and version resolution behaves the same as for file-based catalogs.
+// The database is migrated to the latest schema in place, so it must be a disposable copy.
+func loadSQLiteCatalog(ctx context.Context, dbPath string) (*declcfg.DeclarativeConfig, error) {
+	// Foreign keys are required for the migrations to keep the schema consistent.
+	db, err := sql.Open(sqliteDriverName, dbPath+sqliteForeignKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite index %s: %w", dbPath, err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	migrator, err := sqlite.NewSQLLiteMigrator(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SQLite index migrator: %w", err)
+	}
+
+	if err := migrator.Migrate(ctx); err != nil {
+		return nil, fmt.Errorf("failed to migrate SQLite index: %w", err)
+	}
+
+	m, err := sqlite.ToModel(ctx, sqlite.NewSQLLiteQuerierFromDb(db))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SQLite index: %w", err)
+	}
+
+	cfg := declcfg.ConvertFromModel(m)
+
+	return &cfg, nil
+}
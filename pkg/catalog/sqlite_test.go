@@ -0,0 +1,143 @@
+package catalog_test
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/pkg/sqlite"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+
+	// Same pure Go driver as the catalog package, so the fixture is built without CGO.
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqlitePackage = "sqlite-op"
+
+	// sqliteDriverName is the database/sql driver name registered by modernc.org/sqlite.
+	sqliteDriverName = "sqlite"
+)
+
+// sqliteManifests is a package manifest layout with two versions in the stable channel.
+var sqliteManifests = map[string]string{
+	"package.yaml": `
+packageName: sqlite-op
+defaultChannel: stable
+channels:
+  - name: stable
+    currentCSV: sqlite-op.v1.1.0
+`,
+	"1.0.0/sqlite-op.clusterserviceversion.yaml": `
+apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: sqlite-op.v1.0.0
+spec:
+  version: 1.0.0
+  install:
+    strategy: deployment
+    spec:
+      deployments: []
+`,
+	"1.1.0/sqlite-op.clusterserviceversion.yaml": `
+apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: sqlite-op.v1.1.0
+spec:
+  version: 1.1.0
+  replaces: sqlite-op.v1.0.0
+  install:
+    strategy: deployment
+    spec:
+      deployments: []
+`,
+}
+
+// writeSQLiteIndex builds a legacy SQLite index at path with the operator-registry loader, over
+// the pure Go driver rather than sqlite.Open, which requires CGO.
+func writeSQLiteIndex(t *testing.T, path string) {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	manifests := t.TempDir()
+	for name, content := range sqliteManifests {
+		g.Expect(os.MkdirAll(filepath.Join(manifests, filepath.Dir(name)), 0750)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(manifests, name), []byte(content), 0600)).To(Succeed())
+	}
+
+	g.Expect(os.MkdirAll(filepath.Dir(path), 0750)).To(Succeed())
+
+	db, err := sql.Open(sqliteDriverName, path+"?_pragma=foreign_keys(1)")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	loader, err := sqlite.NewSQLLiteLoader(db)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loader.Migrate(t.Context())).To(Succeed())
+	g.Expect(sqlite.NewSQLLoaderForDirectory(loader, manifests).Populate()).To(Succeed())
+}
+
+// fileHash returns the SHA-256 of the file at path.
+func fileHash(t *testing.T, path string) [sha256.Size]byte {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	data, err := os.ReadFile(path)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return sha256.Sum256(data)
+}
+
+func TestLoadSQLite(t *testing.T) {
+	t.Run("loads index database of an extracted index image", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "database", "index.db")
+		writeSQLiteIndex(t, dbPath)
+		before := fileHash(t, dbPath)
+
+		cfg, err := catalog.Load(t.Context(), dir, bundle.RegistryConfig{}, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Packages).To(HaveLen(1))
+		g.Expect(cfg.Bundles).To(HaveLen(2))
+
+		head, err := catalog.Resolve(cfg, sqlitePackage, "", "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(head.Name).To(Equal("sqlite-op.v1.1.0"))
+
+		pinned, err := catalog.Resolve(cfg, sqlitePackage, "stable", "<1.1.0")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(pinned.Name).To(Equal("sqlite-op.v1.0.0"))
+
+		// The migration runs on a copy, so the user's database is left untouched
+		g.Expect(fileHash(t, dbPath)).To(Equal(before))
+	})
+
+	t.Run("loads single index database file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dbPath := filepath.Join(t.TempDir(), "index.db")
+		writeSQLiteIndex(t, dbPath)
+
+		cfg, err := catalog.Load(t.Context(), dbPath, bundle.RegistryConfig{}, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		channels, err := catalog.ListChannels(cfg, sqlitePackage)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(channels).To(HaveLen(1))
+	})
+}
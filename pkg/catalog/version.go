@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	mmsemver "github.com/Masterminds/semver/v3"
+	"github.com/blang/semver/v4"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
+)
+
+// findBundleByVersion finds the bundle in a channel matching a version reference.
+//
+// The reference is matched in the following order:
+//  1. An exact bundle name (e.g. "prometheusoperator.0.56.0"), for backward compatibility.
+//  2. A semver constraint evaluated against the olm.package version of each bundle
+//     (e.g. "1.2.3", "~1.2", ">=0.56 <0.60").
+//
+// When a constraint matches multiple bundles, the highest version that is reachable from the
+// channel head is selected, so bundles that are not part of the upgrade graph are never picked.
+//
+// Bundle versions are parsed once with blang/semver, the library OLM uses for skipRange and
+// olm.package.required ranges, so that the upgrade graph and dependencies follow OLM exactly.
+// Constraints are evaluated with Masterminds/semver instead, as it supports the ~, ^, wildcard
+// and comma-separated forms users expect from other tools. Versions are converted field by
+// field rather than re-parsed, so both libraries always compare the same version.
+func findBundleByVersion(cfg *declcfg.DeclarativeConfig, channel *declcfg.Channel, ref string) (string, error) {
+	for _, entry := range channel.Entries {
+		if entry.Name == ref {
+			return entry.Name, nil
+		}
+	}
+
+	constraint, err := mmsemver.NewConstraint(ref)
+	if err != nil {
+		return "", fmt.Errorf("version %q is neither a bundle name nor a valid semver constraint: %w", ref, err)
+	}
+
+	graph, err := newChannelGraph(channel, bundleVersions(cfg, channel.Package))
+	if err != nil {
+		return "", err
+	}
+
+	head, err := graph.head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve channel head: %w", err)
+	}
+
+	reachable := graph.reachable(head)
+
+	var (
+		bestName    string
+		bestVersion *mmsemver.Version
+	)
+
+	available := make(mmsemver.Collection, 0, len(reachable))
+
+	for _, entry := range channel.Entries {
+		if !reachable[entry.Name] {
+			continue
+		}
+
+		v, ok := graph.versions[entry.Name]
+		if !ok {
+			continue
+		}
+
+		version := constraintVersion(v)
+		available = append(available, version)
+
+		if !constraint.Check(version) {
+			continue
+		}
+
+		if bestVersion == nil || version.GreaterThan(bestVersion) {
+			bestName = entry.Name
+			bestVersion = version
+		}
+	}
+
+	if bestVersion == nil {
+		sort.Sort(available)
+
+		return "", fmt.Errorf(
+			"no version matching %q found for package %q in channel %q (available versions: [%s])",
+			ref,
+			channel.Package,
+			channel.Name,
+			strings.Join(slices.Map(available, (*mmsemver.Version).String), ", "),
+		)
+	}
+
+	return bestName, nil
+}
+
+// constraintVersion converts a bundle version to the representation used for constraint matching.
+func constraintVersion(v semver.Version) *mmsemver.Version {
+	pre := slices.Map(v.Pre, semver.PRVersion.String)
+
+	return mmsemver.New(v.Major, v.Minor, v.Patch, strings.Join(pre, "."), strings.Join(v.Build, "."))
+}
@@ -0,0 +1,145 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+
+	. "github.com/onsi/gomega"
+)
+
+func newVersionedCatalog() *declcfg.DeclarativeConfig {
+	cfg, _ := newCatalog(
+		[]declcfg.ChannelEntry{
+			{Name: "op.v0.55.0"},
+			{Name: "op.v0.56.0", Replaces: "op.v0.55.0"},
+			{Name: "op.v0.59.1", Replaces: "op.v0.56.0"},
+			{Name: "op.v1.2.0", Replaces: "op.v0.59.1"},
+			{Name: "op.v1.2.3", Replaces: "op.v1.2.0"},
+			{Name: "op.v1.3.0", Replaces: "op.v1.2.3"},
+		},
+		newBundle("op.v0.55.0", "0.55.0"),
+		newBundle("op.v0.56.0", "0.56.0"),
+		newBundle("op.v0.59.1", "0.59.1"),
+		newBundle("op.v1.2.0", "1.2.0"),
+		newBundle("op.v1.2.3", "1.2.3"),
+		newBundle("op.v1.3.0", "1.3.0"),
+	)
+
+	return cfg
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("resolves channel head when no version is given", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", "")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.3.0"))
+		g.Expect(b.Image).To(Equal("quay.io/example/op.v1.3.0"))
+	})
+
+	t.Run("resolves exact bundle name", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := catalog.Resolve(newVersionedCatalog(), testPackage, "stable", "op.v0.56.0")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v0.56.0"))
+	})
+
+	t.Run("resolves exact version", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", "1.2.3")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.2.3"))
+	})
+
+	t.Run("resolves highest version in range", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", ">=0.56 <0.60")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v0.59.1"))
+	})
+
+	t.Run("resolves tilde constraint", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", "~1.2")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.2.3"))
+	})
+
+	t.Run("matches prerelease versions with build metadata", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, _ := newCatalog(
+			[]declcfg.ChannelEntry{
+				{Name: "op.v1.0.0"},
+				{Name: "op.v1.1.0-rc.1", Replaces: "op.v1.0.0"},
+			},
+			newBundle("op.v1.0.0", "1.0.0"),
+			newBundle("op.v1.1.0-rc.1", "1.1.0-rc.1+build.7"),
+		)
+
+		b, err := catalog.Resolve(cfg, testPackage, "", ">=1.1.0-rc.0")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.1.0-rc.1"))
+	})
+
+	t.Run("ignores bundles that are not part of the channel", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, _ := newCatalog(
+			[]declcfg.ChannelEntry{
+				{Name: "op.v1.0.0"},
+				{Name: "op.v1.1.0", Replaces: "op.v1.0.0"},
+				{Name: "op.v2.0.0", Replaces: "op.v1.1.0"},
+			},
+			newBundle("op.v1.0.0", "1.0.0"),
+			newBundle("op.v1.1.0", "1.1.0"),
+			newBundle("op.v2.0.0", "2.0.0"),
+			newBundle("op.v1.5.0", "1.5.0"),
+		)
+
+		b, err := catalog.Resolve(cfg, testPackage, "", "^1")
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("op.v1.1.0"))
+	})
+
+	t.Run("returns error with available versions when nothing matches", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", ">=2.0")
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("0.55.0, 0.56.0, 0.59.1, 1.2.0, 1.2.3, 1.3.0"))
+	})
+
+	t.Run("returns error for invalid constraint", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := catalog.Resolve(newVersionedCatalog(), testPackage, "", "not-a-version")
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("neither a bundle name nor a valid semver constraint"))
+	})
+
+	t.Run("returns error for unknown channel", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := catalog.Resolve(newVersionedCatalog(), testPackage, "fast", "")
+
+		g.Expect(err).To(MatchError(ContainSubstring(`channel "fast" not found`)))
+	})
+}
@@ -1,11 +1,12 @@
-// Package certmanager configures cert-manager CA injection for operator admission webhooks.
+// Package certmanager configures cert-manager CA injection for operator admission webhooks
+// and aggregated APIs.
 //
 // When extracting OLM bundles that include admission webhooks (ValidatingWebhookConfiguration,
-// MutatingWebhookConfiguration), this package automatically:
+// MutatingWebhookConfiguration) or APIServices, this package automatically:
 //  1. Discovers the webhook certificate secret names from deployment volumes
 //  2. Creates cert-manager Certificate resources with the correct secret names
-//  3. Adds cert-manager.io/inject-ca-from annotations to webhook configurations
-//  4. Ensures backing services exist for webhooks
+//  3. Adds cert-manager.io/inject-ca-from annotations to webhook configurations and APIServices
+//  4. Ensures backing services exist for webhooks and APIServices
 //
 // Key Concepts:
 //
@@ -71,12 +72,13 @@ type Config struct {
 // Configure analyzes filtered resources and configures cert-manager CA injection for webhooks.
 //
 // This is the main entry point for cert-manager integration. It processes webhook configurations
-// and generates the necessary cert-manager resources and service objects.
+// and APIServices, and generates the necessary cert-manager resources and service objects.
 //
 // Processing Flow:
 //  1. Find all webhook configurations (ValidatingWebhookConfiguration, MutatingWebhookConfiguration)
+//     and APIServices
 //  2. Determine issuer configuration (auto-generate or use explicit)
-//  3. For each webhook, extract the service name from clientConfig.service
+//  3. For each webhook, extract the service name from clientConfig.service (spec.service for APIServices)
 //  4. Derive the deployment name from the service name (remove "-service" suffix)
 //  5. Extract the actual webhook secret name from the deployment's volumes
 //  6. Create a cert-manager Certificate resource with the discovered secret name
@@ -94,7 +96,7 @@ type Config struct {
 // Returns a new slice of objects with webhooks configured, certificates created, and
 // services ensured. Non-webhook objects are included unchanged at the end.
 func Configure(objects []*unstructured.Unstructured, namespace string, cfg Config) ([]*unstructured.Unstructured, error) {
-	webhooks := kube.Find(objects, kube.IsWebhookConfiguration)
+	webhooks := kube.Find(objects, needsCAInjection)
 	if len(webhooks) == 0 {
 		return objects, nil
 	}
@@ -131,7 +133,7 @@ func Configure(objects []*unstructured.Unstructured, namespace string, cfg Confi
 	// Add remaining non-webhook objects (excluding processed services)
 	remainingObjects := kube.Find(objects, func(obj *unstructured.Unstructured) bool {
 		switch {
-		case kube.IsWebhookConfiguration(obj):
+		case needsCAInjection(obj):
 			return false
 		case kube.IsKind(obj, gvks.Service) && processedServiceNames.Has(obj.GetName()):
 			return false
@@ -143,6 +145,22 @@ func Configure(objects []*unstructured.Unstructured, namespace string, cfg Confi
 	return append(webhookObjects, remainingObjects...), nil
 }
 
+// needsCAInjection reports whether an object is a webhook configuration or an APIService,
+// which the API server calls with the CA bundle injected by cert-manager.
+func needsCAInjection(obj *unstructured.Unstructured) bool {
+	return kube.IsWebhookConfiguration(obj) || kube.IsKind(obj, gvks.APIService)
+}
+
+// serviceInfo extracts the service called by a webhook configuration or an APIService.
+// Returns nil if the object doesn't reference a service.
+func serviceInfo(obj *unstructured.Unstructured) *kube.WebhookInfo {
+	if kube.IsKind(obj, gvks.APIService) {
+		return kube.ExtractAPIServiceInfo(obj)
+	}
+
+	return kube.ExtractWebhookServiceInfo(obj)
+}
+
 // extractOperatorName determines the operator/bundle name from the objects.
 // Uses the same logic as resource normalization:
 //  1. First deployment name found
@@ -228,7 +246,7 @@ func processWebhooks(
 	processedServices := sets.New[string]()
 
 	for _, obj := range webhooks {
-		info := kube.ExtractWebhookServiceInfo(obj)
+		info := serviceInfo(obj)
 		if info == nil {
 			result = append(result, obj)
 
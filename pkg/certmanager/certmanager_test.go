@@ -3,9 +3,13 @@ package certmanager_test
 import (
 	"testing"
 
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/lburgazzoli/olm-extractor/pkg/certmanager"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
 	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
 
 	. "github.com/onsi/gomega"
@@ -930,3 +934,51 @@ func TestExtractOperatorName_DefaultFallback(t *testing.T) {
 	g.Expect(foundIssuer).ToNot(BeNil())
 	g.Expect(foundIssuer.GetName()).To(Equal("operator-selfsigned"))
 }
+
+func TestConfigure_APIService(t *testing.T) {
+	g := NewWithT(t)
+
+	desc := v1alpha1.APIServiceDescription{
+		Group:          "metrics.example.com",
+		Version:        "v1beta1",
+		DeploymentName: "metrics-server",
+	}
+
+	dep := kube.CreateDeployment(v1alpha1.StrategyDeploymentSpec{Name: "metrics-server"}, "operators")
+	dep.Spec.Template.Spec.Containers = []corev1.Container{{Name: "server"}}
+	kube.AddAPIServiceCertVolumes(dep, "metrics-server-service-cert")
+
+	deployment, err := kube.ToUnstructured(dep)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	service, err := kube.CreateAPIServiceService("metrics-server", "operators", kube.APIServicePort(desc), nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects := []*unstructured.Unstructured{deployment, service, kube.CreateAPIService(desc, "operators")}
+
+	result, err := certmanager.Configure(objects, "operators", certmanager.Config{Enabled: true})
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(HaveLen(5)) // issuer + certificate + apiservice + service + deployment
+
+	var foundCert, foundAPIService *unstructured.Unstructured
+	for _, obj := range result {
+		switch obj.GetKind() {
+		case gvks.Certificate.Kind:
+			foundCert = obj
+		case gvks.APIService.Kind:
+			foundAPIService = obj
+		}
+	}
+
+	g.Expect(foundCert).ToNot(BeNil())
+	g.Expect(foundCert.GetName()).To(Equal("metrics-server-service-cert"))
+
+	secretName, _, _ := unstructured.NestedString(foundCert.Object, "spec", "secretName")
+	g.Expect(secretName).To(Equal("metrics-server-service-cert"))
+
+	g.Expect(foundAPIService).ToNot(BeNil())
+	g.Expect(foundAPIService.GetAnnotations()).To(HaveKeyWithValue(
+		"cert-manager.io/inject-ca-from", "operators/metrics-server-service-cert",
+	))
+}
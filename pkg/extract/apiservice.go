@@ -0,0 +1,145 @@
+package extract
+
+import (
+	"fmt"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+)
+
+const (
+	// kubeSystemNamespace holds the extension-apiserver-authentication-reader Role.
+	kubeSystemNamespace = "kube-system"
+
+	// authReaderRole lets aggregated API servers read the client CA of the Kubernetes API server.
+	authReaderRole = "extension-apiserver-authentication-reader"
+
+	// authDelegatorClusterRole lets aggregated API servers delegate authentication and authorization.
+	authDelegatorClusterRole = "system:auth-delegator"
+
+	// defaultServiceAccountName is used by deployments that do not set a ServiceAccount.
+	defaultServiceAccountName = "default"
+)
+
+// APIServices creates the APIServices registering the aggregated APIs owned by the CSV.
+// Each deployment serving APIServices gets a backing Service and, as OLM grants them, bindings
+// of its ServiceAccount to the system:auth-delegator ClusterRole and to the
+// extension-apiserver-authentication-reader Role of kube-system.
+// CA bundles are left empty - users must inject certificates (e.g., via cert-manager).
+func APIServices(csv *v1alpha1.ClusterServiceVersion, namespace string) ([]runtime.Object, error) {
+	descs := csv.Spec.APIServiceDefinitions.Owned
+	if len(descs) == 0 {
+		return nil, nil
+	}
+
+	// Track deployments to create their Service and bindings only once.
+	seen := sets.New[string]()
+	objects := make([]runtime.Object, 0, len(descs))
+
+	for _, desc := range descs {
+		objects = append(objects, kube.CreateAPIService(desc, namespace))
+
+		if seen.Has(desc.DeploymentName) {
+			continue
+		}
+		seen.Insert(desc.DeploymentName)
+
+		depSpec, found := findDeploymentSpec(csv, desc.DeploymentName)
+		if !found {
+			return nil, fmt.Errorf("deployment %s of APIService %s.%s not found in install strategy", desc.DeploymentName, desc.Version, desc.Group)
+		}
+
+		var selector map[string]string
+		if depSpec.Spec.Selector != nil {
+			selector = depSpec.Spec.Selector.MatchLabels
+		}
+
+		svc, err := kube.CreateAPIServiceService(desc.DeploymentName, namespace, kube.APIServicePort(desc), selector)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, svc)
+
+		serviceAccountName := depSpec.Spec.Template.Spec.ServiceAccountName
+		if serviceAccountName == "" {
+			serviceAccountName = defaultServiceAccountName
+		}
+
+		objects = append(objects, createAuthBindings(kube.APIServiceServiceName(desc.DeploymentName), serviceAccountName, namespace)...)
+	}
+
+	return objects, nil
+}
+
+// apiServiceDeployments returns the names of the deployments serving APIServices owned by the CSV.
+func apiServiceDeployments(csv *v1alpha1.ClusterServiceVersion) sets.Set[string] {
+	deployments := sets.New[string]()
+	for _, desc := range csv.Spec.APIServiceDefinitions.Owned {
+		deployments.Insert(desc.DeploymentName)
+	}
+
+	return deployments
+}
+
+// findDeploymentSpec finds a deployment of the CSV install strategy by name.
+func findDeploymentSpec(csv *v1alpha1.ClusterServiceVersion, name string) (v1alpha1.StrategyDeploymentSpec, bool) {
+	for _, depSpec := range csv.Spec.InstallStrategy.StrategySpec.DeploymentSpecs {
+		if depSpec.Name == name {
+			return depSpec, true
+		}
+	}
+
+	return v1alpha1.StrategyDeploymentSpec{}, false
+}
+
+// createAuthBindings creates the bindings letting the ServiceAccount of an aggregated API server
+// delegate authentication and authorization to the Kubernetes API server, named as OLM names them.
+func createAuthBindings(serviceName string, serviceAccountName string, namespace string) []runtime.Object {
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      serviceAccountName,
+		Namespace: namespace,
+	}}
+
+	delegator := &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gvks.ClusterRoleBinding.GroupVersion().String(),
+			Kind:       gvks.ClusterRoleBinding.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: serviceName + "-" + authDelegatorClusterRole,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     gvks.ClusterRole.Kind,
+			Name:     authDelegatorClusterRole,
+		},
+		Subjects: subjects,
+	}
+
+	reader := &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gvks.RoleBinding.GroupVersion().String(),
+			Kind:       gvks.RoleBinding.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName + "-auth-reader",
+			Namespace: kubeSystemNamespace,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     gvks.Role.Kind,
+			Name:     authReaderRole,
+		},
+		Subjects: subjects,
+	}
+
+	return []runtime.Object{delegator, reader}
+}
@@ -3,6 +3,7 @@ package extract
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 
 	"github.com/operator-framework/api/pkg/manifests"
@@ -13,25 +14,40 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/lburgazzoli/olm-extractor/pkg/certmanager"
 	"github.com/lburgazzoli/olm-extractor/pkg/filter"
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
 	"github.com/lburgazzoli/olm-extractor/pkg/kube"
 	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+	"github.com/lburgazzoli/olm-extractor/pkg/overrides"
 )
 
 // Manifests extracts all Kubernetes manifests from an OLM bundle for the given namespace.
+// watchNamespaces are the namespaces the operator watches, as resolved by ResolveOperatorGroup,
+// and deploymentConfig, if any, overrides the operator deployments.
 // Returns objects sorted by type priority for proper kubectl apply order.
-func Manifests(bundle *manifests.Bundle, namespace string) ([]runtime.Object, error) {
+func Manifests(
+	bundle *manifests.Bundle,
+	namespace string,
+	watchNamespaces []string,
+	deploymentConfig *overrides.Config,
+) ([]runtime.Object, error) {
 	if bundle.CSV == nil {
 		return nil, errors.New("bundle does not contain a ClusterServiceVersion")
 	}
 
+	og, err := ResolveOperatorGroup(bundle.CSV, namespace, watchNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
 	// Phase 1: Collect all resources
-	objects, err := collectResources(bundle, bundle.CSV, namespace)
+	objects, err := collectResources(bundle, bundle.CSV, namespace, og, deploymentConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +67,8 @@ func collectResources(
 	bundle *manifests.Bundle,
 	csv *v1alpha1.ClusterServiceVersion,
 	namespace string,
+	og OperatorGroup,
+	deploymentConfig *overrides.Config,
 ) ([]runtime.Object, error) {
 	objects := make([]runtime.Object, 0)
 
@@ -64,7 +82,7 @@ func collectResources(
 	objects = append(objects, crds...)
 
 	// RBAC and Deployments from CSV InstallStrategy
-	installObjects, err := InstallStrategy(csv, namespace)
+	installObjects, err := InstallStrategy(csv, namespace, og, deploymentConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert install strategy: %w", err)
 	}
@@ -78,6 +96,13 @@ func collectResources(
 	webhooks := Webhooks(csv, namespace)
 	objects = append(objects, webhooks...)
 
+	// APIServices with their Services and authentication delegation bindings
+	apiServices, err := APIServices(csv, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract api services: %w", err)
+	}
+	objects = append(objects, apiServices...)
+
 	// Other resources from bundle
 	otherObjects, err := OtherResources(bundle, namespace)
 	if err != nil {
@@ -103,11 +128,44 @@ func postProcessResources(objects []runtime.Object) ([]runtime.Object, error) {
 	return sortedObjects, nil
 }
 
+// Merge combines the manifests extracted from multiple bundles into a single stream.
+// Namespaces and CRDs shared by several bundles are emitted only once (the first occurrence wins),
+// and the result is sorted by type priority for proper kubectl apply order.
+func Merge(objectSets ...[]runtime.Object) []runtime.Object {
+	seen := make(map[string]bool)
+	merged := make([]runtime.Object, 0)
+
+	for _, objects := range objectSets {
+		for _, obj := range objects {
+			gvk := obj.GetObjectKind().GroupVersionKind()
+
+			switch gvk {
+			case gvks.Namespace, gvks.CustomResourceDefinition, gvks.CustomResourceDefinitionV1Beta1:
+				accessor, err := meta.Accessor(obj)
+				if err != nil {
+					break
+				}
+
+				key := gvk.GroupKind().String() + "/" + accessor.GetName()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+
+			merged = append(merged, obj)
+		}
+	}
+
+	return sortKubernetesResources(merged)
+}
+
 // ApplyTransformations applies a series of transformations to extracted manifests.
 // Transformations include:
 //  1. jq-based filtering (include/exclude expressions)
-//  2. cert-manager configuration for webhooks
-//  3. Sorting for kubectl apply order
+//  2. Image rewriting to mirrors
+//  3. cert-manager configuration for webhooks
+//  4. Sorting for kubectl apply order
 //
 // This provides a complete post-extraction processing pipeline.
 func ApplyTransformations(
@@ -115,6 +173,7 @@ func ApplyTransformations(
 	namespace string,
 	includeExprs []string,
 	excludeExprs []string,
+	imageMapCfg imagemap.Config,
 	certManagerCfg certmanager.Config,
 ) ([]*unstructured.Unstructured, error) {
 	var err error
@@ -127,6 +186,11 @@ func ApplyTransformations(
 		}
 	}
 
+	// Rewrite images to mirrors
+	if err := imagemap.Rewrite(objects, imageMapCfg); err != nil {
+		return nil, fmt.Errorf("failed to rewrite images: %w", err)
+	}
+
 	// Configure cert-manager
 	if certManagerCfg.Enabled {
 		objects, err = certmanager.Configure(objects, namespace, certManagerCfg)
@@ -258,8 +322,16 @@ func createConversionConfig(
 }
 
 // InstallStrategy converts a CSV install strategy to Kubernetes resources.
-// Returns ServiceAccounts, Roles, RoleBindings, ClusterRoles, ClusterRoleBindings, and Deployments.
-func InstallStrategy(csv *v1alpha1.ClusterServiceVersion, namespace string) ([]runtime.Object, error) {
+// Returns ServiceAccounts, Roles, RoleBindings, ClusterRoles, ClusterRoleBindings, and Deployments,
+// with RBAC scoped and deployments annotated for the namespaces watched through og.
+// Deployments are then overridden by deploymentConfig, if any, which must not target a deployment
+// the install strategy does not define.
+func InstallStrategy(
+	csv *v1alpha1.ClusterServiceVersion,
+	namespace string,
+	og OperatorGroup,
+	deploymentConfig *overrides.Config,
+) ([]runtime.Object, error) {
 	strategy := csv.Spec.InstallStrategy
 	if strategy.StrategyName != v1alpha1.InstallStrategyNameDeployment && strategy.StrategyName != "" {
 		return nil, fmt.Errorf("unsupported install strategy: %s", strategy.StrategyName)
@@ -284,13 +356,13 @@ func InstallStrategy(csv *v1alpha1.ClusterServiceVersion, namespace string) ([]r
 			objects = append(objects, sa)
 		}
 
-		// Roles
-		for _, role := range processRoles(perms) {
+		// Roles, copied into the target namespaces or promoted to ClusterRoles
+		for _, role := range og.scopeRoles(processRoles(perms)) {
 			objects = append(objects, role)
 		}
 
-		// RoleBindings
-		for _, rb := range processRoleBindings(perms) {
+		// RoleBindings, copied into the target namespaces or promoted to ClusterRoleBindings
+		for _, rb := range og.scopeRoleBindings(processRoleBindings(perms)) {
 			objects = append(objects, rb)
 		}
 
@@ -305,10 +377,28 @@ func InstallStrategy(csv *v1alpha1.ClusterServiceVersion, namespace string) ([]r
 		}
 	}
 
-	// Add Deployments from the install strategy.
+	// Add Deployments from the install strategy, mounting the serving certificates of APIServices.
+	apiServers := apiServiceDeployments(csv)
 	spec := strategy.StrategySpec
+
+	if deploymentConfig != nil && deploymentConfig.Deployment != "" {
+		found := slices.ContainsFunc(spec.DeploymentSpecs, func(depSpec v1alpha1.StrategyDeploymentSpec) bool {
+			return depSpec.Name == deploymentConfig.Deployment
+		})
+		if !found {
+			return nil, fmt.Errorf("config deployment %q is not a deployment of %s", deploymentConfig.Deployment, csv.GetName())
+		}
+	}
+
 	for _, depSpec := range spec.DeploymentSpecs {
 		deployment := kube.CreateDeployment(depSpec, namespace)
+		og.annotateDeployment(deployment, namespace)
+		if apiServers.Has(depSpec.Name) {
+			kube.AddAPIServiceCertVolumes(deployment, kube.APIServiceSecretName(kube.APIServiceServiceName(depSpec.Name)))
+		}
+		if err := deploymentConfig.Apply(deployment); err != nil {
+			return nil, err
+		}
 		objects = append(objects, deployment)
 	}
 
@@ -587,8 +677,8 @@ func sortKubernetesResources(objects []runtime.Object) []runtime.Object {
 	sorted := make([]runtime.Object, len(objects))
 	copy(sorted, objects)
 
-	// Sort by priority (lower numbers first)
-	sort.Slice(sorted, func(i int, j int) bool {
+	// Sort by priority (lower numbers first), preserving the relative order within a priority
+	sort.SliceStable(sorted, func(i int, j int) bool {
 		return getResourcePriority(sorted[i]) < getResourcePriority(sorted[j])
 	})
 
@@ -0,0 +1,283 @@
+package extract_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/api/pkg/manifests"
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/certmanager"
+	"github.com/lburgazzoli/olm-extractor/pkg/extract"
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+	"github.com/lburgazzoli/olm-extractor/pkg/overrides"
+
+	. "github.com/onsi/gomega"
+)
+
+// newBundle returns a bundle whose CSV supports the given install modes and installs the
+// example-operator deployment, running as the example-operator service account.
+func newBundle(supported ...v1alpha1.InstallModeType) *manifests.Bundle {
+	labels := map[string]string{"app": "example-operator"}
+
+	csv := newCSV(supported...)
+	csv.Spec.RelatedImages = []v1alpha1.RelatedImage{
+		{Name: "operand", Image: "registry.example.com/operands/server:v2"},
+		{Name: "proxy", Image: "quay.io/example/proxy:v1"},
+	}
+	csv.Spec.InstallStrategy = v1alpha1.NamedInstallStrategy{
+		StrategyName: v1alpha1.InstallStrategyNameDeployment,
+		StrategySpec: v1alpha1.StrategyDetailsDeployment{
+			Permissions: []v1alpha1.StrategyDeploymentPermissions{{
+				ServiceAccountName: "example-operator",
+				Rules: []rbacv1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"configmaps"},
+					Verbs:     []string{"get", "list", "watch"},
+				}},
+			}},
+			ClusterPermissions: []v1alpha1.StrategyDeploymentPermissions{{
+				ServiceAccountName: "example-operator",
+				Rules: []rbacv1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"nodes"},
+					Verbs:     []string{"get"},
+				}},
+			}},
+			DeploymentSpecs: []v1alpha1.StrategyDeploymentSpec{{
+				Name: "example-operator",
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: corev1.PodSpec{
+							ServiceAccountName: "example-operator",
+							Containers: []corev1.Container{{
+								Name:  "manager",
+								Image: "registry.example.com/operators/manager:v1.0.0",
+							}},
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	return &manifests.Bundle{Name: csv.GetName(), CSV: csv}
+}
+
+// extractBundle extracts the manifests of b installed in the operators namespace and applies
+// the transformations configured by imageMapCfg.
+func extractBundle(
+	t *testing.T,
+	b *manifests.Bundle,
+	watchNamespaces []string,
+	imageMapCfg imagemap.Config,
+) []*unstructured.Unstructured {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	objects, err := extract.Manifests(b, "operators", watchNamespaces, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	unstructuredObjects, err := kube.ConvertToUnstructured(objects)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	unstructuredObjects, err = extract.ApplyTransformations(
+		unstructuredObjects, "operators", nil, nil, imageMapCfg, certmanager.Config{},
+	)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return unstructuredObjects
+}
+
+// findObjects returns the objects of the given kind.
+func findObjects(objects []*unstructured.Unstructured, gvk schema.GroupVersionKind) []*unstructured.Unstructured {
+	found := make([]*unstructured.Unstructured, 0)
+	for _, obj := range objects {
+		if kube.IsKind(obj, gvk) {
+			found = append(found, obj)
+		}
+	}
+
+	return found
+}
+
+func TestManifestsImageMap(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "image-map.yaml")
+	g.Expect(os.WriteFile(path, []byte(`
+apiVersion: config.openshift.io/v1
+kind: ImageTagMirrorSet
+metadata:
+  name: tags
+spec:
+  imageTagMirrors:
+    - source: registry.example.com
+      mirrors:
+        - mirror.internal/example
+`), 0o600)).To(Succeed())
+
+	b := newBundle(v1alpha1.InstallModeTypeAllNamespaces)
+
+	unmatched := make([]string, 0)
+	objects := extractBundle(t, b, nil, imagemap.Config{
+		File:          path,
+		Strict:        true,
+		RelatedImages: imagemap.RelatedImages(b.CSV),
+		OnUnmatched:   func(image string) { unmatched = append(unmatched, image) },
+	})
+
+	g.Expect(findObjects(objects, gvks.ClusterServiceVersion)).To(BeEmpty())
+
+	deployments := findObjects(objects, gvks.Deployment)
+	g.Expect(deployments).To(HaveLen(1))
+
+	deployment := &appsv1.Deployment{}
+	g.Expect(kube.FromUnstructured(deployments[0], deployment)).To(Succeed())
+	g.Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("mirror.internal/example/operators/manager:v1.0.0"))
+
+	// Related images are checked, even though the CSV is not rendered
+	g.Expect(unmatched).To(Equal([]string{"quay.io/example/proxy:v1"}))
+}
+
+func TestManifestsWatchNamespaces(t *testing.T) {
+	t.Run("defaults to the install namespace for SingleNamespace operators", func(t *testing.T) {
+		g := NewWithT(t)
+
+		objects := extractBundle(t, newBundle(v1alpha1.InstallModeTypeSingleNamespace), nil, imagemap.Config{})
+
+		deployments := findObjects(objects, gvks.Deployment)
+		g.Expect(deployments).To(HaveLen(1))
+
+		deployment := &appsv1.Deployment{}
+		g.Expect(kube.FromUnstructured(deployments[0], deployment)).To(Succeed())
+		g.Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("olm.targetNamespaces", "operators"))
+
+		roles := findObjects(objects, gvks.Role)
+		g.Expect(roles).To(HaveLen(1))
+		g.Expect(roles[0].GetNamespace()).To(Equal("operators"))
+	})
+
+	t.Run("rejects explicit watch namespaces of unsupported install modes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract.Manifests(newBundle(v1alpha1.InstallModeTypeSingleNamespace), "operators", []string{"operators"}, nil)
+		g.Expect(err).To(MatchError(ContainSubstring("cannot watch namespaces operators")))
+	})
+}
+
+func TestManifestsRBAC(t *testing.T) {
+	subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "example-operator", Namespace: "operators"}
+
+	t.Run("copies namespaced permissions into the watched namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		objects := extractBundle(t, newBundle(v1alpha1.InstallModeTypeMultiNamespace), []string{"team-b", "team-a"}, imagemap.Config{})
+
+		roles := findObjects(objects, gvks.Role)
+		g.Expect(roles).To(HaveLen(3))
+
+		for _, obj := range roles {
+			role := &rbacv1.Role{}
+			g.Expect(kube.FromUnstructured(obj, role)).To(Succeed())
+			g.Expect(role.Name).To(Equal("example-operator-role"))
+			g.Expect(role.Rules[0].Resources).To(ConsistOf("configmaps"))
+		}
+
+		bindings := findObjects(objects, gvks.RoleBinding)
+		g.Expect(bindings).To(HaveLen(3))
+
+		namespaces := make([]string, 0, len(bindings))
+		for _, obj := range bindings {
+			rb := &rbacv1.RoleBinding{}
+			g.Expect(kube.FromUnstructured(obj, rb)).To(Succeed())
+			g.Expect(rb.Name).To(Equal("example-operator-rolebinding"))
+			g.Expect(rb.RoleRef.Name).To(Equal("example-operator-role"))
+
+			// Copies keep binding the ServiceAccount of the install namespace
+			g.Expect(rb.Subjects).To(ConsistOf(subject))
+
+			namespaces = append(namespaces, rb.Namespace)
+		}
+
+		g.Expect(namespaces).To(ConsistOf("operators", "team-a", "team-b"))
+	})
+
+	t.Run("promotes namespaced permissions to cluster roles for all namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		objects := extractBundle(t, newBundle(v1alpha1.InstallModeTypeAllNamespaces), nil, imagemap.Config{})
+
+		g.Expect(findObjects(objects, gvks.Role)).To(BeEmpty())
+		g.Expect(findObjects(objects, gvks.RoleBinding)).To(BeEmpty())
+
+		// Promoted ClusterRoles do not collide with the ClusterRoles of the clusterPermissions
+		rules := make(map[string][]string)
+		for _, obj := range findObjects(objects, gvks.ClusterRole) {
+			cr := &rbacv1.ClusterRole{}
+			g.Expect(kube.FromUnstructured(obj, cr)).To(Succeed())
+			g.Expect(rules).ToNot(HaveKey(cr.Name))
+
+			rules[cr.Name] = cr.Rules[0].Resources
+		}
+
+		g.Expect(rules).To(HaveLen(2))
+
+		bound := make([]string, 0, len(rules))
+		for _, obj := range findObjects(objects, gvks.ClusterRoleBinding) {
+			crb := &rbacv1.ClusterRoleBinding{}
+			g.Expect(kube.FromUnstructured(obj, crb)).To(Succeed())
+			g.Expect(crb.RoleRef.Kind).To(Equal("ClusterRole"))
+			g.Expect(rules).To(HaveKey(crb.RoleRef.Name))
+			g.Expect(crb.Subjects).To(ConsistOf(subject))
+
+			bound = append(bound, rules[crb.RoleRef.Name]...)
+		}
+
+		g.Expect(bound).To(ConsistOf("configmaps", "nodes"))
+	})
+}
+
+func TestManifestsDeploymentConfig(t *testing.T) {
+	t.Run("applies to the targeted deployment", func(t *testing.T) {
+		g := NewWithT(t)
+
+		deploymentConfig := &overrides.Config{Deployment: "example-operator"}
+		deploymentConfig.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+
+		objects, err := extract.Manifests(newBundle(v1alpha1.InstallModeTypeAllNamespaces), "operators", nil, deploymentConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		unstructuredObjects, err := kube.ConvertToUnstructured(objects)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		deployments := findObjects(unstructuredObjects, gvks.Deployment)
+		g.Expect(deployments).To(HaveLen(1))
+
+		deployment := &appsv1.Deployment{}
+		g.Expect(kube.FromUnstructured(deployments[0], deployment)).To(Succeed())
+		g.Expect(deployment.Spec.Template.Spec.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+	})
+
+	t.Run("rejects a deployment the CSV does not define", func(t *testing.T) {
+		g := NewWithT(t)
+
+		deploymentConfig := &overrides.Config{Deployment: "example-webhook"}
+
+		_, err := extract.Manifests(newBundle(v1alpha1.InstallModeTypeAllNamespaces), "operators", nil, deploymentConfig)
+		g.Expect(err).To(MatchError(ContainSubstring(`config deployment "example-webhook" is not a deployment of example-operator.v1.0.0`)))
+	})
+}
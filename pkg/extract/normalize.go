@@ -142,10 +142,16 @@ func buildResourceMappings(objects []runtime.Object, mapping *nameMapping) error
 			continue
 		}
 
+		// Copies of a resource in other namespaces share its normalized name
+		key := resourceKey{name: name, gvk: gvk}
+		if _, ok := mapping.oldToNew[key]; ok {
+			continue
+		}
+
 		// Process RBAC resources - suffix is derived from Kind (lowercase)
 		suffix := strings.ToLower(gvk.Kind)
 		newName := generateResourceName(baseName, suffix, counts[gvk])
-		mapping.oldToNew[resourceKey{name: name, gvk: gvk}] = newName
+		mapping.oldToNew[key] = newName
 		counts[gvk]++
 	}
 
@@ -0,0 +1,225 @@
+package extract
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+)
+
+// AllNamespaces is the watch namespace selecting all namespaces.
+const AllNamespaces = "*"
+
+// OperatorGroup describes the namespaces an operator watches, as an OLM OperatorGroup would.
+type OperatorGroup struct {
+	// Mode is the install mode the target namespaces amount to.
+	Mode v1alpha1.InstallModeType
+
+	// TargetNamespaces are the watched namespaces, empty in AllNamespaces mode.
+	TargetNamespaces []string
+}
+
+// ResolveOperatorGroup resolves the namespaces watched by the operator of csv installed in namespace,
+// validating them against the install modes of the CSV as OLM does for OperatorGroups.
+// watchNamespaces lists the namespaces to watch, or AllNamespaces alone. When empty, all namespaces
+// are watched if the CSV supports it, and the install namespace otherwise.
+// Only explicit watch namespaces are validated, so that the default applies to CSVs supporting
+// neither AllNamespaces nor OwnNamespace as well, and CSVs without install modes are not validated.
+func ResolveOperatorGroup(csv *v1alpha1.ClusterServiceVersion, namespace string, watchNamespaces []string) (OperatorGroup, error) {
+	modes, err := v1alpha1.NewInstallModeSet(csv.Spec.InstallModes)
+	if err != nil {
+		return OperatorGroup{}, fmt.Errorf("invalid install modes: %w", err)
+	}
+
+	targets, err := targetNamespaces(modes, namespace, watchNamespaces)
+	if err != nil {
+		return OperatorGroup{}, err
+	}
+
+	if len(csv.Spec.InstallModes) > 0 && len(watchNamespaces) > 0 {
+		if err := modes.Supports(namespace, targets); err != nil {
+			return OperatorGroup{}, fmt.Errorf("operator %s cannot watch %s: %w", csv.GetName(), describeTargets(targets), err)
+		}
+	}
+
+	switch {
+	case len(targets) > 1:
+		return OperatorGroup{Mode: v1alpha1.InstallModeTypeMultiNamespace, TargetNamespaces: targets}, nil
+	case targets[0] == corev1.NamespaceAll:
+		return OperatorGroup{Mode: v1alpha1.InstallModeTypeAllNamespaces}, nil
+	case targets[0] == namespace:
+		return OperatorGroup{Mode: v1alpha1.InstallModeTypeOwnNamespace, TargetNamespaces: targets}, nil
+	default:
+		return OperatorGroup{Mode: v1alpha1.InstallModeTypeSingleNamespace, TargetNamespaces: targets}, nil
+	}
+}
+
+// targetNamespaces returns the sorted target namespaces of an OperatorGroup watching watchNamespaces,
+// which is the empty namespace alone for all namespaces.
+func targetNamespaces(modes v1alpha1.InstallModeSet, namespace string, watchNamespaces []string) ([]string, error) {
+	if len(watchNamespaces) == 0 {
+		if modes[v1alpha1.InstallModeTypeAllNamespaces] || len(modes) == 0 {
+			return []string{corev1.NamespaceAll}, nil
+		}
+
+		return []string{namespace}, nil
+	}
+
+	if slices.Contains(watchNamespaces, AllNamespaces) {
+		if len(watchNamespaces) > 1 {
+			return nil, fmt.Errorf("watch namespace %q cannot be combined with other namespaces", AllNamespaces)
+		}
+
+		return []string{corev1.NamespaceAll}, nil
+	}
+
+	targets := slices.Clone(watchNamespaces)
+	for _, ns := range targets {
+		if err := kube.ValidateNamespace(ns); err != nil {
+			return nil, fmt.Errorf("invalid watch namespace: %w", err)
+		}
+	}
+
+	slices.Sort(targets)
+
+	return slices.Compact(targets), nil
+}
+
+// describeTargets describes target namespaces in error messages.
+func describeTargets(targets []string) string {
+	if len(targets) == 1 && targets[0] == corev1.NamespaceAll {
+		return "all namespaces"
+	}
+
+	return "namespaces " + strings.Join(targets, ", ")
+}
+
+// Annotations returns the annotations OLM sets on the pod templates of the operator, which
+// operators commonly read through the downward API to know the namespaces to watch.
+func (og OperatorGroup) Annotations(namespace string) map[string]string {
+	return map[string]string{
+		operatorsv1.OperatorGroupNamespaceAnnotationKey: namespace,
+		operatorsv1.OperatorGroupTargetsAnnotationKey:   strings.Join(og.TargetNamespaces, ","),
+	}
+}
+
+// annotateDeployment sets the OperatorGroup annotations on the pod template of an operator deployment.
+func (og OperatorGroup) annotateDeployment(deployment *appsv1.Deployment, namespace string) {
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = make(map[string]string)
+	}
+
+	for key, value := range og.Annotations(namespace) {
+		deployment.Spec.Template.Annotations[key] = value
+	}
+}
+
+// rbacNamespaces returns the namespaces other than namespace in which OLM copies the Roles and
+// RoleBindings of the operator permissions.
+func (og OperatorGroup) rbacNamespaces(namespace string) []string {
+	namespaces := make([]string, 0, len(og.TargetNamespaces))
+	for _, ns := range og.TargetNamespaces {
+		if ns != namespace {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	return namespaces
+}
+
+// scopeRoles returns the Roles of the operator permissions along with their copies in the
+// target namespaces, or the equivalent ClusterRoles when all namespaces are watched.
+func (og OperatorGroup) scopeRoles(roles []*rbacv1.Role) []runtime.Object {
+	scoped := make([]runtime.Object, 0, len(roles))
+
+	for _, role := range roles {
+		if og.Mode == v1alpha1.InstallModeTypeAllNamespaces {
+			scoped = append(scoped, promoteRole(role))
+
+			continue
+		}
+
+		scoped = append(scoped, role)
+
+		for _, ns := range og.rbacNamespaces(role.Namespace) {
+			roleCopy := role.DeepCopy()
+			roleCopy.Namespace = ns
+
+			scoped = append(scoped, roleCopy)
+		}
+	}
+
+	return scoped
+}
+
+// scopeRoleBindings returns the RoleBindings of the operator permissions along with their copies
+// in the target namespaces, or the equivalent ClusterRoleBindings when all namespaces are watched.
+// Copies keep binding the ServiceAccount of the install namespace.
+func (og OperatorGroup) scopeRoleBindings(bindings []*rbacv1.RoleBinding) []runtime.Object {
+	scoped := make([]runtime.Object, 0, len(bindings))
+
+	for _, rb := range bindings {
+		if og.Mode == v1alpha1.InstallModeTypeAllNamespaces {
+			scoped = append(scoped, promoteRoleBinding(rb))
+
+			continue
+		}
+
+		scoped = append(scoped, rb)
+
+		for _, ns := range og.rbacNamespaces(rb.Namespace) {
+			rbCopy := rb.DeepCopy()
+			rbCopy.Namespace = ns
+
+			scoped = append(scoped, rbCopy)
+		}
+	}
+
+	return scoped
+}
+
+// promoteRole converts a Role of the operator permissions to a ClusterRole granting its rules
+// in all namespaces.
+func promoteRole(role *rbacv1.Role) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gvks.ClusterRole.GroupVersion().String(),
+			Kind:       gvks.ClusterRole.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: role.Name,
+		},
+		Rules: role.Rules,
+	}
+}
+
+// promoteRoleBinding converts a RoleBinding of the operator permissions to a ClusterRoleBinding
+// of the ClusterRole promoted from its Role.
+func promoteRoleBinding(rb *rbacv1.RoleBinding) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gvks.ClusterRoleBinding.GroupVersion().String(),
+			Kind:       gvks.ClusterRoleBinding.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: rb.Name,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     gvks.ClusterRole.Kind,
+			Name:     rb.RoleRef.Name,
+		},
+		Subjects: rb.Subjects,
+	}
+}
@@ -0,0 +1,111 @@
+package extract_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/extract"
+
+	. "github.com/onsi/gomega"
+)
+
+func newCSV(supported ...v1alpha1.InstallModeType) *v1alpha1.ClusterServiceVersion {
+	csv := &v1alpha1.ClusterServiceVersion{}
+	csv.SetName("example-operator.v1.0.0")
+
+	for _, mode := range []v1alpha1.InstallModeType{
+		v1alpha1.InstallModeTypeOwnNamespace,
+		v1alpha1.InstallModeTypeSingleNamespace,
+		v1alpha1.InstallModeTypeMultiNamespace,
+		v1alpha1.InstallModeTypeAllNamespaces,
+	} {
+		csv.Spec.InstallModes = append(csv.Spec.InstallModes, v1alpha1.InstallMode{
+			Type:      mode,
+			Supported: slices.Contains(supported, mode),
+		})
+	}
+
+	return csv
+}
+
+func TestResolveOperatorGroup(t *testing.T) {
+	allModes := []v1alpha1.InstallModeType{
+		v1alpha1.InstallModeTypeOwnNamespace,
+		v1alpha1.InstallModeTypeSingleNamespace,
+		v1alpha1.InstallModeTypeMultiNamespace,
+		v1alpha1.InstallModeTypeAllNamespaces,
+	}
+
+	t.Run("defaults to all namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		og, err := extract.ResolveOperatorGroup(newCSV(allModes...), "operators", nil)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.Mode).To(Equal(v1alpha1.InstallModeTypeAllNamespaces))
+		g.Expect(og.TargetNamespaces).To(BeEmpty())
+		g.Expect(og.Annotations("operators")).To(Equal(map[string]string{
+			"olm.operatorNamespace": "operators",
+			"olm.targetNamespaces":  "",
+		}))
+	})
+
+	t.Run("defaults to the install namespace without AllNamespaces support", func(t *testing.T) {
+		g := NewWithT(t)
+
+		og, err := extract.ResolveOperatorGroup(newCSV(v1alpha1.InstallModeTypeOwnNamespace), "operators", nil)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.Mode).To(Equal(v1alpha1.InstallModeTypeOwnNamespace))
+		g.Expect(og.TargetNamespaces).To(ConsistOf("operators"))
+	})
+
+	t.Run("defaults to the install namespace without validation", func(t *testing.T) {
+		g := NewWithT(t)
+
+		og, err := extract.ResolveOperatorGroup(newCSV(v1alpha1.InstallModeTypeSingleNamespace), "operators", nil)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.TargetNamespaces).To(ConsistOf("operators"))
+	})
+
+	t.Run("resolves install modes from watch namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		og, err := extract.ResolveOperatorGroup(newCSV(allModes...), "operators", []string{"team-a"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.Mode).To(Equal(v1alpha1.InstallModeTypeSingleNamespace))
+
+		og, err = extract.ResolveOperatorGroup(newCSV(allModes...), "operators", []string{"team-b", "team-a", "team-b"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.Mode).To(Equal(v1alpha1.InstallModeTypeMultiNamespace))
+		g.Expect(og.TargetNamespaces).To(Equal([]string{"team-a", "team-b"}))
+		g.Expect(og.Annotations("operators")).To(HaveKeyWithValue("olm.targetNamespaces", "team-a,team-b"))
+
+		og, err = extract.ResolveOperatorGroup(newCSV(allModes...), "operators", []string{extract.AllNamespaces})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(og.Mode).To(Equal(v1alpha1.InstallModeTypeAllNamespaces))
+	})
+
+	t.Run("rejects unsupported install modes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract.ResolveOperatorGroup(newCSV(v1alpha1.InstallModeTypeAllNamespaces), "operators", []string{"team-a"})
+		g.Expect(err).To(MatchError(ContainSubstring("cannot watch namespaces team-a")))
+
+		_, err = extract.ResolveOperatorGroup(newCSV(v1alpha1.InstallModeTypeOwnNamespace), "operators", []string{extract.AllNamespaces})
+		g.Expect(err).To(MatchError(ContainSubstring("cannot watch all namespaces")))
+	})
+
+	t.Run("rejects invalid watch namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract.ResolveOperatorGroup(newCSV(allModes...), "operators", []string{"*", "team-a"})
+		g.Expect(err).To(MatchError(ContainSubstring("cannot be combined")))
+
+		_, err = extract.ResolveOperatorGroup(newCSV(allModes...), "operators", []string{"Team_A"})
+		g.Expect(err).To(MatchError(ContainSubstring("invalid watch namespace")))
+	})
+}
@@ -0,0 +1,81 @@
+package extract
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+)
+
+// Provenance annotation keys recorded on rendered resources.
+const (
+	ProvenanceAnnotationPrefix = "olm.lburgazzoli.github.io/"
+
+	AnnotationCatalog       = ProvenanceAnnotationPrefix + "catalog"
+	AnnotationCatalogDigest = ProvenanceAnnotationPrefix + "catalog-digest"
+	AnnotationPackage       = ProvenanceAnnotationPrefix + "package"
+	AnnotationChannel       = ProvenanceAnnotationPrefix + "channel"
+	AnnotationVersion       = ProvenanceAnnotationPrefix + "version"
+	AnnotationBundle        = ProvenanceAnnotationPrefix + "bundle"
+	AnnotationBundleDigest  = ProvenanceAnnotationPrefix + "bundle-digest"
+)
+
+// Provenance describes where the resources of a bundle come from.
+// Catalog fields are empty when the bundle was not resolved from a catalog, and digests are
+// empty for local directories and catalogs.
+type Provenance struct {
+	CatalogImage  string
+	CatalogDigest string
+	Package       string
+	Channel       string
+	Version       string
+	BundleImage   string
+	BundleDigest  string
+}
+
+// Annotations returns the provenance as annotations, omitting empty fields.
+func (p Provenance) Annotations() map[string]string {
+	annotations := make(map[string]string)
+
+	for key, value := range map[string]string{
+		AnnotationCatalog:       p.CatalogImage,
+		AnnotationCatalogDigest: p.CatalogDigest,
+		AnnotationPackage:       p.Package,
+		AnnotationChannel:       p.Channel,
+		AnnotationVersion:       p.Version,
+		AnnotationBundle:        p.BundleImage,
+		AnnotationBundleDigest:  p.BundleDigest,
+	} {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+
+	return annotations
+}
+
+// AnnotateProvenance records the provenance on every object extracted from a bundle.
+// Namespaces are skipped since they are shared by all the bundles installed into them.
+func AnnotateProvenance(objects []runtime.Object, p Provenance) error {
+	annotations := p.Annotations()
+
+	for _, obj := range objects {
+		if obj.GetObjectKind().GroupVersionKind() == gvks.Namespace {
+			continue
+		}
+
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return fmt.Errorf("failed to access object metadata: %w", err)
+		}
+
+		for key, value := range annotations {
+			kube.SetAnnotation(accessor, key, value)
+		}
+	}
+
+	return nil
+}
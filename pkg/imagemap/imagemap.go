@@ -0,0 +1,240 @@
+// Package imagemap rewrites the image references of extracted manifests to mirrors.
+//
+// Installing operators from mirrored registries requires every image reference to point to the
+// mirror: the images of the Deployment containers and the RELATED_IMAGE_* environment variables
+// operators read the images of their operands from. An image map file rewrites them with:
+//   - ImageDigestMirrorSet, ImageTagMirrorSet and ImageContentSourcePolicy resources, replacing a
+//     repository prefix with its first mirror as pulls do
+//   - explicit per-image overrides, replacing a whole image reference
+//
+// The spec.relatedImages of ClusterServiceVersions are not rendered, but are checked in strict
+// mode so that operand images missing from the mirrors are reported.
+package imagemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+)
+
+// relatedImageEnvPrefix is the prefix of the environment variables holding operand images.
+const relatedImageEnvPrefix = "RELATED_IMAGE_"
+
+// Config configures the image rewrite transformation.
+type Config struct {
+	// File is the path of the image map. The transformation is disabled when empty.
+	File string `mapstructure:"image-map"`
+
+	// Strict reports the images that matched no mapping through OnUnmatched.
+	Strict bool `mapstructure:"image-map-strict"`
+
+	// RelatedImages are the spec.relatedImages of the extracted CSVs, which are checked but not
+	// rewritten since CSVs are not rendered. It is set by the caller, see RelatedImages.
+	RelatedImages []string `mapstructure:"-"`
+
+	// OnUnmatched is called once for each image left unchanged in strict mode, so callers can
+	// report it. It is set by the caller rather than bound to a flag.
+	OnUnmatched func(image string) `mapstructure:"-"`
+}
+
+// Map maps image references to their mirrors.
+type Map struct {
+	// Images replace whole image references, taking precedence over the mirror sets.
+	Images map[string]string `json:"images,omitempty"`
+
+	// mirrors are the rules of the mirror set resources of the image map.
+	mirrors []registry.MirrorRule
+}
+
+// Load reads an image map file, in YAML or JSON. It may hold multiple documents: mirror set
+// resources, loaded as registry.LoadMirrorSets does, and documents without kind listing
+// per-image overrides under images.
+func Load(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image map: %w", err)
+	}
+
+	m := &Map{Images: make(map[string]string)}
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data))
+
+	for {
+		var doc json.RawMessage
+
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image map %s: %w", path, err)
+		}
+
+		meta := metav1.TypeMeta{}
+		if err := json.Unmarshal(doc, &meta); err != nil {
+			return nil, fmt.Errorf("failed to parse image map %s: %w", path, err)
+		}
+
+		// Resources are mirror sets, loaded below
+		if meta.Kind != "" {
+			continue
+		}
+
+		overrides := Map{}
+		if err := yaml.UnmarshalStrict(doc, &overrides); err != nil {
+			return nil, fmt.Errorf("failed to parse image map %s: %w", path, err)
+		}
+
+		for image, target := range overrides.Images {
+			m.Images[image] = target
+		}
+	}
+
+	m.mirrors, err = registry.LoadMirrorSets(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Resolve returns the reference image is rewritten to, and whether a mapping matched.
+// Per-image overrides are looked up first, then the mirror sets, which like on clusters only
+// apply to digest references for ImageDigestMirrorSets and ImageContentSourcePolicies, and to
+// tag references for ImageTagMirrorSets.
+func (m *Map) Resolve(image string) (string, bool) {
+	if target, ok := m.Images[image]; ok {
+		return target, true
+	}
+
+	return registry.MirrorReference(image, m.mirrors)
+}
+
+// RelatedImages returns the images listed in the spec.relatedImages of csv, to set as
+// Config.RelatedImages.
+func RelatedImages(csv *v1alpha1.ClusterServiceVersion) []string {
+	images := make([]string, 0, len(csv.Spec.RelatedImages))
+	for _, related := range csv.Spec.RelatedImages {
+		if related.Image != "" {
+			images = append(images, related.Image)
+		}
+	}
+
+	return images
+}
+
+// Rewrite rewrites the images of Deployments with the image map of cfg. In strict mode, images
+// that matched no mapping, cfg.RelatedImages included, are reported through cfg.OnUnmatched.
+func Rewrite(objects []*unstructured.Unstructured, cfg Config) error {
+	if cfg.File == "" {
+		return nil
+	}
+
+	m, err := Load(cfg.File)
+	if err != nil {
+		return err
+	}
+
+	r := &rewriter{imageMap: m, unmatched: sets.New[string]()}
+
+	for _, obj := range objects {
+		if !kube.IsKind(obj, gvks.Deployment) {
+			continue
+		}
+
+		if err := r.rewritePodSpec(obj.Object, "spec", "template", "spec"); err != nil {
+			return fmt.Errorf("failed to rewrite images of %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+
+	for _, image := range cfg.RelatedImages {
+		r.resolve(image)
+	}
+
+	if cfg.Strict && cfg.OnUnmatched != nil {
+		for _, image := range sets.List(r.unmatched) {
+			cfg.OnUnmatched(image)
+		}
+	}
+
+	return nil
+}
+
+// rewriter rewrites image references, collecting those that matched no mapping.
+type rewriter struct {
+	imageMap  *Map
+	unmatched sets.Set[string]
+}
+
+// resolve returns the reference image is rewritten to, recording it if no mapping matched.
+func (r *rewriter) resolve(image string) string {
+	target, ok := r.imageMap.Resolve(image)
+	if !ok {
+		r.unmatched.Insert(image)
+	}
+
+	return target
+}
+
+// rewritePodSpec rewrites the container images and RELATED_IMAGE_* environment variables of the
+// pod spec found at fields in obj.
+func (r *rewriter) rewritePodSpec(obj map[string]any, fields ...string) error {
+	for _, containersField := range []string{"initContainers", "containers"} {
+		path := append(append([]string{}, fields...), containersField)
+
+		containers, found, err := unstructured.NestedSlice(obj, path...)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		for _, item := range containers {
+			container, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			if image, ok := container["image"].(string); ok && image != "" {
+				container["image"] = r.resolve(image)
+			}
+
+			env, _ := container["env"].([]any)
+			for _, envItem := range env {
+				envVar, ok := envItem.(map[string]any)
+				if !ok {
+					continue
+				}
+
+				name, _ := envVar["name"].(string)
+				value, _ := envVar["value"].(string)
+				if strings.HasPrefix(name, relatedImageEnvPrefix) && value != "" {
+					envVar["value"] = r.resolve(value)
+				}
+			}
+		}
+
+		if err := unstructured.SetNestedSlice(obj, containers, path...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package imagemap_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+
+	. "github.com/onsi/gomega"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+const testImageMap = `
+apiVersion: config.openshift.io/v1
+kind: ImageDigestMirrorSet
+metadata:
+  name: digests
+spec:
+  imageDigestMirrors:
+    - source: registry.example.com
+      mirrors:
+        - mirror.internal/example
+    - source: registry.example.com/operators
+      mirrors:
+        - mirror.internal/operators
+        - backup.internal/operators
+---
+apiVersion: config.openshift.io/v1
+kind: ImageTagMirrorSet
+metadata:
+  name: tags
+spec:
+  imageTagMirrors:
+    - source: registry.example.com
+      mirrors:
+        - mirror.internal/example
+---
+images:
+  quay.io/example/proxy:v1.0.0: mirror.internal/proxy@` + testDigest + `
+`
+
+func writeImageMap(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "image-map.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newDeployment(t *testing.T) *unstructured.Unstructured {
+	t.Helper()
+
+	deployment := &appsv1.Deployment{}
+	deployment.SetGroupVersionKind(gvks.Deployment)
+	deployment.SetName("example-operator")
+	deployment.Spec.Template.Spec = corev1.PodSpec{
+		InitContainers: []corev1.Container{{
+			Name:  "init",
+			Image: "docker.io/library/busybox:1.36",
+		}},
+		Containers: []corev1.Container{
+			{
+				Name:  "manager",
+				Image: "registry.example.com/operators/manager@" + testDigest,
+				Env: []corev1.EnvVar{
+					{Name: "RELATED_IMAGE_OPERAND", Value: "registry.example.com/operands/server:v2"},
+					{Name: "LOG_LEVEL", Value: "registry.example.com/not-an-image"},
+				},
+			},
+			{
+				Name:  "proxy",
+				Image: "quay.io/example/proxy:v1.0.0",
+			},
+		},
+	}
+
+	u, err := kube.ToUnstructured(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestResolve(t *testing.T) {
+	g := NewWithT(t)
+
+	m, err := imagemap.Load(writeImageMap(t, testImageMap))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tests := []struct {
+		image    string
+		expected string
+		matched  bool
+	}{
+		{"quay.io/example/proxy:v1.0.0", "mirror.internal/proxy@" + testDigest, true},
+		{"registry.example.com/operators/manager@" + testDigest, "mirror.internal/operators/manager@" + testDigest, true},
+		{"registry.example.com/operators/manager:v1", "mirror.internal/example/operators/manager:v1", true},
+		{"registry.example.com/operands/server:v2", "mirror.internal/example/operands/server:v2", true},
+		{"registry.example.com.evil/operators/manager:v1", "registry.example.com.evil/operators/manager:v1", false},
+		{"quay.io/example/proxy:v2.0.0", "quay.io/example/proxy:v2.0.0", false},
+	}
+
+	for _, tt := range tests {
+		image, matched := m.Resolve(tt.image)
+		g.Expect(image).To(Equal(tt.expected), tt.image)
+		g.Expect(matched).To(Equal(tt.matched), tt.image)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := imagemap.Load(writeImageMap(t, "mirror: []\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("failed to parse image map")))
+
+	_, err = imagemap.Load(writeImageMap(t, "kind: ImageDigestMirrorSet\nspec: []\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("failed to parse mirror set")))
+}
+
+func TestRewrite(t *testing.T) {
+	t.Run("rewrites deployment images and related images env", func(t *testing.T) {
+		g := NewWithT(t)
+
+		unmatched := make([]string, 0)
+		cfg := imagemap.Config{
+			File:        writeImageMap(t, testImageMap),
+			Strict:      true,
+			OnUnmatched: func(image string) { unmatched = append(unmatched, image) },
+		}
+
+		objects := []*unstructured.Unstructured{newDeployment(t)}
+		g.Expect(imagemap.Rewrite(objects, cfg)).To(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		g.Expect(kube.FromUnstructured(objects[0], deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		g.Expect(podSpec.InitContainers[0].Image).To(Equal("docker.io/library/busybox:1.36"))
+		g.Expect(podSpec.Containers[0].Image).To(Equal("mirror.internal/operators/manager@" + testDigest))
+		g.Expect(podSpec.Containers[0].Env).To(Equal([]corev1.EnvVar{
+			{Name: "RELATED_IMAGE_OPERAND", Value: "mirror.internal/example/operands/server:v2"},
+			{Name: "LOG_LEVEL", Value: "registry.example.com/not-an-image"},
+		}))
+		g.Expect(podSpec.Containers[1].Image).To(Equal("mirror.internal/proxy@" + testDigest))
+
+		g.Expect(unmatched).To(Equal([]string{"docker.io/library/busybox:1.36"}))
+	})
+
+	t.Run("checks CSV related images", func(t *testing.T) {
+		g := NewWithT(t)
+
+		unmatched := make([]string, 0)
+		cfg := imagemap.Config{
+			File:          writeImageMap(t, testImageMap),
+			Strict:        true,
+			RelatedImages: []string{"registry.example.com/operands/server:v2", "quay.io/example/operand:v1"},
+			OnUnmatched:   func(image string) { unmatched = append(unmatched, image) },
+		}
+
+		g.Expect(imagemap.Rewrite(nil, cfg)).To(Succeed())
+		g.Expect(unmatched).To(Equal([]string{"quay.io/example/operand:v1"}))
+	})
+
+	t.Run("does not report unmatched images outside strict mode", func(t *testing.T) {
+		g := NewWithT(t)
+
+		reported := false
+		cfg := imagemap.Config{
+			File:        writeImageMap(t, testImageMap),
+			OnUnmatched: func(string) { reported = true },
+		}
+
+		g.Expect(imagemap.Rewrite([]*unstructured.Unstructured{newDeployment(t)}, cfg)).To(Succeed())
+		g.Expect(reported).To(BeFalse())
+	})
+
+	t.Run("is disabled without image map", func(t *testing.T) {
+		g := NewWithT(t)
+
+		objects := []*unstructured.Unstructured{newDeployment(t)}
+		g.Expect(imagemap.Rewrite(objects, imagemap.Config{Strict: true})).To(Succeed())
+		g.Expect(objects[0]).To(Equal(newDeployment(t)))
+	})
+}
@@ -6,12 +6,20 @@ import (
 	"io"
 	"os"
 
-	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
 	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
 	"github.com/lburgazzoli/olm-extractor/pkg/extract"
+	"github.com/lburgazzoli/olm-extractor/pkg/imagemap"
 	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+	"github.com/lburgazzoli/olm-extractor/pkg/lock"
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
 )
 
+// cacheDirEnv enables the persistent cache when the function configuration does not set a directory.
+const cacheDirEnv = "BUNDLE_EXTRACT_CACHE_DIR"
+
 // Execute implements the KRM function interface for Kustomize.
 // It reads a ResourceList from the reader, processes it, and writes the result to the writer.
 func Execute(ctx context.Context, reader io.Reader, writer io.Writer) error {
@@ -42,38 +50,118 @@ func Execute(ctx context.Context, reader io.Reader, writer io.Writer) error {
 		return WriteResourceList(writer, rl)
 	}
 
-	// Phase 5: Resolve bundle source
-	bundleImageOrDir, err := catalog.ResolveBundleSource(
-		ctx,
-		input,
-		cfg.Catalog,
-		cfg.Channel,
-		cfg.Registry,
-		cfg.TempDir,
-	)
+	// Phase 5: Configure the persistent cache, enabled by the spec or the environment
+	if cfg.Cache.Dir == "" {
+		cfg.Cache.Dir = os.Getenv(cacheDirEnv)
+	}
+
+	cfg.Registry.CacheDir = cfg.Cache.Dir
+
+	pruneOptions, err := cfg.Cache.PruneOptions()
 	if err != nil {
-		rl.AddErrorf("failed to resolve bundle source: %v", err)
+		rl.AddErrorf("invalid configuration: %v", err)
 
 		return WriteResourceList(writer, rl)
 	}
 
-	// Phase 6: Load bundle
-	b, err := bundle.Load(ctx, bundleImageOrDir, cfg.Registry, cfg.TempDir)
-	if err != nil {
-		rl.AddErrorf("failed to load bundle: %v", err)
+	// Images served by a mirror and verified signatures are reported in the output results
+	pullResults := make([]string, 0)
+	cfg.Registry.OnMirrorPull = func(imageRef string, source string) {
+		pullResults = append(pullResults, fmt.Sprintf("pulled %s from mirror %s", imageRef, source))
+	}
 
-		return WriteResourceList(writer, rl)
+	cfg.Registry.OnVerified = func(imageRef string, digest string) {
+		pullResults = append(pullResults, fmt.Sprintf("verified signature of %s (%s)", imageRef, digest))
 	}
 
-	// Phase 7: Extract manifests
-	objects, err := extract.Manifests(b, cfg.Namespace)
+	// Retried registry requests are reported as warnings, also when the function fails
+	retryResults := make([]string, 0)
+	cfg.Registry.OnRetry = func(imageRef string, retry registry.Retry) {
+		msg := fmt.Sprintf("pulling %s: %s", imageRef, retry)
+		retryResults = append(retryResults, msg)
+		rl.AddWarningf("%s", msg)
+	}
+
+	// Images left unchanged by the image map in strict mode are reported as warnings
+	imageResults := make([]string, 0)
+	cfg.ImageMap.OnUnmatched = func(image string) {
+		imageResults = append(imageResults, fmt.Sprintf("image %s matched no mapping of the image map", image))
+	}
+
+	// Phase 6: Resolve bundle sources, reusing the lock file if any
+	lockRequest := lock.Request{
+		Source:              input,
+		Catalog:             cfg.Catalog,
+		Channel:             cfg.Channel,
+		ResolveDependencies: cfg.ResolveDependencies,
+		Platform:            cfg.Registry.Platform,
+	}
+
+	sources, err := cfg.Lock.Sources(ctx, lockRequest, cfg.Registry, cfg.TempDir)
 	if err != nil {
-		rl.AddErrorf("failed to extract manifests: %v", err)
+		rl.AddErrorf("%v", err)
 
 		return WriteResourceList(writer, rl)
 	}
 
-	// Phase 8: Convert to unstructured
+	if sources == nil {
+		sources, err = catalog.ResolveBundles(
+			ctx,
+			input,
+			cfg.Catalog,
+			cfg.Channel,
+			cfg.ResolveDependencies,
+			cfg.Registry,
+			cfg.TempDir,
+		)
+		if err != nil {
+			rl.AddErrorf("failed to resolve bundle source: %v", err)
+
+			return WriteResourceList(writer, rl)
+		}
+	}
+
+	// Phase 7 & 8: Load bundles and extract manifests
+	objectSets := make([][]runtime.Object, 0, len(sources))
+	digests := make([]string, 0, len(sources))
+	for i, source := range sources {
+		b, digest, err := source.LoadBundle(ctx, cfg.Registry, cfg.TempDir)
+		if err != nil {
+			rl.AddErrorf("failed to load bundle: %v", err)
+
+			return WriteResourceList(writer, rl)
+		}
+
+		digests = append(digests, digest)
+
+		// The config targets the requested operator, which comes last, not its dependencies
+		sourceConfig := cfg.DeploymentConfig
+		if i < len(sources)-1 {
+			sourceConfig = nil
+		}
+
+		objects, err := extract.Manifests(b, cfg.Namespace, cfg.WatchNamespaces, sourceConfig)
+		if err != nil {
+			rl.AddErrorf("failed to extract manifests: %v", err)
+
+			return WriteResourceList(writer, rl)
+		}
+
+		if err := extract.AnnotateProvenance(objects, source.Provenance(digest)); err != nil {
+			rl.AddErrorf("failed to annotate manifests: %v", err)
+
+			return WriteResourceList(writer, rl)
+		}
+
+		// CSVs are not rendered, so their related images are only checked by the image map
+		cfg.ImageMap.RelatedImages = append(cfg.ImageMap.RelatedImages, imagemap.RelatedImages(b.CSV)...)
+
+		objectSets = append(objectSets, objects)
+	}
+
+	objects := extract.Merge(objectSets...)
+
+	// Phase 9: Convert to unstructured
 	unstructuredObjects, err := kube.ConvertToUnstructured(objects)
 	if err != nil {
 		rl.AddErrorf("failed to convert objects: %v", err)
@@ -81,12 +169,13 @@ func Execute(ctx context.Context, reader io.Reader, writer io.Writer) error {
 		return WriteResourceList(writer, rl)
 	}
 
-	// Phase 9: Apply transformations
+	// Phase 10: Apply transformations
 	unstructuredObjects, err = extract.ApplyTransformations(
 		unstructuredObjects,
 		cfg.Namespace,
 		cfg.Include,
 		cfg.Exclude,
+		cfg.ImageMap,
 		cfg.CertManager,
 	)
 	if err != nil {
@@ -95,8 +184,33 @@ func Execute(ctx context.Context, reader io.Reader, writer io.Writer) error {
 		return WriteResourceList(writer, rl)
 	}
 
-	// Phase 10: Convert to ResourceList and write output
+	if err := cfg.Lock.Record(lockRequest, sources, digests); err != nil {
+		rl.AddErrorf("%v", err)
+
+		return WriteResourceList(writer, rl)
+	}
+
+	// Phase 11: Convert to ResourceList and write output
 	outputRL := ToResourceList(unstructuredObjects)
+	for _, msg := range retryResults {
+		outputRL.AddWarningf("%s", msg)
+	}
+
+	for _, msg := range imageResults {
+		outputRL.AddWarningf("%s", msg)
+	}
+
+	for _, msg := range pullResults {
+		outputRL.AddInfof("%s", msg)
+	}
+
+	// Evicting stale entries does not affect the output, so failures are only reported
+	if cfg.Registry.CacheDir != "" {
+		if _, err := cache.New(cfg.Registry.CacheDir).Prune(pruneOptions); err != nil {
+			outputRL.AddWarningf("failed to prune cache: %v", err)
+		}
+	}
+
 	if err := WriteResourceList(writer, outputRL); err != nil {
 		return fmt.Errorf("failed to write ResourceList: %w", err)
 	}
@@ -0,0 +1,171 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube/gvks"
+)
+
+const (
+	// DefaultAPIServicePort is the default port of the services backing APIServices.
+	DefaultAPIServicePort = 443
+
+	// apiServiceGroupPriorityMinimum and apiServiceVersionPriority are the priorities OLM
+	// gives to the APIServices of operators.
+	apiServiceGroupPriorityMinimum = 2000
+	apiServiceVersionPriority      = 15
+)
+
+// APIServiceServiceName returns the name of the Service backing the APIServices served by a
+// deployment, as named by OLM.
+func APIServiceServiceName(deploymentName string) string {
+	return deploymentName + "-service"
+}
+
+// APIServiceSecretName returns the name of the secret holding the serving certificate of an
+// APIService backing Service, as named by OLM.
+func APIServiceSecretName(serviceName string) string {
+	return serviceName + "-cert"
+}
+
+// APIServicePort returns the port of the Service backing an APIService.
+func APIServicePort(desc v1alpha1.APIServiceDescription) int32 {
+	if desc.ContainerPort > 0 {
+		return desc.ContainerPort
+	}
+
+	return DefaultAPIServicePort
+}
+
+// CreateAPIService creates the APIService registering an aggregated API of a CSV.
+// The APIService is built as unstructured, the CA bundle is left empty - users must inject certificates.
+func CreateAPIService(desc v1alpha1.APIServiceDescription, namespace string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{
+		Object: map[string]any{
+			"spec": map[string]any{
+				"group":                desc.Group,
+				"version":              desc.Version,
+				"groupPriorityMinimum": int64(apiServiceGroupPriorityMinimum),
+				"versionPriority":      int64(apiServiceVersionPriority),
+				"service": map[string]any{
+					"namespace": namespace,
+					"name":      APIServiceServiceName(desc.DeploymentName),
+					"port":      int64(APIServicePort(desc)),
+				},
+			},
+		},
+	}
+
+	u.SetGroupVersionKind(gvks.APIService)
+	u.SetName(desc.Version + "." + desc.Group)
+
+	return u
+}
+
+// ExtractAPIServiceInfo extracts the service configuration of an APIService.
+// Returns nil if the APIService doesn't reference a service.
+func ExtractAPIServiceInfo(obj *unstructured.Unstructured) *WebhookInfo {
+	if !IsKind(obj, gvks.APIService) {
+		return nil
+	}
+
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "name")
+	if name == "" {
+		return nil
+	}
+
+	namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "namespace")
+
+	port, found, err := unstructured.NestedInt64(obj.Object, "spec", "service", "port")
+	if !found || err != nil {
+		port = DefaultAPIServicePort
+	}
+
+	return &WebhookInfo{
+		ServiceName: name,
+		Namespace:   namespace,
+		Port:        int32(port),
+	}
+}
+
+// AddAPIServiceCertVolumes mounts the serving certificate secret of an APIService into the
+// containers of its deployment, where OLM mounts it: /apiserver.local.config/certificates for
+// aggregated API servers and /tmp/k8s-webhook-server/serving-certs for Operator SDK and
+// Kubebuilder projects.
+func AddAPIServiceCertVolumes(deployment *appsv1.Deployment, secretName string) {
+	addCertVolume(deployment, "apiservice-cert", "/apiserver.local.config/certificates", secretName, "apiserver.crt", "apiserver.key")
+	addCertVolume(deployment, "webhook-cert", "/tmp/k8s-webhook-server/serving-certs", secretName, "tls.crt", "tls.key")
+}
+
+// addCertVolume mounts the certificate and key of a TLS secret at mountPath in all containers,
+// replacing volumes with the same name and mounts at the same path.
+func addCertVolume(deployment *appsv1.Deployment, name string, mountPath string, secretName string, certPath string, keyPath string) {
+	podSpec := &deployment.Spec.Template.Spec
+
+	volume := corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: certPath},
+					{Key: corev1.TLSPrivateKeyKey, Path: keyPath},
+				},
+			},
+		},
+	}
+
+	replaced := false
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == name {
+			podSpec.Volumes[i] = volume
+			replaced = true
+		}
+	}
+	if !replaced {
+		podSpec.Volumes = append(podSpec.Volumes, volume)
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      name,
+		MountPath: mountPath,
+	}
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+
+		mounted := false
+		for j := range container.VolumeMounts {
+			if container.VolumeMounts[j].Name == name || container.VolumeMounts[j].MountPath == mountPath {
+				container.VolumeMounts[j] = mount
+				mounted = true
+
+				break
+			}
+		}
+		if !mounted {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+	}
+}
+
+// CreateAPIServiceService creates the Service backing the APIServices served by a deployment.
+func CreateAPIServiceService(
+	deploymentName string,
+	namespace string,
+	port int32,
+	selector map[string]string,
+) (*unstructured.Unstructured, error) {
+	svc, err := CreateService(APIServiceServiceName(deploymentName), namespace, port, port, selector, DefaultWebhookPortName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create apiservice service for deployment %s: %w", deploymentName, err)
+	}
+
+	return svc, nil
+}
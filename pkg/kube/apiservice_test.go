@@ -0,0 +1,80 @@
+package kube_test
+
+import (
+	"testing"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/kube"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCreateAPIService(t *testing.T) {
+	g := NewWithT(t)
+
+	apiService := kube.CreateAPIService(v1alpha1.APIServiceDescription{
+		Group:          "metrics.example.com",
+		Version:        "v1beta1",
+		DeploymentName: "metrics-server",
+		ContainerPort:  6443,
+	}, "operators")
+
+	g.Expect(apiService.GetName()).To(Equal("v1beta1.metrics.example.com"))
+	g.Expect(apiService.GetKind()).To(Equal("APIService"))
+
+	info := kube.ExtractAPIServiceInfo(apiService)
+
+	g.Expect(info).ToNot(BeNil())
+	g.Expect(info.ServiceName).To(Equal("metrics-server-service"))
+	g.Expect(info.Namespace).To(Equal("operators"))
+	g.Expect(info.Port).To(Equal(int32(6443)))
+}
+
+func TestExtractAPIServiceInfo_NoService(t *testing.T) {
+	g := NewWithT(t)
+
+	apiService := &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": "apiregistration.k8s.io/v1",
+			"kind":       "APIService",
+			"metadata": map[string]any{
+				"name": "v1.apps",
+			},
+		},
+	}
+
+	g.Expect(kube.ExtractAPIServiceInfo(apiService)).To(BeNil())
+}
+
+func TestAddAPIServiceCertVolumes(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := &appsv1.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "server",
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "certs",
+			MountPath: "/apiserver.local.config/certificates",
+		}},
+	}}
+
+	kube.AddAPIServiceCertVolumes(deployment, "metrics-server-service-cert")
+
+	volumes := deployment.Spec.Template.Spec.Volumes
+	g.Expect(volumes).To(HaveLen(2))
+	g.Expect(volumes[0].Name).To(Equal("apiservice-cert"))
+	g.Expect(volumes[0].Secret.SecretName).To(Equal("metrics-server-service-cert"))
+	g.Expect(volumes[0].Secret.Items).To(ContainElement(corev1.KeyToPath{Key: "tls.crt", Path: "apiserver.crt"}))
+	g.Expect(volumes[1].Name).To(Equal("webhook-cert"))
+
+	// The mount at the same path is replaced
+	g.Expect(deployment.Spec.Template.Spec.Containers[0].VolumeMounts).To(ConsistOf(
+		corev1.VolumeMount{Name: "apiservice-cert", MountPath: "/apiserver.local.config/certificates"},
+		corev1.VolumeMount{Name: "webhook-cert", MountPath: "/tmp/k8s-webhook-server/serving-certs"},
+	))
+}
@@ -65,6 +65,15 @@ var (
 	}
 )
 
+// API registration resources.
+var (
+	APIService = schema.GroupVersionKind{
+		Group:   "apiregistration.k8s.io",
+		Version: "v1",
+		Kind:    "APIService",
+	}
+)
+
 // ApiExtensions resources.
 var (
 	CustomResourceDefinition = schema.GroupVersionKind{
@@ -214,6 +223,8 @@ var ClusterScoped = map[schema.GroupVersionKind]bool{
 	Node:             true,
 	// ApiExtensions
 	CustomResourceDefinition: true,
+	// API registration
+	APIService: true,
 	// RBAC
 	ClusterRole:        true,
 	ClusterRoleBinding: true,
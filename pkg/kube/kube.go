@@ -333,8 +333,9 @@ func ConvertToUnstructured(objects []runtime.Object) ([]*unstructured.Unstructur
 // SortForApply sorts unstructured objects by their resource type priority for proper kubectl apply order.
 // Ordering: Namespace → CRD → ServiceAccount → Role → RoleBinding → ClusterRole →
 // ClusterRoleBinding → Deployment → Service → Issuer → Certificate → Webhook → Other.
+// The relative order of objects with the same priority is preserved.
 func SortForApply(objects []*unstructured.Unstructured) {
-	sort.Slice(objects, func(i int, j int) bool {
+	sort.SliceStable(objects, func(i int, j int) bool {
 		return getUnstructuredPriority(objects[i]) < getUnstructuredPriority(objects[j])
 	})
 }
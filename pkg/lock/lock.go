@@ -0,0 +1,217 @@
+// Package lock implements lock files pinning how bundles were resolved, so that later runs
+// render the same bundles even when the catalog or the bundle tags move.
+//
+// A lock file records the request it was resolved for and, for every bundle, its package,
+// channel, version, image and the digest its image reference resolved to. It is reused as long
+// as the request does not change, in which case bundle images are pulled by digest, and the
+// catalog is only loaded, pinned by digest, for the bundles built from the manifests it embeds.
+package lock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
+)
+
+const (
+	// DefaultFile is the conventional name of lock files.
+	DefaultFile = "bundle-extract.lock"
+
+	// filePerms are the permissions of written lock files.
+	filePerms = 0600
+
+	// header is written at the top of lock files.
+	header = "# Generated by bundle-extract, do not edit. Run with --update-lock to update.\n"
+)
+
+// Config holds the lock file settings shared by the commands.
+type Config struct {
+	// File is the path of the lock file. Locking is disabled when empty.
+	File string `mapstructure:"lock-file"`
+
+	// Update resolves the bundles again and rewrites the lock file instead of reusing it.
+	Update bool `mapstructure:"update-lock"`
+}
+
+// Request identifies what the bundles of a lock file were resolved for.
+type Request struct {
+	Source              string `json:"source"`
+	Catalog             string `json:"catalog,omitempty"`
+	Channel             string `json:"channel,omitempty"`
+	ResolveDependencies bool   `json:"resolveDependencies,omitempty"`
+	Platform            string `json:"platform,omitempty"`
+}
+
+// Bundle is a resolved bundle pinned by a lock file.
+type Bundle struct {
+	Package string `json:"package,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Version string `json:"version,omitempty"`
+	Image   string `json:"image"`
+	Digest  string `json:"digest,omitempty"`
+
+	// Embedded records that the catalog embeds the manifests of the bundle, which is then built
+	// from them again rather than pulled.
+	Embedded bool `json:"embedded,omitempty"`
+}
+
+// File is the content of a lock file.
+type File struct {
+	Request       Request  `json:"request"`
+	CatalogDigest string   `json:"catalogDigest,omitempty"`
+	Bundles       []Bundle `json:"bundles"`
+}
+
+// New creates the lock file content of bundles resolved for req, given the digests
+// of the loaded bundle images in the same order as sources.
+func New(req Request, sources []catalog.BundleSource, digests []string) (*File, error) {
+	if len(sources) != len(digests) {
+		return nil, fmt.Errorf("got %d digests for %d bundles", len(digests), len(sources))
+	}
+
+	f := &File{
+		Request: req,
+		Bundles: make([]Bundle, 0, len(sources)),
+	}
+
+	for i, s := range sources {
+		f.CatalogDigest = s.CatalogDigest
+		f.Bundles = append(f.Bundles, Bundle{
+			Package:  s.Package,
+			Channel:  s.Channel,
+			Version:  s.Version,
+			Image:    s.Input,
+			Digest:   digests[i],
+			Embedded: len(s.Objects) > 0,
+		})
+	}
+
+	return f, nil
+}
+
+// Sources returns the bundle sources pinned by the lock file, without the manifests embedded
+// in the catalog.
+func (f *File) Sources() []catalog.BundleSource {
+	return slices.Map(f.Bundles, func(b Bundle) catalog.BundleSource {
+		return catalog.BundleSource{
+			Input:         b.Image,
+			Catalog:       f.Request.Catalog,
+			CatalogDigest: f.CatalogDigest,
+			Package:       b.Package,
+			Channel:       b.Channel,
+			Version:       b.Version,
+			Digest:        b.Digest,
+		}
+	})
+}
+
+// Read reads a lock file. It returns nil without error when the file does not exist.
+func Read(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	f := &File{}
+	if err := yaml.UnmarshalStrict(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// Write writes a lock file. An existing file with the same content is left untouched, so that
+// reusing a lock file does not require write access to it.
+func Write(path string, f *File) error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+
+	data = append([]byte(header), data...)
+
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	if err := os.WriteFile(path, data, filePerms); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	return nil
+}
+
+// Sources returns the bundle sources pinned by the lock file for req, or nil when locking is
+// disabled, the lock file does not exist yet or it is being updated, in which case the bundles
+// must be resolved. A lock file written for another request is an error unless it is being updated.
+// The manifests of embedded bundles are loaded from the catalog pinned by the lock file, unless
+// registryConfig.PullBundles is set.
+func (c Config) Sources(
+	ctx context.Context,
+	req Request,
+	registryConfig bundle.RegistryConfig,
+	tempDir string,
+) ([]catalog.BundleSource, error) {
+	if c.File == "" || c.Update {
+		return nil, nil
+	}
+
+	f, err := Read(c.File)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	if f.Request != req {
+		return nil, fmt.Errorf("lock file %s was written for another source, run with --update-lock to update it", c.File)
+	}
+
+	sources := f.Sources()
+	if registryConfig.PullBundles || !slices.Any(f.Bundles, func(b Bundle) bool { return b.Embedded }) {
+		return sources, nil
+	}
+
+	objects, err := catalog.EmbeddedObjects(ctx, f.Request.Catalog, f.CatalogDigest, registryConfig, tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the bundles embedded in catalog %s: %w", f.Request.Catalog, err)
+	}
+
+	for i, b := range f.Bundles {
+		if !b.Embedded {
+			continue
+		}
+
+		sources[i].Objects = objects[b.Image]
+		if sources[i].Objects == nil {
+			return nil, fmt.Errorf("bundle %s is not embedded in catalog %s, run with --update-lock to update it", b.Image, f.Request.Catalog)
+		}
+	}
+
+	return sources, nil
+}
+
+// Record writes the lock file of bundles resolved for req, given the digests of the
+// loaded bundle images. It does nothing when locking is disabled.
+func (c Config) Record(req Request, sources []catalog.BundleSource, digests []string) error {
+	if c.File == "" {
+		return nil
+	}
+
+	f, err := New(req, sources, digests)
+	if err != nil {
+		return err
+	}
+
+	return Write(c.File, f)
+}
@@ -0,0 +1,198 @@
+package lock_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/bundle"
+	"github.com/lburgazzoli/olm-extractor/pkg/catalog"
+	"github.com/lburgazzoli/olm-extractor/pkg/lock"
+
+	. "github.com/onsi/gomega"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestConfig(t *testing.T) {
+	request := lock.Request{
+		Source:  "my-operator:~1.2",
+		Catalog: "quay.io/example/catalog:latest",
+	}
+
+	sources := []catalog.BundleSource{{
+		Input:         "quay.io/example/my-operator-bundle:v1.2.3",
+		Catalog:       "quay.io/example/catalog:latest",
+		CatalogDigest: "sha256:catalog",
+		Package:       "my-operator",
+		Channel:       "stable",
+		Version:       "1.2.3",
+	}}
+
+	t.Run("resolves the bundles without a lock file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+
+		locked, err := c.Sources(t.Context(), request, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locked).To(BeNil())
+	})
+
+	t.Run("reuses the recorded bundles pinned by digest", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+
+		locked, err := c.Sources(t.Context(), request, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locked).To(HaveLen(1))
+		g.Expect(locked[0].Input).To(Equal(sources[0].Input))
+		g.Expect(locked[0].CatalogDigest).To(Equal("sha256:catalog"))
+		g.Expect(locked[0].Channel).To(Equal("stable"))
+		g.Expect(locked[0].Reference()).To(Equal("quay.io/example/my-operator-bundle@" + testDigest))
+	})
+
+	t.Run("fails for a lock file of another request", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+
+		other := request
+		other.Channel = "fast"
+
+		_, err := c.Sources(t.Context(), other, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).To(MatchError(ContainSubstring("--update-lock")))
+	})
+
+	t.Run("resolves the bundles again when updating", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+
+		c.Update = true
+		locked, err := c.Sources(t.Context(), request, bundle.RegistryConfig{}, t.TempDir())
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locked).To(BeNil())
+	})
+
+	t.Run("leaves an unchanged lock file untouched", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+		g.Expect(os.Chmod(c.File, 0400)).To(Succeed())
+
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+	})
+}
+
+// writeEmbeddedCatalog writes a local catalog whose single bundle embeds its CSV, and returns its path.
+func writeEmbeddedCatalog(t *testing.T, dir string, image string) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	cfg := declcfg.DeclarativeConfig{
+		Packages: []declcfg.Package{{Schema: declcfg.SchemaPackage, Name: "my-operator", DefaultChannel: "stable"}},
+		Channels: []declcfg.Channel{{
+			Schema:  declcfg.SchemaChannel,
+			Package: "my-operator",
+			Name:    "stable",
+			Entries: []declcfg.ChannelEntry{{Name: "my-operator.v1.2.3"}},
+		}},
+		Bundles: []declcfg.Bundle{{
+			Schema:  declcfg.SchemaBundle,
+			Package: "my-operator",
+			Name:    "my-operator.v1.2.3",
+			Image:   image,
+			Properties: []property.Property{
+				property.MustBuildPackage("my-operator", "1.2.3"),
+				property.MustBuildBundleObject([]byte(`{"apiVersion":"operators.coreos.com/v1alpha1","kind":"ClusterServiceVersion","metadata":{"name":"my-operator.v1.2.3"}}`)),
+			},
+		}},
+	}
+
+	path := filepath.Join(dir, "catalog.json")
+	f, err := os.Create(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(declcfg.WriteJSON(cfg, f)).To(Succeed())
+	g.Expect(f.Close()).To(Succeed())
+
+	return path
+}
+
+func TestConfigEmbedded(t *testing.T) {
+	// The bundle image does not exist, so bundles can only be built from the catalog
+	const image = "registry.invalid/example/my-operator-bundle@" + testDigest
+
+	record := func(t *testing.T, catalogPath string) (lock.Config, lock.Request) {
+		t.Helper()
+
+		g := NewWithT(t)
+
+		request := lock.Request{Source: "my-operator", Catalog: catalogPath}
+
+		sources, err := catalog.ResolveBundles(
+			t.Context(), request.Source, catalogPath, "", false, bundle.RegistryConfig{}, t.TempDir(),
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(HaveLen(1))
+		g.Expect(sources[0].Objects).ToNot(BeEmpty())
+
+		c := lock.Config{File: filepath.Join(t.TempDir(), lock.DefaultFile)}
+		g.Expect(c.Record(request, sources, []string{testDigest})).To(Succeed())
+
+		return c, request
+	}
+
+	t.Run("builds the bundles from the catalog again", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c, request := record(t, writeEmbeddedCatalog(t, t.TempDir(), image))
+
+		locked, err := c.Sources(t.Context(), request, bundle.RegistryConfig{}, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locked).To(HaveLen(1))
+		g.Expect(locked[0].Objects).ToNot(BeEmpty())
+
+		b, digest, err := locked[0].LoadBundle(t.Context(), bundle.RegistryConfig{}, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("my-operator.v1.2.3"))
+		g.Expect(digest).To(Equal(testDigest))
+	})
+
+	t.Run("does not load the catalog when pulling bundles", func(t *testing.T) {
+		g := NewWithT(t)
+
+		path := writeEmbeddedCatalog(t, t.TempDir(), image)
+		c, request := record(t, path)
+		g.Expect(os.Remove(path)).To(Succeed())
+
+		locked, err := c.Sources(t.Context(), request, bundle.RegistryConfig{PullBundles: true}, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locked).To(HaveLen(1))
+		g.Expect(locked[0].Objects).To(BeEmpty())
+	})
+
+	t.Run("fails when the catalog no longer embeds the bundle", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		c, request := record(t, writeEmbeddedCatalog(t, dir, image))
+		writeEmbeddedCatalog(t, dir, "registry.invalid/example/other-bundle@"+testDigest)
+
+		_, err := c.Sources(t.Context(), request, bundle.RegistryConfig{}, t.TempDir())
+		g.Expect(err).To(MatchError(ContainSubstring("--update-lock")))
+	})
+}
@@ -0,0 +1,97 @@
+// Package overrides applies Subscription-style configuration to operator deployments.
+//
+// OLM lets users customize the deployments of an operator through the spec.config of its
+// Subscription. This package applies the same configuration to extracted deployments, with the
+// merge semantics of OLM, as it uses the same injection functions:
+//   - env, volumes and volumeMounts replace the entries with the same name and append the others
+//   - envFrom and tolerations append the entries not already present
+//   - resources replace those of every container, nodeSelector that of the pod
+//   - affinity replaces the node, pod and pod anti affinities it sets
+//   - annotations are added to the deployment and its pod template, without overriding existing ones
+//
+// As with OLM, the selector field is ignored.
+package overrides
+
+import (
+	"fmt"
+	"os"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	"github.com/operator-framework/operator-lifecycle-manager/pkg/controller/operators/olm/overrides/inject"
+	"sigs.k8s.io/yaml"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// Config overrides the deployments of an operator as the spec.config of an OLM Subscription does.
+type Config struct {
+	// Deployment restricts the overrides to the deployment with this name in the CSV install
+	// strategy. The overrides apply to all deployments when empty.
+	Deployment string `json:"deployment,omitempty"`
+
+	operatorsv1alpha1.SubscriptionConfig `json:",inline"`
+}
+
+// Load reads a config file, in YAML or JSON.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Apply applies the overrides to a deployment created from the CSV install strategy.
+// Deployments not targeted by the config, or a nil config, are left unchanged.
+func (c *Config) Apply(deployment *appsv1.Deployment) error {
+	if c == nil || (c.Deployment != "" && c.Deployment != deployment.Name) {
+		return nil
+	}
+
+	podSpec := &deployment.Spec.Template.Spec
+
+	// Same order as OLM's deployment initializer
+	if err := inject.InjectEnvIntoDeployment(podSpec, c.Env); err != nil {
+		return fmt.Errorf("failed to inject env into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectEnvFromIntoDeployment(podSpec, c.EnvFrom); err != nil {
+		return fmt.Errorf("failed to inject envFrom into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectVolumesIntoDeployment(podSpec, c.Volumes); err != nil {
+		return fmt.Errorf("failed to inject volumes into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectVolumeMountsIntoDeployment(podSpec, c.VolumeMounts); err != nil {
+		return fmt.Errorf("failed to inject volumeMounts into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectTolerationsIntoDeployment(podSpec, c.Tolerations); err != nil {
+		return fmt.Errorf("failed to inject tolerations into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectResourcesIntoDeployment(podSpec, c.Resources); err != nil {
+		return fmt.Errorf("failed to inject resources into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectNodeSelectorIntoDeployment(podSpec, c.NodeSelector); err != nil {
+		return fmt.Errorf("failed to inject nodeSelector into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.OverrideDeploymentAffinity(podSpec, c.Affinity); err != nil {
+		return fmt.Errorf("failed to inject affinity into deployment %s: %w", deployment.Name, err)
+	}
+
+	if err := inject.InjectAnnotationsIntoDeployment(deployment, c.Annotations); err != nil {
+		return fmt.Errorf("failed to inject annotations into deployment %s: %w", deployment.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package overrides_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/overrides"
+
+	. "github.com/onsi/gomega"
+)
+
+func newDeployment(name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"owner": "bundle"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "manager",
+						Image: "quay.io/example/operator:v1.0.0",
+						Env: []corev1.EnvVar{
+							{Name: "LOG_LEVEL", Value: "info"},
+							{Name: "WATCH_NAMESPACE", Value: ""},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("loads a subscription config", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c, err := overrides.Load(writeConfig(t, `
+deployment: example-operator
+env:
+  - name: LOG_LEVEL
+    value: debug
+nodeSelector:
+  kubernetes.io/os: linux
+`))
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(c.Deployment).To(Equal("example-operator"))
+		g.Expect(c.Env).To(ConsistOf(corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}))
+		g.Expect(c.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := overrides.Load(writeConfig(t, "nodeSelectors: {}\n"))
+		g.Expect(err).To(MatchError(ContainSubstring("failed to parse config file")))
+	})
+
+	t.Run("fails on missing files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := overrides.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		g.Expect(err).To(MatchError(ContainSubstring("failed to read config file")))
+	})
+}
+
+func TestApply(t *testing.T) {
+	t.Run("merges the config as OLM does", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := &overrides.Config{}
+		c.Env = []corev1.EnvVar{
+			{Name: "LOG_LEVEL", Value: "debug"},
+			{Name: "HTTP_PROXY", Value: "http://proxy:3128"},
+		}
+		c.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+		c.Resources = &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		}
+		c.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+		c.Annotations = map[string]string{"owner": "config", "team": "platform"}
+
+		deployment := newDeployment("example-operator")
+		g.Expect(c.Apply(deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		g.Expect(podSpec.Containers[0].Env).To(ConsistOf(
+			corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"},
+			corev1.EnvVar{Name: "WATCH_NAMESPACE", Value: ""},
+			corev1.EnvVar{Name: "HTTP_PROXY", Value: "http://proxy:3128"},
+		))
+		g.Expect(podSpec.Tolerations).To(HaveLen(1))
+		g.Expect(podSpec.Containers[0].Resources.Limits).To(HaveKey(corev1.ResourceMemory))
+		g.Expect(podSpec.NodeSelector).To(Equal(map[string]string{"kubernetes.io/os": "linux"}))
+
+		// Existing annotations are kept
+		g.Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("owner", "bundle"))
+		g.Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("team", "platform"))
+		g.Expect(deployment.Annotations).To(HaveKeyWithValue("team", "platform"))
+	})
+
+	t.Run("only applies to the targeted deployment", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := &overrides.Config{Deployment: "example-operator"}
+		c.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+
+		other := newDeployment("example-webhook")
+		g.Expect(c.Apply(other)).To(Succeed())
+		g.Expect(other).To(Equal(newDeployment("example-webhook")))
+
+		targeted := newDeployment("example-operator")
+		g.Expect(c.Apply(targeted)).To(Succeed())
+		g.Expect(targeted.Spec.Template.Spec.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+	})
+
+	t.Run("leaves deployments unchanged without config", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var c *overrides.Config
+
+		deployment := newDeployment("example-operator")
+		g.Expect(c.Apply(deployment)).To(Succeed())
+		g.Expect(deployment).To(Equal(newDeployment("example-operator")))
+	})
+}
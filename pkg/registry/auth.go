@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	// registryAuthFileEnv overrides the location of the auth file, as in containers tools.
+	registryAuthFileEnv = "REGISTRY_AUTH_FILE"
+
+	// dockerHubRegistry is the registry name containers tools use for Docker Hub credentials.
+	dockerHubRegistry = "docker.io"
+)
+
+// DefaultAuthFilePath returns the auth file used by containers tools such as podman:
+// $REGISTRY_AUTH_FILE, then $XDG_RUNTIME_DIR/containers/auth.json, then the per-user
+// $XDG_CONFIG_HOME/containers/auth.json. Returns an empty string if none exists.
+// Docker's config.json is read by the default keychain and needs no auth file.
+func DefaultAuthFilePath() string {
+	if path := os.Getenv(registryAuthFileEnv); path != "" {
+		return path
+	}
+
+	candidates := make([]string, 0, 2) //nolint:mnd
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "containers", "auth.json"))
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "containers", "auth.json"))
+	}
+
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// authFileKeychain resolves credentials from a containers auth file, which uses the format of
+// Docker's config.json, including credential helpers.
+type authFileKeychain struct {
+	file *configfile.ConfigFile
+}
+
+// loadAuthFile loads an auth file as a keychain.
+func loadAuthFile(path string) (*authFileKeychain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry auth file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	file, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry auth file %s: %w", path, err)
+	}
+
+	return &authFileKeychain{file: file}, nil
+}
+
+// Resolve returns the credentials of the most specific entry matching target, as containers
+// tools do: entries may be keyed by registry or by a namespace or repository within it.
+func (k *authFileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	for _, key := range authKeys(target) {
+		cfg, err := k.file.GetAuthConfig(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credentials for %s: %w", key, err)
+		}
+
+		// GetAuthConfig fills the server address even when there are no credentials
+		cfg.ServerAddress = ""
+		if cfg == (types.AuthConfig{}) {
+			continue
+		}
+
+		return authn.FromConfig(authn.AuthConfig{
+			Username:      cfg.Username,
+			Password:      cfg.Password,
+			Auth:          cfg.Auth,
+			IdentityToken: cfg.IdentityToken,
+			RegistryToken: cfg.RegistryToken,
+		}), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+// authKeys returns the auth file keys matching target, from the most to the least specific:
+// the repository, its parent namespaces and the registry. Docker Hub entries are also looked
+// up by docker.io, the name used by containers tools, and by Docker's legacy key.
+func authKeys(target authn.Resource) []string {
+	registry := target.RegistryStr()
+	path := strings.TrimPrefix(target.String(), registry)
+
+	registries := []string{registry}
+	if registry == name.DefaultRegistry {
+		registries = []string{dockerHubRegistry, registry}
+	}
+
+	keys := make([]string, 0)
+	for _, r := range registries {
+		for p := path; p != ""; p = p[:max(strings.LastIndex(p, "/"), 0)] {
+			keys = append(keys, r+p)
+		}
+
+		keys = append(keys, r)
+	}
+
+	if registry == name.DefaultRegistry {
+		keys = append(keys, authn.DefaultAuthKey)
+	}
+
+	return keys
+}
+
+// keychain returns the keychain resolving credentials of registries without explicit ones:
+// the auth file, when configured or found in its default locations, then the default keychain.
+func (o *options) keychain() (authn.Keychain, error) {
+	path := o.authFile
+	if path == "" {
+		path = DefaultAuthFilePath()
+	}
+
+	if path == "" {
+		return authn.DefaultKeychain, nil
+	}
+
+	file, err := loadAuthFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return authn.NewMultiKeychain(file, authn.DefaultKeychain), nil
+}
+
+// authenticator returns the explicit credentials for registry, if any: credentials configured
+// for the registry itself, then the global credentials, which belong to the source registry and
+// are only sent to it. Returns nil when the keychain should be used.
+func (o *options) authenticator(registry string, sourceRegistry string) authn.Authenticator {
+	host := o.hosts[registry]
+
+	switch {
+	case host.Token != "":
+		return &authn.Bearer{Token: host.Token}
+	case host.Username != "" && host.Password != "":
+		return &authn.Basic{Username: host.Username, Password: host.Password}
+	case registry != sourceRegistry:
+		return nil
+	case o.token != "":
+		return &authn.Bearer{Token: o.token}
+	case o.username != "" && o.password != "":
+		return &authn.Basic{Username: o.username, Password: o.password}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package registry_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// requireAuthorization only serves requests carrying the given Authorization header.
+func requireAuthorization(authorization string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != authorization {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeAuthFile writes a containers auth file with basic credentials for key.
+func writeAuthFile(t *testing.T, key string, username string, password string) string {
+	t.Helper()
+
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+
+	path := filepath.Join(t.TempDir(), "auth.json")
+	content := `{"auths":{"` + key + `":{"auth":"` + auth + `"}}}`
+	NewWithT(t).Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+
+	return path
+}
+
+func TestExtractImageAuth(t *testing.T) {
+	// Isolate from the credentials of the environment
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	extract := func(t *testing.T, imageRef string, opts ...registry.Option) error {
+		t.Helper()
+
+		resource, err := registry.ExtractImage(t.Context(), imageRef,
+			append(opts, registry.WithPathPrefixes([]string{"/manifests/"}))...,
+		)
+		t.Cleanup(resource.Cleanup)
+
+		return err
+	}
+
+	t.Run("fails without credentials", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", requireAuthorization(basic))
+
+		g.Expect(extract(t, ref)).To(MatchError(ContainSubstring("failed to pull image")))
+	})
+
+	t.Run("reads namespace credentials from an auth file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "team/bundle", requireAuthorization(basic))
+		host := strings.SplitN(ref, "/", 2)[0]
+		authFile := writeAuthFile(t, host+"/team", "user", "pass")
+
+		g.Expect(extract(t, ref, registry.WithAuthFile(authFile))).To(Succeed())
+	})
+
+	t.Run("honors REGISTRY_AUTH_FILE", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", requireAuthorization(basic))
+		host := strings.SplitN(ref, "/", 2)[0]
+		t.Setenv("REGISTRY_AUTH_FILE", writeAuthFile(t, host, "user", "pass"))
+
+		g.Expect(extract(t, ref)).To(Succeed())
+	})
+
+	t.Run("sends per-registry bearer tokens", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", requireAuthorization("Bearer secret"))
+		host := strings.SplitN(ref, "/", 2)[0]
+
+		g.Expect(extract(t, ref, registry.WithHostConfig(host, registry.HostConfig{Token: "secret"}))).To(Succeed())
+	})
+
+	t.Run("prefers per-registry credentials over global ones", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", requireAuthorization(basic))
+		host := strings.SplitN(ref, "/", 2)[0]
+
+		g.Expect(extract(t, ref,
+			registry.WithAuth("other", "wrong"),
+			registry.WithHostConfig(host, registry.HostConfig{Username: "user", Password: "pass"}),
+		)).To(Succeed())
+	})
+}
@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
+)
+
+const (
+	// imagesKind holds extracted image content, keyed by manifest digest and path prefixes.
+	imagesKind = "images"
+
+	// layersKind holds compressed layer blobs, keyed by layer digest.
+	layersKind = "layers"
+
+	// prefixKeyLength is the number of hex characters of the path prefixes hash used in keys.
+	prefixKeyLength = 12
+)
+
+// cachedImage wraps an image so that its layers are served from the cache.
+type cachedImage struct {
+	v1.Image
+
+	cache *cache.Cache
+}
+
+// Layers returns the image layers, backed by the cache.
+func (i *cachedImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make([]v1.Layer, 0, len(layers))
+	for _, l := range layers {
+		cached = append(cached, &cachedLayer{Layer: l, cache: i.cache})
+	}
+
+	return cached, nil
+}
+
+// cachedLayer downloads a layer blob into the cache on first access and reads it from there.
+type cachedLayer struct {
+	v1.Layer
+
+	cache *cache.Cache
+	once  sync.Once
+	local v1.Layer
+	err   error
+}
+
+// Compressed returns the compressed layer content from the cache.
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	local, err := l.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	return local.Compressed()
+}
+
+// Uncompressed returns the uncompressed layer content from the cache.
+func (l *cachedLayer) Uncompressed() (io.ReadCloser, error) {
+	local, err := l.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	return local.Uncompressed()
+}
+
+// resolve ensures the layer blob is cached and returns a layer reading from it.
+func (l *cachedLayer) resolve() (v1.Layer, error) {
+	l.once.Do(func() {
+		l.local, l.err = cacheLayer(l.cache, l.Layer)
+	})
+
+	return l.local, l.err
+}
+
+// cacheLayer stores the compressed blob of layer in the cache unless already present.
+// The remote layer verifies the blob digest while it is read, so only intact blobs are stored.
+func cacheLayer(c *cache.Cache, layer v1.Layer) (v1.Layer, error) {
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer digest: %w", err)
+	}
+
+	path, ok := c.Lookup(layersKind, digest.Hex)
+	if !ok {
+		path, err = c.Store(layersKind, digest.Hex, func(path string) error {
+			return downloadLayer(layer, path)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to cache layer %s: %w", digest, err)
+		}
+	}
+
+	local, err := tarball.LayerFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached layer %s: %w", digest, err)
+	}
+
+	return local, nil
+}
+
+// downloadLayer writes the compressed layer blob to path.
+func downloadLayer(layer v1.Layer, path string) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to get layer content: %w", err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create layer file: %w", err)
+	}
+
+	_, err = io.Copy(f, rc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to download layer: %w", err)
+	}
+
+	return nil
+}
+
+// extractCached extracts an image into the cache, or returns the previously extracted content.
+// Extracted content depends on the path prefixes as well, so they are part of the key.
+func extractCached(c *cache.Cache, img v1.Image, digest v1.Hash, pathPrefixes []string) (string, error) {
+	key := imageKey(digest, pathPrefixes)
+
+	if dir, ok := c.Lookup(imagesKind, key); ok {
+		return dir, nil
+	}
+
+	dir, err := c.Store(imagesKind, key, func(path string) error {
+		if err := os.Mkdir(path, dirPerms); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		extractor := tarutil.NewExtractor(path, dirPerms, tarutil.DefaultLimits)
+
+		return unpackImage(&cachedImage{Image: img, cache: c}, extractor, pathPrefixes)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to extract image: %w", err)
+	}
+
+	return dir, nil
+}
+
+// imageKey returns the cache key of an image extracted with the given path prefixes.
+func imageKey(digest v1.Hash, pathPrefixes []string) string {
+	prefixes := append([]string{}, pathPrefixes...)
+	sort.Strings(prefixes)
+
+	sum := sha256.Sum256([]byte(strings.Join(prefixes, "\n")))
+
+	return digest.Hex + "-" + hex.EncodeToString(sum[:])[:prefixKeyLength]
+}
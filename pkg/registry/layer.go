@@ -4,8 +4,6 @@ import (
 	"archive/tar"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -14,121 +12,116 @@ import (
 	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
 )
 
-// hasAllRequiredContent checks if the extracted directory contains all required paths.
-// Returns true if at least one file/directory exists for each required path prefix.
-func hasAllRequiredContent(dir string, pathPrefixes []string) bool {
-	return slices.All(pathPrefixes, func(prefix string) bool {
-		// Remove leading slash for filepath.Join
-		cleanPrefix := strings.TrimPrefix(prefix, "/")
-		path := filepath.Join(dir, cleanPrefix)
+// dirPerms are the permissions of directories created while extracting layers.
+const dirPerms = 0750
 
-		// Check if path exists (file or directory)
-		_, err := os.Stat(path)
+// isRelevantPath checks if a tar entry matches any of the path prefixes.
+// Whiteouts are matched by the path they delete, which may also be a parent directory of a prefix,
+// such as the deletion of the whole manifests directory.
+func isRelevantPath(name string, pathPrefixes []string) bool {
+	if isWhiteout(name) {
+		target := whiteoutTarget(name)
 
-		return err == nil
-	})
-}
+		return slices.Any(pathPrefixes, func(prefix string) bool {
+			cleanPrefix := strings.TrimPrefix(prefix, "/")
 
-// layerContainsRelevantPaths checks if a layer contains any files matching the given path prefixes.
-// This function performs a quick scan of tar headers without extracting file contents.
-func layerContainsRelevantPaths(layer v1.Layer, pathPrefixes []string) (bool, error) {
-	// Get layer content (already uncompressed)
-	rc, err := layer.Uncompressed()
-	if err != nil {
-		return false, fmt.Errorf("failed to get layer content: %w", err)
+			return strings.HasPrefix(target+"/", cleanPrefix) || strings.HasPrefix(cleanPrefix, target+"/")
+		})
 	}
-	defer func() {
-		_ = rc.Close()
-	}()
 
-	// Scan tar headers
-	tr := tar.NewReader(rc)
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return false, fmt.Errorf("failed to read tar header: %w", err)
-		}
+	// Handle both with and without leading slash, and the prefix directory itself
+	entry := cleanEntryName(name) + "/"
 
-		// Check if this file matches any of the path prefixes
-		// Handle both with and without leading slash
-		for _, prefix := range pathPrefixes {
-			// Try with leading slash
-			if strings.HasPrefix(header.Name, prefix) {
-				return true, nil
-			}
-			// Try without leading slash
-			cleanPrefix := strings.TrimPrefix(prefix, "/")
-			if strings.HasPrefix(header.Name, cleanPrefix) {
-				return true, nil
-			}
-		}
-	}
-
-	return false, nil
+	return slices.Any(pathPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(entry, strings.TrimPrefix(prefix, "/"))
+	})
 }
 
-// unpackImage extracts layers from a container image to a target directory.
-// If pathPrefixes is provided, only layers containing files with those prefixes are extracted.
-// Layers are scanned in reverse order (most recent first) for efficiency.
-func unpackImage(img v1.Image, targetDir string, pathPrefixes []string) error {
+// unpackImage extracts layers from a container image with w, reading each layer once.
+// If pathPrefixes is provided, only entries under those prefixes are extracted, along with
+// whiteouts applying to them.
+// Layers are read in reverse order (most recent first), applying whiteouts and opaque directories
+// so that the extracted tree matches the final filesystem of the image.
+// Lower layers may still add files next to those of upper layers, so reading only stops early
+// once upper layers deleted or marked opaque every prefix.
+func unpackImage(img v1.Image, w entryWriter, pathPrefixes []string) error {
 	// Get the filesystem layers
 	layers, err := img.Layers()
 	if err != nil {
 		return fmt.Errorf("failed to get image layers: %w", err)
 	}
 
-	// Scan layers in reverse order (most recent first)
-	extractedCount := 0
+	// Read layers in reverse order (most recent first)
+	ov := newOverlay()
+	found := false
 	for i := len(layers) - 1; i >= 0; i-- {
-		layer := layers[i]
-
-		hasContent, err := layerContainsRelevantPaths(layer, pathPrefixes)
+		relevant, err := extractLayer(layers[i], w, ov, pathPrefixes)
 		if err != nil {
-			return fmt.Errorf("failed to inspect layer: %w", err)
-		}
-
-		if !hasContent {
-			continue
-		}
-
-		if err := extractLayer(layer, targetDir); err != nil {
 			return fmt.Errorf("failed to extract layer: %w", err)
 		}
 
-		extractedCount++
+		found = found || relevant
 
-		if hasAllRequiredContent(targetDir, pathPrefixes) {
+		if len(pathPrefixes) > 0 && slices.All(pathPrefixes, ov.sealed) {
 			break
 		}
 	}
 
 	// If we didn't find any relevant content, something is wrong
-	if extractedCount == 0 {
+	if !found {
 		return fmt.Errorf("no layers found containing paths: %v", pathPrefixes)
 	}
 
+	if err := w.Verify(); err != nil {
+		return fmt.Errorf("failed to extract image: %w", err)
+	}
+
 	return nil
 }
 
-// extractLayer extracts a single image layer to the target directory.
-func extractLayer(layer v1.Layer, targetDir string) error {
-	const dirPerms = 0750
-
+// extractLayer extracts the entries of a single image layer matching pathPrefixes with w, and
+// returns true if the layer had any. The writer enforces the extraction limits across all layers
+// of the image.
+// Entries hidden by the layers extracted before are skipped, and the whiteouts of the layer are
+// recorded in the overlay for the layers below it.
+func extractLayer(layer v1.Layer, w entryWriter, ov *overlay, pathPrefixes []string) (bool, error) {
 	// Get layer content (already uncompressed)
 	rc, err := layer.Uncompressed()
 	if err != nil {
-		return fmt.Errorf("failed to get layer content: %w", err)
+		return false, fmt.Errorf("failed to get layer content: %w", err)
 	}
 	defer func() {
 		_ = rc.Close()
 	}()
 
-	if err := tarutil.ExtractAll(rc, targetDir, dirPerms); err != nil {
-		return fmt.Errorf("failed to extract tar archive: %w", err)
+	relevant := false
+
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, &tarutil.CorruptArchiveError{Err: fmt.Errorf("failed to read tar header: %w", err)}
+		}
+
+		if len(pathPrefixes) > 0 && !isRelevantPath(header.Name, pathPrefixes) {
+			continue
+		}
+
+		relevant = true
+
+		if !ov.apply(header) {
+			continue
+		}
+
+		if err := w.Extract(header, tr); err != nil {
+			return false, fmt.Errorf("failed to extract tar archive: %w", err)
+		}
 	}
 
-	return nil
+	ov.commit()
+
+	return relevant, nil
 }
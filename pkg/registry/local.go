@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
+)
+
+// Transport prefixes of local image sources, following the containers/image naming.
+const (
+	// OCITransport references an OCI image layout directory: oci:/path[:tag].
+	OCITransport = "oci:"
+
+	// OCIArchiveTransport references a tarball of an OCI image layout: oci-archive:/file.tar[:tag].
+	OCIArchiveTransport = "oci-archive:"
+
+	// DockerArchiveTransport references a `docker save` tarball: docker-archive:/file.tar[:image].
+	DockerArchiveTransport = "docker-archive:"
+)
+
+// ociRefNameAnnotation is the index annotation holding the tag of an image in an OCI layout.
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// IsLocalReference returns true if imageRef uses one of the local transport prefixes.
+func IsLocalReference(imageRef string) bool {
+	return strings.HasPrefix(imageRef, OCITransport) ||
+		strings.HasPrefix(imageRef, OCIArchiveTransport) ||
+		strings.HasPrefix(imageRef, DockerArchiveTransport)
+}
+
+// loadLocalImage opens the image of a local reference.
+// OCI archives are unpacked to a temporary directory first; the returned cleanup function
+// removes it and must be called once the image content has been read.
+func loadLocalImage(imageRef string, tempDir string, platform v1.Platform) (v1.Image, func(), error) {
+	noop := func() {}
+
+	switch {
+	case strings.HasPrefix(imageRef, OCIArchiveTransport):
+		path, tag := splitLocalReference(strings.TrimPrefix(imageRef, OCIArchiveTransport))
+
+		dir, err := os.MkdirTemp(tempDir, "oci-archive-*")
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+
+		cleanup := func() {
+			_ = os.RemoveAll(dir)
+		}
+
+		if err := unpackArchive(path, dir); err != nil {
+			return nil, cleanup, err
+		}
+
+		img, err := layoutImage(dir, tag, platform)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to read OCI archive %s: %w", path, err)
+		}
+
+		return img, cleanup, nil
+
+	case strings.HasPrefix(imageRef, OCITransport):
+		path, tag := splitLocalReference(strings.TrimPrefix(imageRef, OCITransport))
+
+		img, err := layoutImage(path, tag, platform)
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to read OCI layout %s: %w", path, err)
+		}
+
+		return img, noop, nil
+
+	case strings.HasPrefix(imageRef, DockerArchiveTransport):
+		path, image := splitLocalReference(strings.TrimPrefix(imageRef, DockerArchiveTransport))
+
+		var tag *name.Tag
+		if image != "" {
+			t, err := name.NewTag(image)
+			if err != nil {
+				return nil, noop, fmt.Errorf("invalid image %q in docker archive reference: %w", image, err)
+			}
+			tag = &t
+		}
+
+		img, err := tarball.ImageFromPath(path, tag)
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to read docker archive %s: %w", path, err)
+		}
+
+		return img, noop, nil
+
+	default:
+		return nil, noop, fmt.Errorf("unsupported local image reference %q", imageRef)
+	}
+}
+
+// splitLocalReference splits the path of a local reference from the optional tag or image name
+// following the first colon.
+//
+//nolint:nonamedreturns // Named returns document which part is which
+func splitLocalReference(ref string) (path string, tag string) {
+	path, tag, _ = strings.Cut(ref, ":")
+
+	return path, tag
+}
+
+// unpackArchive extracts an OCI archive to dir.
+func unpackArchive(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open OCI archive: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if err := tarutil.ExtractAll(f, dir, dirPerms); err != nil {
+		return fmt.Errorf("failed to extract OCI archive %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// layoutImage selects an image from an OCI layout directory.
+// With a tag, the manifest annotated with that ref name is selected, otherwise the layout must
+// hold a single manifest. Multi-platform manifests resolve to the image of platform.
+func layoutImage(dir string, tag string, platform v1.Platform) (v1.Image, error) {
+	idx, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var desc *v1.Descriptor
+
+	switch {
+	case tag != "":
+		for i := range manifest.Manifests {
+			if manifest.Manifests[i].Annotations[ociRefNameAnnotation] == tag {
+				desc = &manifest.Manifests[i]
+
+				break
+			}
+		}
+
+		if desc == nil {
+			return nil, fmt.Errorf("no image tagged %q", tag)
+		}
+	case len(manifest.Manifests) == 1:
+		desc = &manifest.Manifests[0]
+	default:
+		return nil, fmt.Errorf("layout holds %d images, a tag is required", len(manifest.Manifests))
+	}
+
+	if desc.MediaType.IsIndex() {
+		child, err := idx.ImageIndex(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", desc.Digest, err)
+		}
+
+		return platformImage(child, platform)
+	}
+
+	return idx.Image(desc.Digest)
+}
@@ -0,0 +1,133 @@
+package registry_test
+
+import (
+	"archive/tar"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// writeLayout writes an OCI layout holding img, tagged with tag, and returns its directory.
+func writeLayout(t *testing.T, img v1.Image, tag string) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+
+	path, err := layout.Write(dir, empty.Index)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(path.AppendImage(img, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": tag,
+	}))).To(Succeed())
+
+	return dir
+}
+
+// writeArchive writes the content of dir as a tarball and returns its path.
+func writeArchive(t *testing.T, dir string) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	archive := filepath.Join(t.TempDir(), "image.tar")
+
+	f, err := os.Create(archive)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tw := tar.NewWriter(f)
+	g.Expect(tw.AddFS(os.DirFS(dir))).To(Succeed())
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(f.Close()).To(Succeed())
+
+	return archive
+}
+
+func TestExtractImageLocal(t *testing.T) {
+	g := NewWithT(t)
+
+	img, err := mutate.AppendLayers(empty.Image, newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	digest, err := img.Digest()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	layoutDir := writeLayout(t, img, "v1.0.0")
+
+	dockerArchive := filepath.Join(t.TempDir(), "bundle.tar")
+	tag, err := name.NewTag("example.com/bundle:v1.0.0")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tarball.WriteToFile(dockerArchive, tag, img)).To(Succeed())
+
+	tests := []struct {
+		name     string
+		imageRef string
+	}{
+		{name: "OCI layout", imageRef: "oci:" + layoutDir},
+		{name: "OCI layout with tag", imageRef: "oci:" + layoutDir + ":v1.0.0"},
+		{name: "OCI archive", imageRef: "oci-archive:" + writeArchive(t, layoutDir)},
+		{name: "docker archive", imageRef: "docker-archive:" + dockerArchive},
+		{name: "docker archive with image", imageRef: "docker-archive:" + dockerArchive + ":example.com/bundle:v1.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			resource, err := registry.ExtractImage(t.Context(), tt.imageRef,
+				registry.WithTempDir(t.TempDir()),
+				registry.WithPathPrefixes([]string{"/manifests/"}),
+			)
+			defer resource.Cleanup()
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(resource.Digest()).To(Equal(digest.String()))
+			g.Expect(resource.Source()).To(Equal(tt.imageRef))
+			g.Expect(resource.FromMirror()).To(BeFalse())
+
+			data, err := fs.ReadFile(resource.FS(), "manifests/csv.yaml")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(data)).To(Equal("kind: CSV"))
+		})
+	}
+
+	t.Run("fails for an unknown tag", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resource, err := registry.ExtractImage(t.Context(), "oci:"+layoutDir+":v2.0.0")
+		defer resource.Cleanup()
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`no image tagged "v2.0.0"`))
+	})
+
+	t.Run("removes the unpacked OCI archive", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tempDir := t.TempDir()
+
+		resource, err := registry.ExtractImage(t.Context(), "oci-archive:"+writeArchive(t, layoutDir),
+			registry.WithTempDir(tempDir),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		resource.Cleanup()
+
+		entries, err := fs.ReadDir(os.DirFS(tempDir), ".")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(BeEmpty())
+	})
+}
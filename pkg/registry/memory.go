@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/memfs"
+	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
+)
+
+// entryWriter writes the entries of image layers to their destination.
+type entryWriter interface {
+	// Extract writes a single entry, reading its content from tr.
+	Extract(header *tar.Header, tr *tar.Reader) error
+	// Verify checks the written content once all layers have been extracted.
+	Verify() error
+}
+
+// memoryWriter writes the entries of image layers to an in-memory file system, enforcing the
+// same limits as extraction to disk.
+// The file system has no links: hardlinks copy the content of their source, and symlinks are
+// resolved once all layers are extracted by copying the content of their target.
+type memoryWriter struct {
+	fs       *memfs.FS
+	usage    *tarutil.Usage
+	symlinks map[string]string
+}
+
+// newMemoryWriter creates a memoryWriter enforcing limits.
+func newMemoryWriter(limits tarutil.Limits) *memoryWriter {
+	return &memoryWriter{
+		fs:       memfs.New(),
+		usage:    tarutil.NewUsage(limits),
+		symlinks: make(map[string]string),
+	}
+}
+
+// Extract writes a single tar entry to the file system.
+// Entries other than directories, regular files and links are skipped.
+func (w *memoryWriter) Extract(header *tar.Header, tr *tar.Reader) error {
+	name, err := memoryPath(header.Name)
+	if err != nil {
+		return &tarutil.UnsafeEntryError{Name: header.Name, Reason: err.Error()}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := w.usage.Add(header, 0); err != nil {
+			return err
+		}
+
+		if err := w.fs.MkdirAll(name); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+	case tar.TypeReg:
+		if err := w.usage.Add(header, header.Size); err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return &tarutil.CorruptArchiveError{Err: fmt.Errorf("failed to read %s: %w", header.Name, err)}
+		}
+
+		if err := w.writeFile(name, data, header.FileInfo().Mode()); err != nil {
+			return err
+		}
+
+	case tar.TypeSymlink:
+		if path.IsAbs(header.Linkname) {
+			return &tarutil.UnsafeEntryError{Name: header.Name, Reason: "absolute symlink target " + header.Linkname}
+		}
+
+		target, err := memoryPath(path.Join(path.Dir(name), header.Linkname))
+		if err != nil {
+			return &tarutil.UnsafeEntryError{Name: header.Name, Reason: "symlink target " + header.Linkname + " escapes the image root"}
+		}
+
+		if err := w.usage.Add(header, 0); err != nil {
+			return err
+		}
+
+		w.symlinks[name] = target
+
+	case tar.TypeLink:
+		source, err := memoryPath(header.Linkname)
+		if err != nil {
+			return &tarutil.UnsafeEntryError{Name: header.Name, Reason: "hardlink target " + header.Linkname + " escapes the image root"}
+		}
+
+		data, err := w.fs.ReadFile(source)
+		if err != nil {
+			return &tarutil.CorruptArchiveError{Err: fmt.Errorf("hardlink %s to missing file %s", header.Name, header.Linkname)}
+		}
+
+		if err := w.usage.Add(header, int64(len(data))); err != nil {
+			return err
+		}
+
+		if err := w.writeFile(name, data, header.FileInfo().Mode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify resolves the recorded symlinks by copying the content of their targets.
+// Targets may be other symlinks, so resolution is repeated until no more progress is made.
+// Symlinks whose target does not exist are dropped, as they would be unreadable on disk.
+func (w *memoryWriter) Verify() error {
+	for len(w.symlinks) > 0 {
+		resolved := 0
+
+		for _, name := range w.pendingSymlinks() {
+			info, err := fs.Stat(w.fs, w.symlinks[name])
+			if err != nil {
+				continue
+			}
+
+			if err := w.copy(w.symlinks[name], name, info); err != nil {
+				return fmt.Errorf("failed to resolve symlink %s: %w", name, err)
+			}
+
+			delete(w.symlinks, name)
+			resolved++
+		}
+
+		if resolved == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// FS returns the file system the entries were written to.
+func (w *memoryWriter) FS() fs.FS {
+	return w.fs
+}
+
+// writeFile writes a regular file, replacing a symlink recorded at the same path.
+func (w *memoryWriter) writeFile(name string, data []byte, mode fs.FileMode) error {
+	delete(w.symlinks, name)
+
+	if err := w.fs.WriteFile(name, data, mode); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// pendingSymlinks returns the paths of unresolved symlinks, sorted so that resolution is
+// deterministic.
+func (w *memoryWriter) pendingSymlinks() []string {
+	names := make([]string, 0, len(w.symlinks))
+	for name := range w.symlinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// copy copies the file or directory tree at source to target.
+// Copies count against the limits like extracted files, so that symlinks cannot be used to
+// multiply the size of the content. A directory symlink may point to one of its parents, so
+// the copy skips target itself.
+func (w *memoryWriter) copy(source string, target string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		return w.copyFile(source, target, info)
+	}
+
+	return fs.WalkDir(w.fs, source, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == target || strings.HasPrefix(p, target+"/") {
+			return fs.SkipDir
+		}
+
+		dest := path.Join(target, relativePath(source, p))
+
+		if d.IsDir() {
+			return w.fs.MkdirAll(dest)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return w.copyFile(p, dest, info)
+	})
+}
+
+// copyFile copies the regular file at source to target.
+func (w *memoryWriter) copyFile(source string, target string, info fs.FileInfo) error {
+	if err := w.usage.Add(&tar.Header{Name: target}, info.Size()); err != nil {
+		return err
+	}
+
+	data, err := w.fs.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	return w.fs.WriteFile(target, data, info.Mode())
+}
+
+// relativePath returns the path of p relative to its parent directory dir.
+func relativePath(dir string, p string) string {
+	if dir == "." {
+		return p
+	}
+
+	return strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")
+}
+
+// memoryPath converts a tar entry name to a path of the in-memory file system, rejecting
+// absolute names and names escaping the image root.
+func memoryPath(name string) (string, error) {
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("absolute path %s", name)
+	}
+
+	p := path.Clean(name)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("path %s escapes the image root", name)
+	}
+
+	return p, nil
+}
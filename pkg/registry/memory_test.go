@@ -0,0 +1,100 @@
+package registry_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
+
+	. "github.com/onsi/gomega"
+)
+
+// newLinkLayer creates a layer holding a CSV at manifests/csv.yaml followed by the given link entries.
+func newLinkLayer(t *testing.T, links ...*tar.Header) v1.Layer {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	g.Expect(tw.WriteHeader(&tar.Header{Name: "manifests/csv.yaml", Mode: 0644, Size: 9, Typeflag: tar.TypeReg})).To(Succeed())
+
+	_, err := tw.Write([]byte("kind: CSV"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	for _, link := range links {
+		g.Expect(tw.WriteHeader(link)).To(Succeed())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+
+	layer, err := tarball.LayerFromReader(&buf)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return layer
+}
+
+func TestExtractImageLinks(t *testing.T) {
+	host, _ := newTestRegistry(t)
+
+	extract := func(t *testing.T, links ...*tar.Header) (fs.FS, error) {
+		t.Helper()
+
+		ref := pushImage(t, host, "bundle", newLinkLayer(t, links...))
+
+		resource, err := registry.ExtractImage(t.Context(), ref,
+			registry.WithPathPrefixes([]string{"/manifests/", "/metadata/"}),
+		)
+		t.Cleanup(resource.Cleanup)
+
+		return resource.FS(), err
+	}
+
+	t.Run("copies the content of hardlinks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys, err := extract(t, &tar.Header{Name: "manifests/copy.yaml", Typeflag: tar.TypeLink, Linkname: "manifests/csv.yaml"})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(fs.ReadFile(fsys, "manifests/copy.yaml")).To(BeEquivalentTo("kind: CSV"))
+	})
+
+	t.Run("resolves file and directory symlinks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys, err := extract(t,
+			&tar.Header{Name: "manifests/link.yaml", Typeflag: tar.TypeSymlink, Linkname: "csv.yaml"},
+			&tar.Header{Name: "metadata", Typeflag: tar.TypeSymlink, Linkname: "manifests"},
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(fs.ReadFile(fsys, "manifests/link.yaml")).To(BeEquivalentTo("kind: CSV"))
+		g.Expect(fs.ReadFile(fsys, "metadata/csv.yaml")).To(BeEquivalentTo("kind: CSV"))
+	})
+
+	t.Run("drops dangling symlinks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys, err := extract(t, &tar.Header{Name: "manifests/missing.yaml", Typeflag: tar.TypeSymlink, Linkname: "other.yaml"})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = fs.Stat(fsys, "manifests/missing.yaml")
+		g.Expect(err).To(MatchError(fs.ErrNotExist))
+	})
+
+	t.Run("rejects symlinks escaping the image root", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract(t, &tar.Header{Name: "manifests/passwd", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"})
+
+		var unsafeErr *tarutil.UnsafeEntryError
+		g.Expect(errors.As(err, &unsafeErr)).To(BeTrue(), "unexpected error: %v", err)
+	})
+}
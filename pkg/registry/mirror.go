@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// PullFrom restricts which kind of image references a mirror rule or mirror applies to.
+type PullFrom string
+
+const (
+	// PullFromAll applies to both tag and digest references.
+	PullFromAll PullFrom = "all"
+	// PullFromDigestOnly applies to digest references only.
+	PullFromDigestOnly PullFrom = "digest-only"
+	// PullFromTagOnly applies to tag references only.
+	PullFromTagOnly PullFrom = "tag-only"
+)
+
+// MirrorRule redirects pulls of images below Source to mirror locations.
+type MirrorRule struct {
+	// Source is the repository prefix the rule applies to, as host[:port][/path].
+	Source string
+
+	// Scope restricts the rule to tag or digest references. Empty means PullFromAll.
+	Scope PullFrom
+
+	// Mirrors are tried in order before the source.
+	Mirrors []Mirror
+
+	// BlockSource prevents falling back to the source when all mirrors fail.
+	BlockSource bool
+
+	// SourceInsecure allows plain HTTP and skips TLS verification for the source registry.
+	SourceInsecure bool
+}
+
+// Mirror is a location serving the same content as the source of a MirrorRule.
+type Mirror struct {
+	// Location replaces the rule source in image references, as host[:port][/path].
+	Location string
+
+	// Insecure allows plain HTTP and skips TLS verification for the mirror registry.
+	Insecure bool
+
+	// PullFrom restricts the mirror to tag or digest references. Empty means PullFromAll.
+	PullFrom PullFrom
+}
+
+// pullCandidate is a reference to try when pulling an image.
+type pullCandidate struct {
+	ref      string
+	mirror   bool
+	insecure bool
+}
+
+// appliesTo returns true if p allows pulling the given kind of reference.
+func (p PullFrom) appliesTo(digest bool) bool {
+	switch p {
+	case PullFromDigestOnly:
+		return digest
+	case PullFromTagOnly:
+		return !digest
+	default:
+		return true
+	}
+}
+
+// matchesRepository returns true if repository is prefix or below it.
+func matchesRepository(repository string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return repository == prefix || strings.HasPrefix(repository, prefix+"/")
+}
+
+// pullCandidates returns the references to try, in order, when pulling imageRef.
+// Mirrors of the rules with the longest matching source come first, followed by the
+// source itself unless a matching rule blocks it. Rules sharing the same source are merged.
+func pullCandidates(imageRef string, rules []MirrorRule) ([]pullCandidate, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %w", imageRef, err)
+	}
+
+	_, isDigest := ref.(name.Digest)
+	repository := ref.Context().Name()
+
+	// Keep the raw repository as written too, since name normalizes Docker Hub references
+	rawRepository, suffix := splitReference(imageRef)
+
+	var (
+		matched []MirrorRule
+		longest string
+	)
+
+	for _, rule := range rules {
+		if !rule.Scope.appliesTo(isDigest) {
+			continue
+		}
+
+		source := strings.TrimSuffix(rule.Source, "/")
+		if !matchesRepository(repository, source) && !matchesRepository(rawRepository, source) {
+			continue
+		}
+
+		switch {
+		case len(source) > len(longest):
+			longest = source
+			matched = []MirrorRule{rule}
+		case source == longest:
+			matched = append(matched, rule)
+		}
+	}
+
+	if len(matched) == 0 {
+		return []pullCandidate{{ref: imageRef}}, nil
+	}
+
+	path := strings.TrimPrefix(repository, longest)
+	if matchesRepository(rawRepository, longest) {
+		path = strings.TrimPrefix(rawRepository, longest)
+	}
+
+	candidates := make([]pullCandidate, 0)
+	blocked := false
+	sourceInsecure := false
+
+	for _, rule := range matched {
+		blocked = blocked || rule.BlockSource
+		sourceInsecure = sourceInsecure || rule.SourceInsecure
+
+		for _, m := range rule.Mirrors {
+			if !m.PullFrom.appliesTo(isDigest) {
+				continue
+			}
+
+			candidates = append(candidates, pullCandidate{
+				ref:      strings.TrimSuffix(m.Location, "/") + path + suffix,
+				mirror:   true,
+				insecure: m.Insecure,
+			})
+		}
+	}
+
+	if !blocked {
+		candidates = append(candidates, pullCandidate{ref: imageRef, insecure: sourceInsecure})
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no mirror configured for %s and pulling from the source is blocked", imageRef)
+	}
+
+	return candidates, nil
+}
+
+// MirrorReference returns the reference imageRef is pulled from on the first mirror of the rules
+// matching it, as pulls try it first, and false when no mirror applies to imageRef or it is not a
+// valid image reference.
+func MirrorReference(imageRef string, rules []MirrorRule) (string, bool) {
+	candidates, err := pullCandidates(imageRef, rules)
+	if err != nil || !candidates[0].mirror {
+		return imageRef, false
+	}
+
+	return candidates[0].ref, true
+}
+
+// splitReference splits an image reference into its repository and its tag or digest suffix.
+func splitReference(imageRef string) (string, string) {
+	if i := strings.Index(imageRef, "@"); i >= 0 {
+		return imageRef[:i], imageRef[i:]
+	}
+
+	// A colon after the last slash separates the tag, any other colon belongs to the host port
+	if i := strings.LastIndex(imageRef, ":"); i > strings.LastIndex(imageRef, "/") {
+		return imageRef[:i], imageRef[i:]
+	}
+
+	return imageRef, ""
+}
@@ -0,0 +1,272 @@
+package registry_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// writeFile writes content to name in a temporary directory and returns its path.
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), name)
+	g.Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+
+	return path
+}
+
+func TestLoadRegistriesConf(t *testing.T) {
+	t.Run("reads mirrors and drop-ins", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "registries.conf")
+
+		g.Expect(os.WriteFile(path, []byte(`
+unqualified-search-registries = ["quay.io"]
+
+[[registry]]
+prefix = "quay.io/example"
+location = "quay.io/example"
+
+[[registry.mirror]]
+location = "mirror.lab:5000/example"
+insecure = true
+
+[[registry]]
+prefix = "registry.redhat.io"
+blocked = true
+`), 0600)).To(Succeed())
+
+		g.Expect(os.Mkdir(filepath.Join(dir, "registries.conf.d"), 0750)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(dir, "registries.conf.d", "10-redhat.conf"), []byte(`
+[[registry]]
+prefix = "registry.redhat.io"
+mirror-by-digest-only = true
+
+[[registry.mirror]]
+location = "mirror.lab:5000/redhat"
+`), 0600)).To(Succeed())
+
+		rules, err := registry.LoadRegistriesConf(path)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rules).To(Equal([]registry.MirrorRule{
+			{
+				Source:  "quay.io/example",
+				Mirrors: []registry.Mirror{{Location: "mirror.lab:5000/example", Insecure: true}},
+			},
+			{
+				Source:  "registry.redhat.io",
+				Mirrors: []registry.Mirror{{Location: "mirror.lab:5000/redhat", PullFrom: registry.PullFromDigestOnly}},
+			},
+		}))
+	})
+
+	t.Run("treats a different location as a redirect", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rules, err := registry.LoadRegistriesConf(writeFile(t, "registries.conf", `
+[[registry]]
+prefix = "quay.io/example"
+location = "internal.lab/example"
+`))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rules).To(HaveLen(1))
+		g.Expect(rules[0].BlockSource).To(BeTrue())
+		g.Expect(rules[0].Mirrors).To(Equal([]registry.Mirror{{Location: "internal.lab/example"}}))
+	})
+
+	t.Run("rejects invalid pull-from-mirror", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := registry.LoadRegistriesConf(writeFile(t, "registries.conf", `
+[[registry]]
+prefix = "quay.io"
+
+[[registry.mirror]]
+location = "mirror.lab"
+pull-from-mirror = "sometimes"
+`))
+		g.Expect(err).To(MatchError(ContainSubstring("invalid pull-from-mirror")))
+	})
+}
+
+func TestLoadMirrorSets(t *testing.T) {
+	g := NewWithT(t)
+
+	path := writeFile(t, "mirrors.yaml", `
+apiVersion: config.openshift.io/v1
+kind: ImageDigestMirrorSet
+metadata:
+  name: digest
+spec:
+  imageDigestMirrors:
+    - source: registry.redhat.io/redhat
+      mirrors:
+        - mirror.lab:5000/redhat
+      mirrorSourcePolicy: NeverContactSource
+---
+apiVersion: config.openshift.io/v1
+kind: ImageTagMirrorSet
+metadata:
+  name: tag
+spec:
+  imageTagMirrors:
+    - source: quay.io/example
+      mirrors:
+        - mirror.lab:5000/example
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`)
+
+	rules, err := registry.LoadMirrorSets(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rules).To(Equal([]registry.MirrorRule{
+		{
+			Source:      "registry.redhat.io/redhat",
+			Scope:       registry.PullFromDigestOnly,
+			Mirrors:     []registry.Mirror{{Location: "mirror.lab:5000/redhat"}},
+			BlockSource: true,
+		},
+		{
+			Source:  "quay.io/example",
+			Scope:   registry.PullFromTagOnly,
+			Mirrors: []registry.Mirror{{Location: "mirror.lab:5000/example"}},
+		},
+	}))
+}
+
+func TestMirrorReference(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	rules := []registry.MirrorRule{
+		{Source: "registry.example.com", Mirrors: []registry.Mirror{{Location: "mirror.lab/example"}}},
+		{Source: "registry.example.com/ops", Mirrors: []registry.Mirror{{Location: "mirror.lab/ops"}}},
+		{Source: "quay.io/example", Scope: registry.PullFromDigestOnly, Mirrors: []registry.Mirror{{Location: "mirror.lab/quay"}}},
+	}
+
+	tests := []struct {
+		image    string
+		expected string
+		matched  bool
+	}{
+		{"registry.example.com/ops/operator:v1", "mirror.lab/ops/operator:v1", true},
+		{"registry.example.com/operands/server@" + digest, "mirror.lab/example/operands/server@" + digest, true},
+		{"quay.io/example/proxy@" + digest, "mirror.lab/quay/proxy@" + digest, true},
+		{"quay.io/example/proxy:v1", "quay.io/example/proxy:v1", false},
+		{"registry.example.com.evil/ops/operator:v1", "registry.example.com.evil/ops/operator:v1", false},
+		{"not a reference", "not a reference", false},
+	}
+
+	for _, tt := range tests {
+		g := NewWithT(t)
+
+		image, matched := registry.MirrorReference(tt.image, rules)
+		g.Expect(image).To(Equal(tt.expected), tt.image)
+		g.Expect(matched).To(Equal(tt.matched), tt.image)
+	}
+}
+
+func TestExtractImageMirrors(t *testing.T) {
+	mirrorHost, _ := newTestRegistry(t)
+	mirrored := pushImage(t, mirrorHost, "mirrored/ops/bundle", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+	// The upstream registry is not reachable, as in disconnected environments
+	upstream := "upstream.invalid/ops/bundle:latest"
+
+	extract := func(t *testing.T, imageRef string, opts ...registry.Option) (registry.Resource, error) {
+		t.Helper()
+
+		opts = append(opts,
+			registry.WithTempDir(t.TempDir()),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+
+		resource, err := registry.ExtractImage(t.Context(), imageRef, opts...)
+		t.Cleanup(resource.Cleanup)
+
+		return resource, err
+	}
+
+	t.Run("pulls from the mirror of a matching prefix", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resource, err := extract(t, upstream, registry.WithMirrors(registry.MirrorRule{
+			Source:  "upstream.invalid",
+			Mirrors: []registry.Mirror{{Location: mirrorHost + "/mirrored"}},
+		}))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.FromMirror()).To(BeTrue())
+		g.Expect(resource.Source()).To(Equal(mirrored))
+		g.Expect(fs.ReadFile(resource.FS(), "manifests/csv.yaml")).To(BeEquivalentTo("kind: CSV"))
+	})
+
+	t.Run("falls back to the next mirror", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resource, err := extract(t, upstream, registry.WithMirrors(registry.MirrorRule{
+			Source: "upstream.invalid/ops",
+			Mirrors: []registry.Mirror{
+				{Location: mirrorHost + "/missing/ops"},
+				{Location: mirrorHost + "/mirrored/ops"},
+			},
+		}))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.Source()).To(Equal(mirrored))
+	})
+
+	t.Run("applies digest mirrors to digest references only", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rule := registry.WithMirrors(registry.MirrorRule{
+			Source:      "upstream.invalid",
+			Scope:       registry.PullFromDigestOnly,
+			Mirrors:     []registry.Mirror{{Location: mirrorHost + "/mirrored"}},
+			BlockSource: true,
+		})
+
+		_, err := extract(t, upstream, rule)
+		g.Expect(err).To(MatchError(ContainSubstring("upstream.invalid")))
+
+		resource, err := extract(t, mirrored)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		digestRef := "upstream.invalid/ops/bundle@" + resource.Digest()
+		resource, err = extract(t, digestRef, rule)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.Source()).To(Equal(mirrorHost + "/mirrored/ops/bundle@" + resource.Digest()))
+	})
+
+	t.Run("does not contact a blocked source", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract(t, upstream, registry.WithMirrors(registry.MirrorRule{
+			Source:      "upstream.invalid",
+			BlockSource: true,
+		}))
+		g.Expect(err).To(MatchError(ContainSubstring("pulling from the source is blocked")))
+	})
+
+	t.Run("pulls from the source without matching rule", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resource, err := extract(t, mirrored, registry.WithMirrors(registry.MirrorRule{
+			Source:  "upstream.invalid",
+			Mirrors: []registry.Mirror{{Location: "other.invalid"}},
+		}))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.FromMirror()).To(BeFalse())
+		g.Expect(resource.Source()).To(Equal(mirrored))
+	})
+}
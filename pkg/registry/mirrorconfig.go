@@ -0,0 +1,234 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// registriesConfEnv overrides the location of registries.conf, as in containers tools.
+	registriesConfEnv = "CONTAINERS_REGISTRIES_CONF"
+
+	// systemRegistriesConf is the system-wide registries.conf location.
+	systemRegistriesConf = "/etc/containers/registries.conf"
+
+	// neverContactSource is the IDMS/ITMS mirrorSourcePolicy that blocks the source.
+	neverContactSource = "NeverContactSource"
+)
+
+// registriesConf is the subset of containers-registries.conf(5) version 2 relevant to mirroring.
+type registriesConf struct {
+	Registries []registriesConfRegistry `toml:"registry"`
+}
+
+// registriesConfRegistry is a [[registry]] table of registries.conf.
+type registriesConfRegistry struct {
+	Prefix             string                 `toml:"prefix"`
+	Location           string                 `toml:"location"`
+	Insecure           bool                   `toml:"insecure"`
+	Blocked            bool                   `toml:"blocked"`
+	MirrorByDigestOnly bool                   `toml:"mirror-by-digest-only"`
+	Mirrors            []registriesConfMirror `toml:"mirror"`
+}
+
+// registriesConfMirror is a [[registry.mirror]] table of registries.conf.
+type registriesConfMirror struct {
+	Location       string `toml:"location"`
+	Insecure       bool   `toml:"insecure"`
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+// mirrorSetDocument covers ImageDigestMirrorSet, ImageTagMirrorSet and ImageContentSourcePolicy.
+type mirrorSetDocument struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		ImageDigestMirrors      []mirrorSetEntry `json:"imageDigestMirrors"`
+		ImageTagMirrors         []mirrorSetEntry `json:"imageTagMirrors"`
+		RepositoryDigestMirrors []mirrorSetEntry `json:"repositoryDigestMirrors"`
+	} `json:"spec"`
+}
+
+// mirrorSetEntry is a single source with its mirrors in a mirror set.
+type mirrorSetEntry struct {
+	Source             string   `json:"source"`
+	Mirrors            []string `json:"mirrors"`
+	MirrorSourcePolicy string   `json:"mirrorSourcePolicy"`
+}
+
+// DefaultRegistriesConfPath returns the registries.conf used by containers tools:
+// $CONTAINERS_REGISTRIES_CONF, then the per-user file, then the system-wide file.
+// Returns an empty string if none exists.
+func DefaultRegistriesConfPath() string {
+	if path := os.Getenv(registriesConfEnv); path != "" {
+		return path
+	}
+
+	candidates := make([]string, 0, 2) //nolint:mnd
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "containers", "registries.conf"))
+	}
+	candidates = append(candidates, systemRegistriesConf)
+
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// LoadRegistriesConf reads the mirror configuration of a containers registries.conf file and
+// of the drop-in files in the registries.conf.d directory next to it. As in containers tools,
+// a drop-in entry replaces an earlier entry with the same prefix.
+// Wildcard prefixes (*.example.com) are not supported and are ignored.
+func LoadRegistriesConf(path string) ([]MirrorRule, error) {
+	files := []string{path}
+
+	dropIns, err := filepath.Glob(filepath.Join(filepath.Dir(path), "registries.conf.d", "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registries.conf.d: %w", err)
+	}
+
+	sort.Strings(dropIns)
+	files = append(files, dropIns...)
+
+	entries := make(map[string]registriesConfRegistry)
+	order := make([]string, 0)
+
+	for _, file := range files {
+		var conf registriesConf
+		if _, err := toml.DecodeFile(file, &conf); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		for _, r := range conf.Registries {
+			prefix := r.Prefix
+			if prefix == "" {
+				prefix = r.Location
+			}
+
+			if prefix == "" || strings.HasPrefix(prefix, "*.") {
+				continue
+			}
+
+			if _, ok := entries[prefix]; !ok {
+				order = append(order, prefix)
+			}
+
+			entries[prefix] = r
+		}
+	}
+
+	rules := make([]MirrorRule, 0, len(order))
+
+	for _, prefix := range order {
+		r := entries[prefix]
+
+		rule := MirrorRule{
+			Source:         prefix,
+			BlockSource:    r.Blocked,
+			SourceInsecure: r.Insecure,
+		}
+
+		for _, m := range r.Mirrors {
+			pullFrom := PullFrom(m.PullFromMirror)
+			if r.MirrorByDigestOnly {
+				pullFrom = PullFromDigestOnly
+			}
+
+			switch pullFrom {
+			case "", PullFromAll, PullFromDigestOnly, PullFromTagOnly:
+			default:
+				return nil, fmt.Errorf("invalid pull-from-mirror %q for mirror %s", m.PullFromMirror, m.Location)
+			}
+
+			rule.Mirrors = append(rule.Mirrors, Mirror{
+				Location: m.Location,
+				Insecure: m.Insecure,
+				PullFrom: pullFrom,
+			})
+		}
+
+		// A location different from the prefix replaces the source, after the mirrors
+		if r.Location != "" && r.Location != prefix {
+			rule.BlockSource = true
+			rule.Mirrors = append(rule.Mirrors, Mirror{Location: r.Location, Insecure: r.Insecure})
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// LoadMirrorSets reads ImageDigestMirrorSet, ImageTagMirrorSet and ImageContentSourcePolicy
+// resources from YAML or JSON files, which may contain multiple documents. Other kinds are ignored.
+// Digest mirrors only apply to digest references and tag mirrors only to tag references,
+// matching how OpenShift applies them.
+func LoadMirrorSets(paths ...string) ([]MirrorRule, error) {
+	rules := make([]MirrorRule, 0)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mirror set %s: %w", path, err)
+		}
+
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data))
+
+		for {
+			var doc mirrorSetDocument
+
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse mirror set %s: %w", path, err)
+			}
+
+			switch doc.Kind {
+			case "ImageDigestMirrorSet":
+				rules = append(rules, mirrorSetRules(doc.Spec.ImageDigestMirrors, PullFromDigestOnly)...)
+			case "ImageTagMirrorSet":
+				rules = append(rules, mirrorSetRules(doc.Spec.ImageTagMirrors, PullFromTagOnly)...)
+			case "ImageContentSourcePolicy":
+				rules = append(rules, mirrorSetRules(doc.Spec.RepositoryDigestMirrors, PullFromDigestOnly)...)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// mirrorSetRules converts mirror set entries to rules with the given scope.
+func mirrorSetRules(entries []mirrorSetEntry, scope PullFrom) []MirrorRule {
+	rules := make([]MirrorRule, 0, len(entries))
+
+	for _, e := range entries {
+		rule := MirrorRule{
+			Source:      e.Source,
+			Scope:       scope,
+			BlockSource: e.MirrorSourcePolicy == neverContactSource,
+		}
+
+		for _, m := range e.Mirrors {
+			rule.Mirrors = append(rule.Mirrors, Mirror{Location: m})
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"archive/tar"
+	"path"
+	"strings"
+)
+
+const (
+	// whiteoutPrefix marks a file deleting the entry of the same name from lower layers.
+	whiteoutPrefix = ".wh."
+
+	// whiteoutOpaque marks a directory whose content from lower layers is hidden.
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// overlay applies OCI layer semantics while layers are extracted newest first.
+// An entry of a lower layer is hidden when an upper layer already provides the same path,
+// replaced one of its parent directories with a non-directory, deleted it or one of its
+// parents with a whiteout, or marked one of its parent directories as opaque.
+//
+// Changes of a layer only affect the layers below it, so they are staged while a layer
+// is extracted and committed once it is complete.
+type overlay struct {
+	// entries maps paths provided by upper layers to whether they are directories.
+	entries map[string]bool
+	// whiteouts holds paths deleted by upper layers, including their content.
+	whiteouts map[string]bool
+	// opaques holds directories whose lower layer content is hidden.
+	opaques map[string]bool
+
+	staged overlayChanges
+}
+
+// overlayChanges holds the changes of the layer being extracted.
+type overlayChanges struct {
+	entries   map[string]bool
+	whiteouts []string
+	opaques   []string
+}
+
+// newOverlay creates an overlay with no layers applied.
+func newOverlay() *overlay {
+	return &overlay{
+		entries:   make(map[string]bool),
+		whiteouts: make(map[string]bool),
+		opaques:   make(map[string]bool),
+		staged:    overlayChanges{entries: make(map[string]bool)},
+	}
+}
+
+// apply records an entry of the layer being extracted and returns true if it should be
+// written to disk. Whiteout markers and entries hidden by upper layers are not written.
+func (o *overlay) apply(header *tar.Header) bool {
+	name := cleanEntryName(header.Name)
+	if name == "" {
+		return false
+	}
+
+	if isWhiteout(name) {
+		if path.Base(name) == whiteoutOpaque {
+			o.staged.opaques = append(o.staged.opaques, whiteoutTarget(name))
+		} else {
+			o.staged.whiteouts = append(o.staged.whiteouts, whiteoutTarget(name))
+		}
+
+		return false
+	}
+
+	if o.hidden(name, header.Typeflag == tar.TypeDir) {
+		return false
+	}
+
+	o.staged.entries[name] = header.Typeflag == tar.TypeDir
+
+	return true
+}
+
+// commit applies the changes of the extracted layer to the layers below it.
+func (o *overlay) commit() {
+	for name, isDir := range o.staged.entries {
+		o.entries[name] = isDir
+	}
+
+	for _, name := range o.staged.whiteouts {
+		o.whiteouts[name] = true
+	}
+
+	for _, name := range o.staged.opaques {
+		o.opaques[name] = true
+	}
+
+	o.staged = overlayChanges{entries: make(map[string]bool)}
+}
+
+// hidden returns true if an entry of a lower layer at name is hidden by upper layers.
+// Directories are merged rather than hidden: a lower layer directory at a path an upper layer
+// provides as a directory is kept, so that its content from both layers is extracted.
+func (o *overlay) hidden(name string, isDir bool) bool {
+	if o.whiteouts[name] {
+		return true
+	}
+
+	if upperIsDir, ok := o.entries[name]; ok && !(upperIsDir && isDir) {
+		return true
+	}
+
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		if o.whiteouts[parent] || o.opaques[parent] {
+			return true
+		}
+
+		if upperIsDir, ok := o.entries[parent]; ok && !upperIsDir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealed returns true if lower layers cannot contribute content under prefix anymore, because
+// upper layers deleted it, marked it opaque or replaced it with a non-directory.
+func (o *overlay) sealed(prefix string) bool {
+	for name := cleanEntryName(prefix); name != "." && name != ""; name = path.Dir(name) {
+		if o.whiteouts[name] || o.opaques[name] {
+			return true
+		}
+
+		if isDir, ok := o.entries[name]; ok && !isDir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWhiteout returns true if name is a whiteout or opaque marker.
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(cleanEntryName(name)), whiteoutPrefix)
+}
+
+// whiteoutTarget returns the path a whiteout or opaque marker applies to.
+func whiteoutTarget(name string) string {
+	dir, base := path.Split(cleanEntryName(name))
+	if base == whiteoutOpaque {
+		return strings.TrimSuffix(dir, "/")
+	}
+
+	return path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+}
+
+// cleanEntryName normalizes a tar entry name to a relative slash separated path.
+func cleanEntryName(name string) string {
+	name = path.Clean("/" + name)
+
+	return strings.TrimPrefix(name, "/")
+}
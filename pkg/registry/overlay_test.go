@@ -0,0 +1,94 @@
+package registry_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestExtractImageWhiteouts(t *testing.T) {
+	host, _ := newTestRegistry(t)
+
+	// extract pushes an image made of layers, oldest first, and returns the files of its
+	// manifests directory with their content.
+	extract := func(t *testing.T, layers ...v1.Layer) map[string]string {
+		t.Helper()
+
+		g := NewWithT(t)
+
+		ref := pushImage(t, host, "bundle", layers...)
+
+		resource, err := registry.ExtractImage(t.Context(), ref,
+			registry.WithTempDir(t.TempDir()),
+			registry.WithPathPrefixes([]string{"/manifests/", "/metadata/"}),
+		)
+		t.Cleanup(resource.Cleanup)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		entries, err := fs.ReadDir(resource.FS(), "manifests")
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}
+		}
+		g.Expect(err).ToNot(HaveOccurred())
+
+		files := make(map[string]string)
+		for _, e := range entries {
+			data, err := fs.ReadFile(resource.FS(), "manifests/"+e.Name())
+			g.Expect(err).ToNot(HaveOccurred())
+			files[e.Name()] = string(data)
+		}
+
+		return files
+	}
+
+	t.Run("keeps files of upper layers", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files := extract(t,
+			newLayer(t, map[string]string{"manifests/csv.yaml": "v1", "manifests/crd.yaml": "crd"}),
+			newLayer(t, map[string]string{"manifests/csv.yaml": "v2"}),
+		)
+
+		g.Expect(files).To(Equal(map[string]string{"csv.yaml": "v2", "crd.yaml": "crd"}))
+	})
+
+	t.Run("removes files deleted by whiteouts", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files := extract(t,
+			newLayer(t, map[string]string{"manifests/csv.yaml": "csv", "manifests/old.yaml": "old"}),
+			newLayer(t, map[string]string{"manifests/.wh.old.yaml": "", "manifests/new.yaml": "new"}),
+		)
+
+		g.Expect(files).To(Equal(map[string]string{"csv.yaml": "csv", "new.yaml": "new"}))
+	})
+
+	t.Run("hides lower content of opaque directories", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files := extract(t,
+			newLayer(t, map[string]string{"manifests/a.yaml": "a", "manifests/b.yaml": "b"}),
+			newLayer(t, map[string]string{"manifests/.wh..wh..opq": "", "manifests/c.yaml": "c"}),
+		)
+
+		g.Expect(files).To(Equal(map[string]string{"c.yaml": "c"}))
+	})
+
+	t.Run("removes directories deleted by whiteouts", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files := extract(t,
+			newLayer(t, map[string]string{"manifests/a.yaml": "a", "metadata/annotations.yaml": "{}"}),
+			newLayer(t, map[string]string{".wh.manifests": ""}),
+			newLayer(t, map[string]string{"manifests/b.yaml": "b"}),
+		)
+
+		g.Expect(files).To(Equal(map[string]string{"b.yaml": "b"}))
+	})
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/slices"
+)
+
+// defaultPlatform is the platform selected from multi-platform images when none is configured,
+// matching the default of go-containerregistry.
+var defaultPlatform = v1.Platform{OS: "linux", Architecture: "amd64"} //nolint:gochecknoglobals
+
+// Number of slash separated parts of a platform: os/arch with an optional variant.
+const (
+	minPlatformParts = 2
+	maxPlatformParts = 3
+)
+
+// unknownPlatformOS marks index entries that are not runnable images, such as build attestations.
+const unknownPlatformOS = "unknown"
+
+// parsePlatform parses a platform in os/arch[/variant] format.
+func parsePlatform(platform string) (v1.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < minPlatformParts || len(parts) > maxPlatformParts || slices.Any(parts, func(p string) bool { return p == "" }) {
+		return v1.Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+
+	p := v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == maxPlatformParts {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+// platformImage selects the image of a multi-platform index matching platform.
+// Bundle and catalog images usually carry the same platform independent files for every
+// platform, so when no image matches, any image is selected as long as all of them share the
+// same layers. Otherwise the available platforms are reported.
+func platformImage(idx v1.ImageIndex, platform v1.Platform) (v1.Image, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	images := slices.Filter(manifest.Manifests, func(d v1.Descriptor) bool {
+		return d.MediaType.IsImage() && (d.Platform == nil || d.Platform.OS != unknownPlatformOS)
+	})
+	if len(images) == 0 {
+		return nil, fmt.Errorf("index holds no images")
+	}
+
+	match, found := slices.Find(images, func(d v1.Descriptor) bool {
+		return d.Platform != nil && d.Platform.Satisfies(platform)
+	})
+	if found {
+		return idx.Image(match.Digest)
+	}
+
+	identical, err := sameLayers(idx, images)
+	if err != nil {
+		return nil, err
+	}
+
+	if !identical {
+		platforms := slices.Map(images, func(d v1.Descriptor) string {
+			if d.Platform == nil {
+				return d.Digest.String()
+			}
+
+			return d.Platform.String()
+		})
+
+		return nil, fmt.Errorf("no image for platform %s, available platforms: %s",
+			platform.String(), strings.Join(platforms, ", "))
+	}
+
+	return idx.Image(images[0].Digest)
+}
+
+// sameLayers returns true if all images of descs have the same layers, in the same order.
+func sameLayers(idx v1.ImageIndex, descs []v1.Descriptor) (bool, error) {
+	var first []v1.Descriptor
+
+	for i, desc := range descs {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return false, fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+		}
+
+		m, err := img.Manifest()
+		if err != nil {
+			return false, fmt.Errorf("failed to read manifest %s: %w", desc.Digest, err)
+		}
+
+		if i == 0 {
+			first = m.Layers
+
+			continue
+		}
+
+		if len(m.Layers) != len(first) {
+			return false, nil
+		}
+
+		for j := range m.Layers {
+			if m.Layers[j].Digest != first[j].Digest {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
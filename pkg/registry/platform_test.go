@@ -0,0 +1,160 @@
+package registry_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// pushIndex pushes a multi-platform index holding an image per platform, each with a CSV whose
+// content is given by contents, and returns its reference.
+func pushIndex(t *testing.T, host string, repo string, contents map[string]string) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	// Identical contents share the same layer, as they would in a real multi-platform bundle
+	layers := make(map[string]v1.Layer)
+
+	idx := v1.ImageIndex(empty.Index)
+	for platform, content := range contents {
+		p, err := v1.ParsePlatform(platform)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		layer, ok := layers[content]
+		if !ok {
+			layer = newLayer(t, map[string]string{"manifests/csv.yaml": content})
+			layers[content] = layer
+		}
+
+		img, err := mutate.AppendLayers(empty.Image, layer)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// Keep the diff IDs of the config, without which the layers are not pushed
+		cfg, err := img.ConfigFile()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		cfg = cfg.DeepCopy()
+		cfg.OS, cfg.Architecture, cfg.Variant = p.OS, p.Architecture, p.Variant
+
+		img, err = mutate.ConfigFile(img, cfg)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: p},
+		})
+	}
+
+	ref, err := name.ParseReference(host + "/" + repo + ":latest")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(remote.WriteIndex(ref, idx)).To(Succeed())
+
+	return ref.String()
+}
+
+func TestExtractImagePlatform(t *testing.T) {
+	host, _ := newTestRegistry(t)
+
+	multiArch := pushIndex(t, host, "multi-arch", map[string]string{
+		"linux/amd64":    "arch: amd64",
+		"linux/arm64/v8": "arch: arm64",
+	})
+	identical := pushIndex(t, host, "identical", map[string]string{
+		"linux/ppc64le": "kind: CSV",
+		"linux/s390x":   "kind: CSV",
+	})
+
+	extract := func(t *testing.T, imageRef string, opts ...registry.Option) (string, error) {
+		t.Helper()
+
+		opts = append(opts, registry.WithTempDir(t.TempDir()), registry.WithPathPrefixes([]string{"/manifests/"}))
+
+		resource, err := registry.ExtractImage(t.Context(), imageRef, opts...)
+		defer resource.Cleanup()
+
+		if err != nil {
+			return "", err
+		}
+
+		data, err := fs.ReadFile(resource.FS(), "manifests/csv.yaml")
+
+		return string(data), err
+	}
+
+	t.Run("defaults to linux/amd64", func(t *testing.T) {
+		g := NewWithT(t)
+
+		content, err := extract(t, multiArch)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(content).To(Equal("arch: amd64"))
+	})
+
+	t.Run("selects the requested platform", func(t *testing.T) {
+		g := NewWithT(t)
+
+		content, err := extract(t, multiArch, registry.WithPlatform("linux/arm64"))
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(content).To(Equal("arch: arm64"))
+	})
+
+	t.Run("reports the index digest", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref, err := name.ParseReference(multiArch)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		img, err := remote.Image(ref, remote.WithPlatform(v1.Platform{OS: "linux", Architecture: "amd64"}))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		platformDigest, err := img.Digest()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		resource, err := registry.ExtractImage(t.Context(), multiArch, registry.WithTempDir(t.TempDir()))
+		defer resource.Cleanup()
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.Digest()).To(Equal(imageDigest(t, multiArch).String()))
+		g.Expect(resource.ManifestDigest()).To(Equal(platformDigest.String()))
+		g.Expect(resource.Digest()).ToNot(Equal(resource.ManifestDigest()))
+	})
+
+	t.Run("fails when no platform matches", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract(t, multiArch, registry.WithPlatform("linux/s390x"))
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("no image for platform linux/s390x"))
+		g.Expect(err.Error()).To(ContainSubstring("linux/arm64/v8"))
+	})
+
+	t.Run("falls back to any image when the content is identical", func(t *testing.T) {
+		g := NewWithT(t)
+
+		content, err := extract(t, identical)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(content).To(Equal("kind: CSV"))
+	})
+
+	t.Run("rejects an invalid platform", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract(t, multiArch, registry.WithPlatform("linux"))
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("expected os/arch[/variant]"))
+	})
+}
@@ -2,33 +2,83 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/cache"
+	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
 )
 
 // Resource encapsulates all resources associated with an extracted container image.
-// It manages temporary directories, providing a single cleanup method that is
-// safe to call even on partially initialized resources.
+// Its content is held in memory, or on disk when served from the cache, and it provides
+// a single cleanup method that is safe to call even on partially initialized resources.
 type Resource struct {
-	dir    string
-	tmpDir string
+	dir            string
+	fsys           fs.FS
+	digest         string
+	manifestDigest string
+	source         string
+	mirror         bool
+	verified       string
 }
 
-// Dir returns the directory path containing the unpacked image.
+// Dir returns the directory path containing the unpacked image when it was extracted to disk,
+// which is the case when the cache is enabled, or an empty string when it is held in memory.
 func (r *Resource) Dir() string {
 	return r.dir
 }
 
+// FS returns the content of the unpacked image, wherever it is held.
+func (r *Resource) FS() fs.FS {
+	if r.fsys == nil && r.dir != "" {
+		return os.DirFS(r.dir)
+	}
+
+	return r.fsys
+}
+
+// Digest returns the digest the image reference resolved to, which is the digest of the index for
+// multi-platform images, as listed in catalogs and reported by registry tools.
+func (r *Resource) Digest() string {
+	return r.digest
+}
+
+// ManifestDigest returns the manifest digest of the extracted image, which is the image of the
+// selected platform for multi-platform images.
+func (r *Resource) ManifestDigest() string {
+	return r.manifestDigest
+}
+
+// Source returns the image reference the content was pulled from, which differs from
+// the requested reference when the image was served by a mirror.
+func (r *Resource) Source() string {
+	return r.source
+}
+
+// FromMirror returns true if the image was served by a configured mirror.
+func (r *Resource) FromMirror() bool {
+	return r.mirror
+}
+
+// VerifiedDigest returns the digest whose signature was verified, which is the digest of the
+// multi-platform index when the index is signed. Returns an empty string when verification is disabled.
+func (r *Resource) VerifiedDigest() string {
+	return r.verified
+}
+
 // Cleanup releases all resources held by the Resource.
+// Content served from the cache is left untouched.
 // It is idempotent and safe to call on zero-value or partially initialized resources.
 func (r *Resource) Cleanup() {
-	if r.tmpDir != "" {
-		_ = os.RemoveAll(r.tmpDir)
-	}
+	r.fsys = nil
 }
 
 // Option configures image extraction behavior.
@@ -36,20 +86,112 @@ type Option func(*options)
 
 // options holds all configuration for image extraction.
 type options struct {
-	insecure     bool
-	username     string
-	password     string
-	tempDir      string
-	pathPrefixes []string
+	insecure      bool
+	caFile        string
+	hosts         map[string]HostConfig
+	username      string
+	password      string
+	token         string
+	authFile      string
+	tempDir       string
+	cacheDir      string
+	pathPrefixes  []string
+	mirrors       []MirrorRule
+	platform      string
+	verifyKey     string
+	requireDigest bool
+	retry         RetryPolicy
+	timeout       time.Duration
+	onRetry       func(Retry)
 }
 
-// WithInsecure allows insecure connections to registries (HTTP or self-signed certificates).
+// WithInsecure allows insecure connections to all registries: plain HTTP is used as a
+// fallback when HTTPS is not available, and TLS certificates are not verified.
 func WithInsecure(insecure bool) Option {
 	return func(o *options) {
 		o.insecure = insecure
 	}
 }
 
+// WithCAFile trusts the certificate authorities in a PEM bundle for all registries,
+// in addition to the system roots.
+func WithCAFile(path string) Option {
+	return func(o *options) {
+		o.caFile = path
+	}
+}
+
+// WithHostConfig configures connection settings for a single registry, identified by
+// host[:port] as it appears in image references (e.g. registry.example.com:5000).
+func WithHostConfig(host string, config HostConfig) Option {
+	return func(o *options) {
+		if o.hosts == nil {
+			o.hosts = make(map[string]HostConfig)
+		}
+
+		o.hosts[host] = config
+	}
+}
+
+// WithMirrors configures mirror rules, as loaded by LoadRegistriesConf or LoadMirrorSets.
+// Mirrors of a matching rule are tried in order before the source registry.
+func WithMirrors(rules ...MirrorRule) Option {
+	return func(o *options) {
+		o.mirrors = append(o.mirrors, rules...)
+	}
+}
+
+// WithPlatform selects the image of multi-platform indexes matching platform, in
+// os/arch[/variant] format. Defaults to linux/amd64.
+func WithPlatform(platform string) Option {
+	return func(o *options) {
+		o.platform = platform
+	}
+}
+
+// WithVerifyKey requires images to carry a cosign-style signature valid for the PEM encoded public
+// key at path. Signatures are read from the registry serving the image, as the image tagged
+// <algorithm>-<hex>.sig, and verified offline without a transparency log.
+// Local references cannot be verified and are rejected.
+func WithVerifyKey(path string) Option {
+	return func(o *options) {
+		o.verifyKey = path
+	}
+}
+
+// WithRequireDigest refuses registry references that are not pinned by digest, so that the
+// extracted content cannot change when a tag is moved. Local references are read from disk and
+// are not affected.
+func WithRequireDigest(require bool) Option {
+	return func(o *options) {
+		o.requireDigest = require
+	}
+}
+
+// WithRetryPolicy configures how failed registry requests are retried.
+// Defaults to DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithTimeout bounds the time an extraction may take, including all its requests and retries.
+// 0 disables the timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithOnRetry configures a function called before a failed registry request is retried,
+// so callers can report it.
+func WithOnRetry(onRetry func(Retry)) Option {
+	return func(o *options) {
+		o.onRetry = onRetry
+	}
+}
+
 // WithAuth configures explicit registry authentication credentials.
 func WithAuth(username string, password string) Option {
 	return func(o *options) {
@@ -58,13 +200,40 @@ func WithAuth(username string, password string) Option {
 	}
 }
 
-// WithTempDir specifies where temporary files should be created.
+// WithToken configures an explicit bearer token for the source registry, sent as is instead of
+// being exchanged through the registry token service.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithAuthFile resolves credentials from a containers auth file (auth.json), in the format of
+// Docker's config.json. Defaults to the auth file of containers tools, if any.
+// Registries without an entry fall back to Docker's config and credential helpers.
+func WithAuthFile(path string) Option {
+	return func(o *options) {
+		o.authFile = path
+	}
+}
+
+// WithTempDir specifies where temporary files should be created, such as the content of
+// oci-archive references. Extracted content is held in memory unless the cache is enabled.
 func WithTempDir(dir string) Option {
 	return func(o *options) {
 		o.tempDir = dir
 	}
 }
 
+// WithCacheDir enables the persistent cache rooted at dir.
+// Layers and extracted content are cached by digest, so repeated extractions of the same
+// image only fetch its manifest. An empty dir disables the cache.
+func WithCacheDir(dir string) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+	}
+}
+
 // WithPathPrefixes specifies which paths to extract from the image layers.
 // Only layers containing files with these prefixes will be extracted.
 // This significantly improves performance by skipping base OS layers.
@@ -74,62 +243,277 @@ func WithPathPrefixes(prefixes []string) Option {
 	}
 }
 
-// ExtractImage pulls a container image and extracts it to a temporary directory.
+// ExtractImage pulls a container image and extracts it in memory, or into the cache when enabled.
+// When mirrors are configured, they are tried before the source registry and the
+// reference that served the image is reported by Resource.Source.
+// References with a local transport prefix (oci:, oci-archive: or docker-archive:) are
+// read from disk instead of being pulled.
+// When a verification key is configured, only images with a valid signature are extracted.
+// Failed registry requests are retried according to the retry policy, and the whole extraction
+// fails when it does not complete within the timeout, if any.
 // Returns a Resource containing all created resources.
 // On error, returns a partial Resource that is safe to clean up.
 func ExtractImage(ctx context.Context, imageRef string, opts ...Option) (Resource, error) {
 	// Apply options
-	cfg := options{}
+	cfg := options{retry: DefaultRetryPolicy()}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
+	if cfg.timeout <= 0 {
+		return cfg.extractImage(ctx, imageRef)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	resource, err := cfg.extractImage(ctx, imageRef)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return resource, fmt.Errorf("extraction of image %s timed out after %s: %w", imageRef, cfg.timeout, err)
+	}
+
+	return resource, err
+}
+
+// extractImage extracts an image with the options of o, as described by ExtractImage.
+func (o *options) extractImage(ctx context.Context, imageRef string) (Resource, error) {
 	resource := Resource{}
 
-	// Create temporary directory for unpacked image
-	tmpDir, err := os.MkdirTemp(cfg.tempDir, "image-extract-*")
+	platform := defaultPlatform
+	if o.platform != "" {
+		p, err := parsePlatform(o.platform)
+		if err != nil {
+			return resource, err
+		}
+		platform = p
+	}
+
+	if o.requireDigest && !IsLocalReference(imageRef) && !IsDigestReference(imageRef) {
+		return resource, fmt.Errorf("image %s is not pinned by digest", imageRef)
+	}
+
+	var v *verifier
+	if o.verifyKey != "" {
+		if IsLocalReference(imageRef) {
+			return resource, fmt.Errorf("signature verification is not supported for local image %s", imageRef)
+		}
+
+		loaded, err := loadVerifier(o.verifyKey)
+		if err != nil {
+			return resource, err
+		}
+		v = loaded
+	}
+
+	var img v1.Image
+
+	if IsLocalReference(imageRef) {
+		local, cleanup, err := loadLocalImage(imageRef, o.tempDir, platform)
+		defer cleanup()
+
+		if err != nil {
+			return resource, err
+		}
+
+		img = local
+		resource.source = imageRef
+	} else {
+		pulled, err := o.pullImage(ctx, imageRef, platform, v)
+		if err != nil {
+			return resource, err
+		}
+
+		img = pulled.image
+		resource.digest = pulled.resolved.String()
+		resource.source = pulled.candidate.ref
+		resource.mirror = pulled.candidate.mirror
+		resource.verified = pulled.verified
+	}
+
+	digest, err := img.Digest()
 	if err != nil {
-		return resource, fmt.Errorf("failed to create temp directory: %w", err)
+		return resource, fmt.Errorf("failed to get digest of image %s: %w", imageRef, err)
 	}
-	resource.tmpDir = tmpDir
-	resource.dir = tmpDir
+	resource.manifestDigest = digest.String()
 
-	// Parse image reference
+	// Local images are not resolved from a reference, so they are identified by their manifest
+	if resource.digest == "" {
+		resource.digest = resource.manifestDigest
+	}
+
+	// Serve the extracted content from the cache when enabled
+	if o.cacheDir != "" {
+		dir, err := extractCached(cache.New(o.cacheDir), img, digest, o.pathPrefixes)
+		if err != nil {
+			return resource, err
+		}
+		resource.dir = dir
+
+		return resource, nil
+	}
+
+	// Extract image in memory
+	w := newMemoryWriter(tarutil.DefaultLimits)
+	if err := unpackImage(img, w, o.pathPrefixes); err != nil {
+		return resource, fmt.Errorf("failed to extract image: %w", err)
+	}
+	resource.fsys = w.FS()
+
+	return resource, nil
+}
+
+// IsDigestReference returns true if imageRef is a valid registry reference pinned by digest,
+// such as quay.io/example/bundle@sha256:....
+func IsDigestReference(imageRef string) bool {
 	ref, err := name.ParseReference(imageRef)
 	if err != nil {
-		return resource, fmt.Errorf("failed to parse image reference %q: %w", imageRef, err)
+		return false
+	}
+
+	_, ok := ref.(name.Digest)
+
+	return ok
+}
+
+// pulledImage is an image pulled from one of its pull candidates.
+type pulledImage struct {
+	image     v1.Image
+	candidate pullCandidate
+	// resolved is the digest the reference resolved to, which is the digest of the index for
+	// multi-platform images.
+	resolved v1.Hash
+	// verified is the digest whose signature was verified, empty when verification is disabled.
+	verified string
+}
+
+// pullImage pulls an image from the first of its pull candidates serving it.
+// When v is not nil, a candidate only serves the image if its signature is valid.
+func (o *options) pullImage(ctx context.Context, imageRef string, platform v1.Platform, v *verifier) (pulledImage, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return pulledImage{}, fmt.Errorf("failed to parse image reference %q: %w", imageRef, err)
+	}
+
+	candidates, err := pullCandidates(imageRef, o.mirrors)
+	if err != nil {
+		return pulledImage{}, err
 	}
 
+	keychain, err := o.keychain()
+	if err != nil {
+		return pulledImage{}, err
+	}
+
+	errs := make([]error, 0, len(candidates))
+	for _, candidate := range candidates {
+		pulled, err := o.pull(ctx, candidate, ref.Context().RegistryStr(), platform, v, keychain)
+		if err == nil {
+			return pulled, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	err = errors.Join(errs...)
+	if o.authenticator(ref.Context().RegistryStr(), ref.Context().RegistryStr()) == nil {
+		return pulledImage{}, fmt.Errorf("failed to pull image %s: %w\nEnsure you have authenticated with 'docker login' or 'podman login', or credentials are in a registry auth file", imageRef, err)
+	}
+
+	return pulledImage{}, fmt.Errorf("failed to pull image %s: %w", imageRef, err)
+}
+
+// pull fetches the image of a pull candidate, using the connection settings and credentials of
+// its registry. Global credentials belong to the source registry, so they are only sent to it and
+// mirrors authenticate with their own credentials or through keychain.
+// Multi-platform indexes resolve to the image of platform.
+// When v is not nil, the signature of the index or of the image is verified.
+func (o *options) pull(
+	ctx context.Context,
+	candidate pullCandidate,
+	sourceRegistry string,
+	platform v1.Platform,
+	v *verifier,
+	keychain authn.Keychain,
+) (pulledImage, error) {
+	ref, err := o.parseReference(candidate.ref, candidate.insecure)
+	if err != nil {
+		return pulledImage{}, err
+	}
+
+	registry := ref.Context().RegistryStr()
 	remoteOpts := []remote.Option{remote.WithContext(ctx)}
 
-	if cfg.username != "" && cfg.password != "" {
-		remoteOpts = append(remoteOpts, remote.WithAuth(&authn.Basic{
-			Username: cfg.username,
-			Password: cfg.password,
-		}))
+	if auth := o.authenticator(registry, sourceRegistry); auth != nil {
+		remoteOpts = append(remoteOpts, remote.WithAuth(auth))
 	} else {
-		// DefaultKeychain reads from Docker config, credential helpers, and platform keychains
-		remoteOpts = append(remoteOpts, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		remoteOpts = append(remoteOpts, remote.WithAuthFromKeychain(keychain))
+	}
+
+	transport, err := o.transport(registry, candidate.insecure)
+	if err != nil {
+		return pulledImage{}, fmt.Errorf("failed to configure connection to %s: %w", registry, err)
+	}
+
+	if transport == nil {
+		transport = remote.DefaultTransport
 	}
 
-	if cfg.insecure {
-		remoteOpts = append(remoteOpts, remote.WithTransport(remote.DefaultTransport))
+	// Retries are handled by retryTransport, which reports them, instead of the remote package
+	remoteOpts = append(remoteOpts,
+		remote.WithTransport(&retryTransport{inner: transport, policy: o.retry, onRetry: o.onRetry}),
+		remote.WithRetryBackoff(remote.Backoff{Steps: 1}),
+	)
+
+	img, resolved, err := resolveImage(ref, platform, remoteOpts)
+	if err != nil {
+		return pulledImage{}, fmt.Errorf("%s: %w", candidate.ref, err)
+	}
+
+	pulled := pulledImage{image: img, candidate: candidate, resolved: resolved}
+	if v == nil {
+		return pulled, nil
+	}
+
+	digests := []v1.Hash{resolved}
+	if digest, err := img.Digest(); err == nil && digest != resolved {
+		digests = append(digests, digest)
 	}
 
-	// Pull the image
-	img, err := remote.Image(ref, remoteOpts...)
+	verified, err := v.verify(ref.Context(), digests, remoteOpts)
 	if err != nil {
-		if cfg.username == "" && cfg.password == "" {
-			return resource, fmt.Errorf("failed to pull image %s: %w\nEnsure you have authenticated with 'docker login' or credentials are in ~/.docker/config.json", imageRef, err)
+		return pulledImage{}, fmt.Errorf("%s: %w", candidate.ref, err)
+	}
+	pulled.verified = verified.String()
+
+	return pulled, nil
+}
+
+// resolveImage fetches the image of ref, resolving multi-platform indexes to the image of platform.
+// It also returns the digest ref resolved to, which is the digest of the index for multi-platform images.
+func resolveImage(ref name.Reference, platform v1.Platform, opts []remote.Option) (v1.Image, v1.Hash, error) {
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, v1.Hash{}, err
 		}
 
-		return resource, fmt.Errorf("failed to pull image %s: %w", imageRef, err)
+		return img, desc.Digest, nil
 	}
 
-	// Extract image to temporary directory
-	if err := unpackImage(img, tmpDir, cfg.pathPrefixes); err != nil {
-		return resource, fmt.Errorf("failed to extract image: %w", err)
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, v1.Hash{}, err
 	}
 
-	return resource, nil
+	img, err := platformImage(idx, platform)
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+
+	return img, desc.Digest, nil
 }
@@ -0,0 +1,381 @@
+package registry_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/pem"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// newLayer creates an image layer containing the given files.
+func newLayer(t *testing.T, files map[string]string) v1.Layer {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	for path, content := range files {
+		g.Expect(tw.WriteHeader(&tar.Header{
+			Name:     path,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})).To(Succeed())
+
+		_, err := tw.Write([]byte(content))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+
+	layer, err := tarball.LayerFromReader(&buf)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return layer
+}
+
+// newTestServer returns an unstarted server of an in-memory registry, serving requests through
+// middleware when set, and the host of a plain HTTP server of the same registry to push images to.
+func newTestServer(t *testing.T, middleware func(http.Handler) http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	var handler http.Handler = ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+
+	push := httptest.NewServer(handler)
+	t.Cleanup(push.Close)
+
+	if middleware != nil {
+		handler = middleware(handler)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	t.Cleanup(server.Close)
+
+	return server, strings.TrimPrefix(push.URL, "http://")
+}
+
+// newTestImage starts an in-memory registry serving requests through middleware, pushes an image
+// to repo and returns the image reference.
+func newTestImage(t *testing.T, repo string, middleware func(http.Handler) http.Handler) string {
+	t.Helper()
+
+	server, pushHost := newTestServer(t, middleware)
+	server.Start()
+
+	pushImage(t, pushHost, repo, newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+	return strings.TrimPrefix(server.URL, "http://") + "/" + repo + ":latest"
+}
+
+// newTestRegistry starts an in-memory registry, returning its host and a counter of blob requests.
+func newTestRegistry(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	blobRequests := &atomic.Int32{}
+
+	server, _ := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+				blobRequests.Add(1)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	server.Start()
+
+	return strings.TrimPrefix(server.URL, "http://"), blobRequests
+}
+
+// newTLSTestRegistry starts an in-memory registry serving HTTPS with a self-signed certificate,
+// pushes an image to it and returns the image reference and the path of the server CA file.
+func newTLSTestRegistry(t *testing.T) (string, string) {
+	t.Helper()
+
+	server, pushHost := newTestServer(t, nil)
+	server.StartTLS()
+
+	pushImage(t, pushHost, "bundle", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	NewWithT(t).Expect(os.WriteFile(caFile, caPEM, 0600)).To(Succeed())
+
+	return strings.TrimPrefix(server.URL, "https://") + "/bundle:latest", caFile
+}
+
+// newPlainHTTPTestRegistry starts an in-memory registry serving plain HTTP on 127.0.0.2, which, unlike
+// 127.0.0.1 and localhost, is not implicitly treated as an HTTP registry, and pushes an image to it.
+func newPlainHTTPTestRegistry(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("loopback address 127.0.0.2 not available: %v", err)
+	}
+
+	server, pushHost := newTestServer(t, nil)
+	_ = server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+
+	pushImage(t, pushHost, "bundle", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+	return listener.Addr().String() + "/bundle:latest"
+}
+
+// pushImage pushes an image with the given layers and returns its reference.
+func pushImage(t *testing.T, host string, repo string, layers ...v1.Layer) string {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ref, err := name.ParseReference(host + "/" + repo + ":latest")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(remote.Write(ref, img)).To(Succeed())
+
+	return ref.String()
+}
+
+func TestExtractImage(t *testing.T) {
+	t.Run("extracts in memory without cache", func(t *testing.T) {
+		g := NewWithT(t)
+
+		host, _ := newTestRegistry(t)
+		ref := pushImage(t, host, "bundle", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+		resource, err := registry.ExtractImage(
+			t.Context(), ref,
+			registry.WithTempDir(t.TempDir()),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.Digest()).To(HavePrefix("sha256:"))
+		g.Expect(resource.Dir()).To(BeEmpty())
+		g.Expect(fs.ReadFile(resource.FS(), "manifests/csv.yaml")).To(BeEquivalentTo("kind: CSV"))
+
+		resource.Cleanup()
+		g.Expect(resource.FS()).To(BeNil())
+	})
+
+	t.Run("serves repeated extractions from the cache", func(t *testing.T) {
+		g := NewWithT(t)
+
+		host, blobRequests := newTestRegistry(t)
+		ref := pushImage(t, host, "catalog",
+			newLayer(t, map[string]string{"etc/os-release": "base"}),
+			newLayer(t, map[string]string{"configs/index.json": "{}"}),
+		)
+
+		cacheDir := t.TempDir()
+		opts := []registry.Option{
+			registry.WithCacheDir(cacheDir),
+			registry.WithPathPrefixes([]string{"/configs/"}),
+		}
+
+		first, err := registry.ExtractImage(t.Context(), ref, opts...)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(filepath.Join(first.Dir(), "configs", "index.json")).To(BeARegularFile())
+		g.Expect(first.Dir()).To(HavePrefix(cacheDir))
+
+		// Each layer is downloaded once
+		downloads := blobRequests.Load()
+		g.Expect(downloads).To(BeNumerically("<=", 3))
+
+		// Cached content survives cleanup
+		first.Cleanup()
+		g.Expect(first.Dir()).To(BeADirectory())
+
+		second, err := registry.ExtractImage(t.Context(), ref, opts...)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(second.Dir()).To(Equal(first.Dir()))
+		g.Expect(second.Digest()).To(Equal(first.Digest()))
+		g.Expect(blobRequests.Load()).To(Equal(downloads))
+	})
+
+	t.Run("reuses cached layers for different path prefixes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		host, blobRequests := newTestRegistry(t)
+		ref := pushImage(t, host, "bundle", newLayer(t, map[string]string{
+			"manifests/csv.yaml":         "kind: CSV",
+			"metadata/annotations.yaml":  "annotations: {}",
+			"configs/unrelated/doc.yaml": "{}",
+		}))
+
+		cacheDir := t.TempDir()
+
+		_, err := registry.ExtractImage(t.Context(), ref,
+			registry.WithCacheDir(cacheDir),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		downloads := blobRequests.Load()
+
+		resource, err := registry.ExtractImage(t.Context(), ref,
+			registry.WithCacheDir(cacheDir),
+			registry.WithPathPrefixes([]string{"/metadata/"}),
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(filepath.Join(resource.Dir(), "metadata", "annotations.yaml")).To(BeARegularFile())
+		g.Expect(blobRequests.Load()).To(Equal(downloads))
+
+		entries, err := os.ReadDir(filepath.Join(cacheDir, "images"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(HaveLen(2))
+	})
+}
+
+func TestExtractImageRequireDigest(t *testing.T) {
+	host, _ := newTestRegistry(t)
+	ref := pushImage(t, host, "bundle", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+	t.Run("refuses tag references", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := registry.ExtractImage(t.Context(), ref, registry.WithRequireDigest(true))
+
+		g.Expect(err).To(MatchError(ContainSubstring("is not pinned by digest")))
+	})
+
+	t.Run("extracts digest references", func(t *testing.T) {
+		g := NewWithT(t)
+
+		digest := imageDigest(t, ref)
+
+		resource, err := registry.ExtractImage(t.Context(), host+"/bundle@"+digest.String(),
+			registry.WithRequireDigest(true),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+		t.Cleanup(resource.Cleanup)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.Digest()).To(Equal(digest.String()))
+	})
+}
+
+func TestExtractImageTLS(t *testing.T) {
+	ref, caFile := newTLSTestRegistry(t)
+	host := strings.Split(ref, "/")[0]
+
+	extract := func(t *testing.T, opts ...registry.Option) error {
+		t.Helper()
+
+		opts = append(opts,
+			registry.WithTempDir(t.TempDir()),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+
+		resource, err := registry.ExtractImage(t.Context(), ref, opts...)
+		defer resource.Cleanup()
+
+		return err
+	}
+
+	t.Run("rejects self-signed certificate by default", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t)).To(MatchError(ContainSubstring("certificate")))
+	})
+
+	t.Run("skips verification when insecure", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithInsecure(true))).To(Succeed())
+	})
+
+	t.Run("skips verification for insecure host", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithHostConfig(host, registry.HostConfig{Insecure: true}))).To(Succeed())
+	})
+
+	t.Run("trusts global CA file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithCAFile(caFile))).To(Succeed())
+	})
+
+	t.Run("trusts CA file of matching host only", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithHostConfig(host, registry.HostConfig{CAFile: caFile}))).To(Succeed())
+		g.Expect(extract(t, registry.WithHostConfig("other.example.com", registry.HostConfig{CAFile: caFile}))).
+			To(MatchError(ContainSubstring("certificate")))
+	})
+
+	t.Run("returns error for invalid CA file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		invalid := filepath.Join(t.TempDir(), "ca.pem")
+		g.Expect(os.WriteFile(invalid, []byte("not a certificate"), 0600)).To(Succeed())
+
+		g.Expect(extract(t, registry.WithCAFile(invalid))).To(MatchError(ContainSubstring("no PEM certificates found")))
+	})
+}
+
+func TestExtractImagePlainHTTP(t *testing.T) {
+	ref := newPlainHTTPTestRegistry(t)
+	host := strings.Split(ref, "/")[0]
+
+	extract := func(t *testing.T, opts ...registry.Option) error {
+		t.Helper()
+
+		opts = append(opts,
+			registry.WithTempDir(t.TempDir()),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+
+		resource, err := registry.ExtractImage(t.Context(), ref, opts...)
+		defer resource.Cleanup()
+
+		return err
+	}
+
+	t.Run("requires HTTPS by default", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t)).To(MatchError(ContainSubstring("HTTP response to HTTPS client")))
+	})
+
+	t.Run("falls back to plain HTTP when insecure", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithInsecure(true))).To(Succeed())
+	})
+
+	t.Run("falls back to plain HTTP for insecure host", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(extract(t, registry.WithHostConfig(host, registry.HostConfig{Insecure: true}))).To(Succeed())
+		g.Expect(extract(t, registry.WithHostConfig("other.example.com", registry.HostConfig{Insecure: true}))).
+			To(MatchError(ContainSubstring("HTTP response to HTTPS client")))
+	})
+}
@@ -0,0 +1,253 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRetries is the default number of times a failed registry request is retried.
+	DefaultRetries = 4
+
+	// DefaultRetryDelay is the default delay before the first retry, doubled on each retry.
+	DefaultRetryDelay = time.Second
+
+	// DefaultRequestTimeout is the default time a registry has to answer a single request.
+	DefaultRequestTimeout = time.Minute
+
+	// maxRetryDelay caps the exponential backoff between retries.
+	maxRetryDelay = 30 * time.Second
+
+	// maxRetryAfter caps the delays requested by registries through Retry-After.
+	maxRetryAfter = 5 * time.Minute
+)
+
+// errRequestTimeout is returned when a registry does not answer a request in time.
+var errRequestTimeout = errors.New("request timed out")
+
+// RetryPolicy configures how failed registry requests are retried.
+// Requests are retried on connection resets, timeouts and on the 408, 429, 500, 502, 503 and
+// 504 status codes, waiting Delay before the first retry and twice as long on each further
+// retry, or as long as the registry asks for with a Retry-After header.
+type RetryPolicy struct {
+	// Retries is the number of times a failed request is retried. 0 disables retries.
+	Retries int
+
+	// Delay is the delay before the first retry.
+	Delay time.Duration
+
+	// RequestTimeout is the time a registry has to answer a single request, after which the
+	// request is retried. Reading the response body is bounded by the overall timeout only.
+	// 0 disables the timeout.
+	RequestTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used unless configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Retries:        DefaultRetries,
+		Delay:          DefaultRetryDelay,
+		RequestTimeout: DefaultRequestTimeout,
+	}
+}
+
+// Retry describes a failed registry request about to be retried.
+type Retry struct {
+	// URL is the URL of the request.
+	URL string
+
+	// Attempt is the number of the retry, starting at 1, out of Retries.
+	Attempt int
+	Retries int
+
+	// Delay is the time waited before retrying.
+	Delay time.Duration
+
+	// Reason is the error or the status of the failed request.
+	Reason string
+}
+
+// String describes the retry, as reported to users.
+func (r Retry) String() string {
+	return fmt.Sprintf("retry %d/%d of %s in %s: %s", r.Attempt, r.Retries, r.URL, r.Delay, r.Reason)
+}
+
+// retryTransport retries failed requests of its inner transport according to a retry policy.
+type retryTransport struct {
+	inner   http.RoundTripper
+	policy  RetryPolicy
+	onRetry func(Retry)
+}
+
+// RoundTrip sends the request, retrying it while it fails with a transient error.
+// Only requests without a body, as used to pull images, are retried.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.roundTrip(req)
+		if attempt > t.policy.Retries || (req.Body != nil && req.Body != http.NoBody) {
+			return resp, err
+		}
+
+		reason, retryable := retryReason(resp, err)
+		if !retryable {
+			return resp, err
+		}
+
+		delay := t.delay(attempt, resp)
+
+		// Give up early rather than being interrupted while waiting
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if t.onRetry != nil {
+			t.onRetry(Retry{
+				URL:     req.URL.Redacted(),
+				Attempt: attempt,
+				Retries: t.policy.Retries,
+				Delay:   delay,
+				Reason:  reason,
+			})
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip sends the request once, failing when the response headers are not received
+// within the request timeout.
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.RequestTimeout <= 0 {
+		return t.inner.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.policy.RequestTimeout, cancel)
+
+	resp, err := t.inner.RoundTrip(req.WithContext(ctx))
+
+	if !timer.Stop() {
+		cancel()
+
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		return nil, fmt.Errorf("%s %s: %w after %s", req.Method, req.URL.Redacted(), errRequestTimeout, t.policy.RequestTimeout)
+	}
+
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	// The request context must live as long as the response body is read
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// delay returns how long to wait before a retry: the exponential backoff of the attempt, or the
+// delay requested by the registry through Retry-After when longer.
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	delay := t.policy.Delay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, maxRetryDelay)
+
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			delay = max(delay, min(retryAfter, maxRetryAfter))
+		}
+	}
+
+	return delay
+}
+
+// retryReason returns why a request failed and whether it may succeed when retried.
+func retryReason(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		var netErr net.Error
+
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return "", false
+		case errors.Is(err, errRequestTimeout),
+			errors.Is(err, io.ErrUnexpectedEOF),
+			errors.Is(err, io.EOF),
+			errors.Is(err, syscall.ECONNRESET),
+			errors.As(err, &netErr) && netErr.Timeout():
+			return err.Error(), true
+		default:
+			return "", false
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return resp.Status, true
+	default:
+		return "", false
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, holding either a number of seconds or a date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// cancelBody releases the context of a request when its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context of the request.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
@@ -0,0 +1,164 @@
+package registry_test
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// failManifests answers manifest requests with fail as long as it returns true.
+func failManifests(fail func(w http.ResponseWriter, r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") && fail(w, r) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// failTimes answers the first n requests with status and a Retry-After header.
+func failTimes(n int32, status int) func(w http.ResponseWriter, r *http.Request) bool {
+	failures := &atomic.Int32{}
+
+	return func(w http.ResponseWriter, _ *http.Request) bool {
+		if failures.Add(1) > n {
+			return false
+		}
+
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+
+		return true
+	}
+}
+
+// hang answers requests after delay, or never if delay is 0.
+func hang(delay time.Duration) func(w http.ResponseWriter, r *http.Request) bool {
+	hangs := &atomic.Int32{}
+
+	return func(_ http.ResponseWriter, r *http.Request) bool {
+		if delay > 0 && hangs.Add(1) > 1 {
+			return false
+		}
+
+		wait := delay
+		if wait == 0 {
+			wait = time.Minute
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(wait):
+		}
+
+		return true
+	}
+}
+
+func TestExtractImageRetry(t *testing.T) {
+	policy := registry.RetryPolicy{
+		Retries:        3,
+		Delay:          time.Millisecond,
+		RequestTimeout: time.Minute,
+	}
+
+	extract := func(t *testing.T, imageRef string, opts ...registry.Option) ([]registry.Retry, error) {
+		t.Helper()
+
+		retries := make([]registry.Retry, 0)
+
+		resource, err := registry.ExtractImage(t.Context(), imageRef, append([]registry.Option{
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+			registry.WithRetryPolicy(policy),
+			registry.WithOnRetry(func(r registry.Retry) {
+				retries = append(retries, r)
+			}),
+		}, opts...)...)
+		t.Cleanup(resource.Cleanup)
+
+		return retries, err
+	}
+
+	t.Run("retries unavailable registries", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(failTimes(2, http.StatusServiceUnavailable)))
+
+		retries, err := extract(t, ref)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(retries).To(HaveLen(2))
+		g.Expect(retries[0].Attempt).To(Equal(1))
+		g.Expect(retries[0].Retries).To(Equal(3))
+		g.Expect(retries[0].Reason).To(ContainSubstring("503"))
+		g.Expect(retries[1].Delay).To(Equal(2 * time.Millisecond))
+	})
+
+	t.Run("retries rate limited requests", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(failTimes(1, http.StatusTooManyRequests)))
+
+		retries, err := extract(t, ref)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(retries).To(HaveLen(1))
+	})
+
+	t.Run("gives up after the configured retries", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(failTimes(10, http.StatusBadGateway)))
+
+		retries, err := extract(t, ref)
+
+		g.Expect(err).To(MatchError(ContainSubstring("failed to pull image")))
+		g.Expect(retries).To(HaveLen(3))
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(failTimes(1, http.StatusForbidden)))
+
+		retries, err := extract(t, ref)
+
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(retries).To(BeEmpty())
+	})
+
+	t.Run("retries requests timing out", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(hang(time.Second)))
+
+		retries, err := extract(t, ref, registry.WithRetryPolicy(registry.RetryPolicy{
+			Retries:        1,
+			Delay:          time.Millisecond,
+			RequestTimeout: 50 * time.Millisecond,
+		}))
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(retries).To(HaveLen(1))
+		g.Expect(retries[0].Reason).To(ContainSubstring("timed out"))
+	})
+
+	t.Run("fails when the extraction times out", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := newTestImage(t, "bundle", failManifests(hang(0)))
+
+		_, err := extract(t, ref, registry.WithTimeout(50*time.Millisecond))
+
+		g.Expect(err).To(MatchError(ContainSubstring("timed out after 50ms")))
+	})
+}
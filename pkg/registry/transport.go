@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// HostConfig holds connection settings that only apply to a single registry.
+type HostConfig struct {
+	// Insecure allows plain HTTP and skips TLS certificate verification for the registry.
+	Insecure bool
+
+	// CAFile is a PEM bundle of certificate authorities trusted for the registry,
+	// in addition to the system roots and the global CA file.
+	CAFile string
+
+	// Username and Password authenticate to the registry, taking precedence over the global
+	// credentials and the keychain.
+	Username string
+	Password string
+
+	// Token is a bearer token sent to the registry, taking precedence over Username and Password.
+	Token string
+}
+
+// parseReference parses imageRef, marking the registry as insecure when configured or
+// forced so that plain HTTP is used as a fallback when HTTPS is not available.
+func (o *options) parseReference(imageRef string, forceInsecure bool) (name.Reference, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %w", imageRef, err)
+	}
+
+	if !forceInsecure && !o.isInsecure(ref.Context().RegistryStr()) {
+		return ref, nil
+	}
+
+	ref, err = name.ParseReference(imageRef, name.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %w", imageRef, err)
+	}
+
+	return ref, nil
+}
+
+// isInsecure returns true if connections to the registry may skip TLS verification.
+func (o *options) isInsecure(registry string) bool {
+	return o.insecure || o.hosts[registry].Insecure
+}
+
+// transport returns the HTTP transport used to connect to the registry, skipping TLS
+// verification when configured or forced. Returns nil when the default transport can be used.
+func (o *options) transport(registry string, forceInsecure bool) (http.RoundTripper, error) {
+	host := o.hosts[registry]
+
+	caFiles := make([]string, 0, 2) //nolint:mnd
+	if o.caFile != "" {
+		caFiles = append(caFiles, o.caFile)
+	}
+	if host.CAFile != "" {
+		caFiles = append(caFiles, host.CAFile)
+	}
+
+	insecure := forceInsecure || o.isInsecure(registry)
+	if !insecure && len(caFiles) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	base, ok := remote.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected default transport type %T", remote.DefaultTransport)
+	}
+
+	t := base.Clone()
+	t.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//nolint:gosec // Explicitly requested for registries with self-signed certificates
+		InsecureSkipVerify: insecure,
+	}
+
+	if len(caFiles) > 0 {
+		pool, err := loadCertPool(caFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	return t, nil
+}
+
+// loadCertPool returns the system certificate pool extended with the certificates in caFiles.
+func loadCertPool(caFiles []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, caFile := range caFiles {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", caFile, err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", caFile)
+		}
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// signatureAnnotation holds the base64 encoded signature of a cosign signature layer.
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// signatureType is the critical type of cosign simple signing payloads.
+	signatureType = "cosign container image signature"
+
+	// maxPayloadSize bounds the size of signature payloads read from registries.
+	maxPayloadSize = 1 << 20
+)
+
+// simpleSigning is the payload signed by cosign, binding a signature to a manifest digest.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifier checks cosign-style signatures with a public key, without contacting a transparency log.
+type verifier struct {
+	key crypto.PublicKey
+}
+
+// loadVerifier loads a PEM encoded ECDSA, RSA or Ed25519 public key, as written by cosign generate-key-pair.
+func loadVerifier(path string) (*verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse verification key %s: no PEM data found", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification key %s: %w", path, err)
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return &verifier{key: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported verification key type %T", key)
+	}
+}
+
+// verify checks that one of digests has a valid signature in repo, stored as the image tagged
+// <algorithm>-<hex>.sig as cosign does, and returns that digest.
+// Digests are tried in order, so that an index can be verified through its own signature or the
+// signature of the platform image.
+func (v *verifier) verify(repo name.Repository, digests []v1.Hash, opts []remote.Option) (v1.Hash, error) {
+	errs := make([]error, 0, len(digests))
+	for _, digest := range digests {
+		err := v.verifyDigest(repo, digest, opts)
+		if err == nil {
+			return digest, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return v1.Hash{}, fmt.Errorf("signature verification failed: %w", errors.Join(errs...))
+}
+
+// verifyDigest checks the signatures of a single digest, succeeding if any of them is valid.
+func (v *verifier) verifyDigest(repo name.Repository, digest v1.Hash, opts []remote.Option) error {
+	tag := repo.Tag(fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex))
+
+	sigs, err := remote.Image(tag, opts...)
+	if err != nil {
+		return fmt.Errorf("no signature found for %s: %w", digest, err)
+	}
+
+	manifest, err := sigs.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to read signatures of %s: %w", digest, err)
+	}
+
+	errs := make([]error, 0, len(manifest.Layers))
+	for _, desc := range manifest.Layers {
+		sig, ok := desc.Annotations[signatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		if err := v.verifyLayer(sigs, desc.Digest, sig, digest); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("no signature found for %s", digest)
+	}
+
+	return fmt.Errorf("no valid signature for %s: %w", digest, errors.Join(errs...))
+}
+
+// verifyLayer checks the signature of a signature layer payload, and that the payload is bound
+// to digest.
+func (v *verifier) verifyLayer(sigs v1.Image, layerDigest v1.Hash, sig string, digest v1.Hash) error {
+	layer, err := sigs.LayerByDigest(layerDigest)
+	if err != nil {
+		return fmt.Errorf("failed to get signature payload: %w", err)
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to get signature payload: %w", err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	payload, err := io.ReadAll(io.LimitReader(rc, maxPayloadSize))
+	if err != nil {
+		return fmt.Errorf("failed to read signature payload: %w", err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	if err := v.verifySignature(payload, raw); err != nil {
+		return err
+	}
+
+	var p simpleSigning
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse signature payload: %w", err)
+	}
+
+	if p.Critical.Type != signatureType {
+		return fmt.Errorf("unexpected signature type %q", p.Critical.Type)
+	}
+
+	if p.Critical.Image.DockerManifestDigest != digest.String() {
+		return fmt.Errorf("signature is for digest %s", p.Critical.Image.DockerManifestDigest)
+	}
+
+	return nil
+}
+
+// verifySignature checks a signature of payload with the public key.
+// ECDSA and RSA keys sign the SHA-256 hash of the payload, Ed25519 keys the payload itself.
+func (v *verifier) verifySignature(payload []byte, sig []byte) error {
+	hash := sha256.Sum256(payload)
+
+	valid := false
+
+	switch key := v.key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, hash[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, payload, sig)
+	}
+
+	if !valid {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package registry_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+// newSigningKey generates an ECDSA key, as cosign does, and writes its public key to a PEM file.
+func newSigningKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	g.Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)).To(Succeed())
+
+	return key, path
+}
+
+// pushSignature signs digest with key and pushes the signature next to the image of ref, the way
+// cosign stores signatures. The payload binds the signature to signedDigest.
+func pushSignature(t *testing.T, ref string, key *ecdsa.PrivateKey, digest v1.Hash, signedDigest v1.Hash) {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"` + ref + `"},` +
+		`"image":{"docker-manifest-digest":"` + signedDigest.String() + `"},` +
+		`"type":"cosign container image signature"},"optional":null}`)
+
+	hash := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	g.Expect(err).ToNot(HaveOccurred())
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer: static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{
+			"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(sig),
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	r, err := name.ParseReference(ref)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tag := r.Context().Tag(digest.Algorithm + "-" + digest.Hex + ".sig")
+	g.Expect(remote.Write(tag, img)).To(Succeed())
+}
+
+// imageDigest returns the digest an image reference resolves to.
+func imageDigest(t *testing.T, ref string) v1.Hash {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	r, err := name.ParseReference(ref)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	desc, err := remote.Head(r)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return desc.Digest
+}
+
+func TestExtractImageVerification(t *testing.T) {
+	host, _ := newTestRegistry(t)
+	key, keyFile := newSigningKey(t)
+
+	extract := func(t *testing.T, imageRef string, keyFile string) (registry.Resource, error) {
+		t.Helper()
+
+		resource, err := registry.ExtractImage(t.Context(), imageRef,
+			registry.WithVerifyKey(keyFile),
+			registry.WithPathPrefixes([]string{"/manifests/"}),
+		)
+		t.Cleanup(resource.Cleanup)
+
+		return resource, err
+	}
+
+	t.Run("extracts images with a valid signature", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := pushImage(t, host, "signed", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+		digest := imageDigest(t, ref)
+		pushSignature(t, ref, key, digest, digest)
+
+		resource, err := extract(t, ref, keyFile)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.VerifiedDigest()).To(Equal(digest.String()))
+	})
+
+	t.Run("accepts the signature of a multi-platform index", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := pushIndex(t, host, "signed-index", map[string]string{"linux/amd64": "kind: CSV"})
+		digest := imageDigest(t, ref)
+		pushSignature(t, ref, key, digest, digest)
+
+		resource, err := extract(t, ref, keyFile)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resource.VerifiedDigest()).To(Equal(digest.String()))
+	})
+
+	t.Run("fails for unsigned images", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := pushImage(t, host, "unsigned", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+
+		_, err := extract(t, ref, keyFile)
+
+		g.Expect(err).To(MatchError(ContainSubstring("no signature found")))
+	})
+
+	t.Run("fails for signatures of another key", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := pushImage(t, host, "other-key", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+		digest := imageDigest(t, ref)
+		other, _ := newSigningKey(t)
+		pushSignature(t, ref, other, digest, digest)
+
+		_, err := extract(t, ref, keyFile)
+
+		g.Expect(err).To(MatchError(ContainSubstring("invalid signature")))
+	})
+
+	t.Run("fails for signatures of another digest", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ref := pushImage(t, host, "replayed", newLayer(t, map[string]string{"manifests/csv.yaml": "kind: CSV"}))
+		digest := imageDigest(t, ref)
+		pushSignature(t, ref, key, digest, v1.Hash{Algorithm: "sha256", Hex: digest.Hex[1:] + "0"})
+
+		_, err := extract(t, ref, keyFile)
+
+		g.Expect(err).To(MatchError(ContainSubstring("signature is for digest")))
+	})
+
+	t.Run("rejects local references", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := extract(t, "oci:"+t.TempDir(), keyFile)
+
+		g.Expect(err).To(MatchError(ContainSubstring("not supported for local image")))
+	})
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats supported by commands that render structured data.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+const (
+	tableMinWidth = 0
+	tableTabWidth = 8
+	tablePadding  = 3
+)
+
+// ValidateFormat returns an error if format is not one of the supported output formats.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q (supported: %s, %s, %s)", format, FormatTable, FormatJSON, FormatYAML)
+	}
+}
+
+// JSON writes a value to the writer as indented JSON.
+func JSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", strings.Repeat(" ", yamlIndent))
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
+
+// YAMLValue writes a value to the writer as a single YAML document.
+// JSON struct tags are honored, so the output mirrors the JSON representation.
+func YAMLValue(w io.Writer, value any) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write YAML: %w", err)
+	}
+
+	return nil
+}
+
+// Value writes value in the given output format, calling table to build the headers and rows
+// for table output only.
+func Value(w io.Writer, format string, value any, table func() ([]string, [][]string)) error {
+	switch format {
+	case FormatJSON:
+		return JSON(w, value)
+	case FormatYAML:
+		return YAMLValue(w, value)
+	default:
+		headers, rows := table()
+
+		return Table(w, headers, rows)
+	}
+}
+
+// Table writes rows as a column-aligned table with the given headers.
+func Table(w io.Writer, headers []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, tableMinWidth, tableTabWidth, tablePadding, ' ', 0)
+
+	if _, err := fmt.Fprintln(tw, strings.Join(headers, "\t")); err != nil {
+		return fmt.Errorf("failed to write table header: %w", err)
+	}
+
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return fmt.Errorf("failed to write table row: %w", err)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush table: %w", err)
+	}
+
+	return nil
+}
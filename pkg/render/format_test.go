@@ -0,0 +1,83 @@
+package render_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/render"
+
+	. "github.com/onsi/gomega"
+)
+
+type sample struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+func TestValidateFormat(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(render.ValidateFormat(render.FormatTable)).To(Succeed())
+	g.Expect(render.ValidateFormat(render.FormatJSON)).To(Succeed())
+	g.Expect(render.ValidateFormat(render.FormatYAML)).To(Succeed())
+	g.Expect(render.ValidateFormat("xml")).To(MatchError(ContainSubstring(`unsupported output format "xml"`)))
+}
+
+func TestJSON(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	err := render.JSON(&buf, []sample{{Name: "a", Version: "1.0.0"}})
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(MatchJSON(`[{"name":"a","version":"1.0.0"}]`))
+}
+
+func TestYAMLValue(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	err := render.YAMLValue(&buf, []sample{{Name: "a"}})
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("- name: a\n"))
+}
+
+func TestTable(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	err := render.Table(&buf, []string{"NAME", "VERSION"}, [][]string{{"operator", "1.0.0"}, {"op", "2.0.0"}})
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("NAME       VERSION\noperator   1.0.0\nop         2.0.0\n"))
+}
+
+func TestValue(t *testing.T) {
+	value := []sample{{Name: "operator", Version: "1.0.0"}}
+	table := func() ([]string, [][]string) {
+		return []string{"NAME", "VERSION"}, [][]string{{"operator", "1.0.0"}}
+	}
+
+	t.Run("renders table", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var buf bytes.Buffer
+		g.Expect(render.Value(&buf, render.FormatTable, value, table)).To(Succeed())
+		g.Expect(buf.String()).To(Equal("NAME       VERSION\noperator   1.0.0\n"))
+	})
+
+	t.Run("renders JSON without building the table", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var buf bytes.Buffer
+		err := render.Value(&buf, render.FormatJSON, value, func() ([]string, [][]string) {
+			t.Fatal("table must not be built for JSON output")
+
+			return nil, nil
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(buf.String()).To(MatchJSON(`[{"name":"operator","version":"1.0.0"}]`))
+	})
+}
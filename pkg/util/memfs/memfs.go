@@ -0,0 +1,229 @@
+// Package memfs provides a read-only in-memory fs.FS, populated by writing files to it.
+package memfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// dirMode is the mode of all directories, as the file system is read-only.
+const dirMode = fs.ModeDir | 0555
+
+// FS is an in-memory file system.
+// It is populated with WriteFile and MkdirAll, and read through the fs.FS interfaces.
+// It is not safe for concurrent writes.
+type FS struct {
+	nodes map[string]*node
+}
+
+// node is a file or directory of the file system.
+type node struct {
+	name     string
+	data     []byte
+	mode     fs.FileMode
+	children map[string]bool
+}
+
+// New creates an empty file system.
+func New() *FS {
+	return &FS{
+		nodes: map[string]*node{
+			".": {name: ".", mode: dirMode, children: make(map[string]bool)},
+		},
+	}
+}
+
+// WriteFile stores a file, creating its parent directories as needed.
+// The data is retained rather than copied.
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := f.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+
+	if n, ok := f.nodes[name]; ok && n.mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+
+	f.nodes[name] = &node{name: path.Base(name), data: data, mode: perm.Perm()}
+	f.nodes[path.Dir(name)].children[path.Base(name)] = true
+
+	return nil
+}
+
+// MkdirAll creates a directory and its parents as needed.
+func (f *FS) MkdirAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if n, ok := f.nodes[name]; ok {
+		if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+
+		return nil
+	}
+
+	if err := f.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+
+	f.nodes[name] = &node{name: path.Base(name), mode: dirMode, children: make(map[string]bool)}
+	f.nodes[path.Dir(name)].children[path.Base(name)] = true
+
+	return nil
+}
+
+// Open opens the named file or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	n, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.mode.IsDir() {
+		return &openDir{node: n, entries: f.entries(name)}, nil
+	}
+
+	return &openFile{node: n, reader: bytes.NewReader(n.data)}, nil
+}
+
+// ReadFile returns the content of the named file.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	n, err := f.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	return append([]byte(nil), n.data...), nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return f.entries(name), nil
+}
+
+// Stat returns information about the named file or directory.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo{n}, nil
+}
+
+// lookup returns the node of name.
+func (f *FS) lookup(op string, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	n, ok := f.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return n, nil
+}
+
+// entries returns the entries of a directory, sorted by name.
+func (f *FS) entries(dir string) []fs.DirEntry {
+	names := make([]string, 0, len(f.nodes[dir].children))
+	for name := range f.nodes[dir].children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(fileInfo{f.nodes[path.Join(dir, name)]}))
+	}
+
+	return entries
+}
+
+// fileInfo describes a node.
+type fileInfo struct {
+	node *node
+}
+
+func (i fileInfo) Name() string       { return i.node.name }
+func (i fileInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i fileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i fileInfo) Sys() any           { return nil }
+
+// openFile is an open regular file.
+type openFile struct {
+	node   *node
+	reader *bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return fileInfo{f.node}, nil }
+func (f *openFile) Read(p []byte) (int, error) { return f.reader.Read(p) }
+func (f *openFile) Close() error               { return nil }
+
+func (f *openFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *openFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.reader.ReadAt(p, off)
+}
+
+// openDir is an open directory.
+type openDir struct {
+	node    *node
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return fileInfo{d.node}, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining entries when n <= 0.
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(remaining))
+	d.offset += n
+
+	return remaining[:n], nil
+}
@@ -0,0 +1,59 @@
+package memfs_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lburgazzoli/olm-extractor/pkg/util/memfs"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFS(t *testing.T) {
+	t.Run("implements fs.FS", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys := memfs.New()
+		g.Expect(fsys.WriteFile("manifests/csv.yaml", []byte("kind: CSV"), 0644)).To(Succeed())
+		g.Expect(fsys.WriteFile("manifests/crd.yaml", []byte("kind: CRD"), 0644)).To(Succeed())
+		g.Expect(fsys.WriteFile("metadata/annotations.yaml", []byte("annotations: {}"), 0644)).To(Succeed())
+		g.Expect(fsys.MkdirAll("configs/empty")).To(Succeed())
+
+		g.Expect(fstest.TestFS(fsys,
+			"manifests/csv.yaml", "manifests/crd.yaml", "metadata/annotations.yaml", "configs/empty",
+		)).To(Succeed())
+	})
+
+	t.Run("replaces existing files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys := memfs.New()
+		g.Expect(fsys.WriteFile("manifests/csv.yaml", []byte("v1"), 0644)).To(Succeed())
+		g.Expect(fsys.WriteFile("manifests/csv.yaml", []byte("v2"), 0644)).To(Succeed())
+
+		data, err := fs.ReadFile(fsys, "manifests/csv.yaml")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(Equal("v2"))
+
+		entries, err := fs.ReadDir(fsys, "manifests")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(HaveLen(1))
+	})
+
+	t.Run("rejects files under files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fsys := memfs.New()
+		g.Expect(fsys.WriteFile("manifests", []byte("file"), 0644)).To(Succeed())
+		g.Expect(fsys.WriteFile("manifests/csv.yaml", []byte("kind: CSV"), 0644)).ToNot(Succeed())
+		g.Expect(fsys.WriteFile("../csv.yaml", []byte("kind: CSV"), 0644)).ToNot(Succeed())
+	})
+
+	t.Run("reports missing files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := fs.Stat(memfs.New(), "manifests")
+		g.Expect(err).To(MatchError(fs.ErrNotExist))
+	})
+}
@@ -2,6 +2,7 @@ package tar
 
 import (
 	"archive/tar"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,9 +10,134 @@ import (
 	"strings"
 )
 
+// Limits bounds the content extracted from archives.
+// A zero value disables the corresponding limit.
+type Limits struct {
+	// MaxFileSize is the maximum size of a single file, in bytes.
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size of all extracted files, in bytes.
+	MaxTotalSize int64
+	// MaxFiles is the maximum number of extracted entries.
+	MaxFiles int
+}
+
+// DefaultLimits are generous enough for the largest catalog images, including SQLite indexes,
+// while stopping decompression bombs before they fill the disk.
+//
+//nolint:gochecknoglobals,mnd // Sizes are self-describing
+var DefaultLimits = Limits{
+	MaxFileSize:  2 << 30,
+	MaxTotalSize: 8 << 30,
+	MaxFiles:     500_000,
+}
+
+// UnsafeEntryError reports an entry whose path or link target escapes the extraction root.
+// It indicates a malicious archive rather than a corrupt one.
+type UnsafeEntryError struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("illegal file path in tar: %s: %s", e.Name, e.Reason)
+}
+
+// LimitError reports an archive exceeding one of the extraction limits.
+type LimitError struct {
+	Name  string
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("tar entry %s exceeds the %s limit of %d", e.Name, e.Limit, e.Max)
+}
+
+// CorruptArchiveError reports an archive that cannot be read, such as truncated content.
+type CorruptArchiveError struct {
+	Err error
+}
+
+func (e *CorruptArchiveError) Error() string {
+	return fmt.Sprintf("corrupt tar archive: %v", e.Err)
+}
+
+func (e *CorruptArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// Usage tracks the entries extracted from archives against Limits.
+type Usage struct {
+	limits    Limits
+	files     int
+	totalSize int64
+}
+
+// NewUsage creates a Usage enforcing limits.
+func NewUsage(limits Limits) *Usage {
+	return &Usage{limits: limits}
+}
+
+// Add records an extracted entry of the given size, returning a LimitError if it exceeds the limits.
+func (u *Usage) Add(header *tar.Header, size int64) error {
+	if u.limits.MaxFiles > 0 && u.files >= u.limits.MaxFiles {
+		return &LimitError{Name: header.Name, Limit: "file count", Max: int64(u.limits.MaxFiles)}
+	}
+
+	if u.limits.MaxFileSize > 0 && size > u.limits.MaxFileSize {
+		return &LimitError{Name: header.Name, Limit: "file size", Max: u.limits.MaxFileSize}
+	}
+
+	if u.limits.MaxTotalSize > 0 && u.totalSize+size > u.limits.MaxTotalSize {
+		return &LimitError{Name: header.Name, Limit: "total size", Max: u.limits.MaxTotalSize}
+	}
+
+	u.files++
+	u.totalSize += size
+
+	return nil
+}
+
+// Extractor extracts tar entries to a target directory, enforcing its limits across all the
+// entries it extracts, so that a single Extractor can apply them to several archives such as
+// the layers of an image.
+type Extractor struct {
+	targetDir string
+	dirPerms  os.FileMode
+	usage     *Usage
+	symlinks  []string
+}
+
+// NewExtractor creates an Extractor writing to targetDir.
+func NewExtractor(targetDir string, dirPerms os.FileMode, limits Limits) *Extractor {
+	return &Extractor{
+		targetDir: filepath.Clean(targetDir),
+		dirPerms:  dirPerms,
+		usage:     NewUsage(limits),
+	}
+}
+
 // ExtractAll extracts all entries from a tar archive to the target directory.
-// It reads from the provided io.Reader and extracts each entry using ExtractEntry.
+// It reads from the provided io.Reader and extracts each entry using ExtractEntry,
+// enforcing DefaultLimits.
 func ExtractAll(reader io.Reader, targetDir string, dirPerms os.FileMode) error {
+	e := NewExtractor(targetDir, dirPerms, DefaultLimits)
+
+	if err := e.ExtractAll(reader); err != nil {
+		return err
+	}
+
+	return e.Verify()
+}
+
+// ExtractEntry extracts a single tar entry to the target directory, enforcing DefaultLimits.
+// It validates that the extraction path does not escape the target directory (path traversal protection).
+func ExtractEntry(header *tar.Header, tr *tar.Reader, targetDir string, dirPerms os.FileMode) error {
+	return NewExtractor(targetDir, dirPerms, DefaultLimits).Extract(header, tr)
+}
+
+// ExtractAll extracts all entries from a tar archive.
+func (e *Extractor) ExtractAll(reader io.Reader) error {
 	tr := tar.NewReader(reader)
 	for {
 		header, err := tr.Next()
@@ -19,10 +145,10 @@ func ExtractAll(reader io.Reader, targetDir string, dirPerms os.FileMode) error
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read tar header: %w", err)
+			return &CorruptArchiveError{Err: fmt.Errorf("failed to read tar header: %w", err)}
 		}
 
-		if err := ExtractEntry(header, tr, targetDir, dirPerms); err != nil {
+		if err := e.Extract(header, tr); err != nil {
 			return err
 		}
 	}
@@ -30,38 +156,196 @@ func ExtractAll(reader io.Reader, targetDir string, dirPerms os.FileMode) error
 	return nil
 }
 
-// ExtractEntry extracts a single tar entry to the target directory.
-// It validates that the extraction path does not escape the target directory (path traversal protection).
-func ExtractEntry(header *tar.Header, tr *tar.Reader, targetDir string, dirPerms os.FileMode) error {
-	// Check for absolute paths in tar entry name (path traversal attempt)
-	if filepath.IsAbs(header.Name) {
-		return fmt.Errorf("illegal file path in tar: %s", header.Name)
-	}
-
-	// Resolve target path
-	//nolint:gosec // Path traversal is checked above and below
-	target := filepath.Join(targetDir, header.Name)
-
-	// Ensure we don't extract outside the target directory (path traversal protection)
-	cleanTarget := filepath.Clean(target)
-	cleanTargetDir := filepath.Clean(targetDir)
-	if !strings.HasPrefix(cleanTarget, cleanTargetDir+string(os.PathSeparator)) &&
-		cleanTarget != cleanTargetDir {
-		return fmt.Errorf("illegal file path in tar: %s", header.Name)
+// Extract extracts a single tar entry.
+// Directories, regular files, symlinks and hardlinks are supported, other entry types are skipped.
+// Entries must not escape the target directory, neither through their path, through a symlink
+// created by a previous entry, nor through a link target.
+func (e *Extractor) Extract(header *tar.Header, tr *tar.Reader) error {
+	target, err := e.resolve(header)
+	if err != nil {
+		return err
 	}
 
 	switch header.Typeflag {
 	case tar.TypeDir:
-		return ExtractDirectory(target, dirPerms)
+		if err := e.usage.Add(header, 0); err != nil {
+			return err
+		}
+
+		return ExtractDirectory(target, e.dirPerms)
 	case tar.TypeReg:
-		return ExtractFile(target, header, tr, dirPerms)
+		if err := e.usage.Add(header, header.Size); err != nil {
+			return err
+		}
+
+		return ExtractFile(target, header, tr, e.dirPerms)
 	case tar.TypeSymlink:
-		return ExtractSymlink(target, header, dirPerms)
+		if err := e.checkSymlink(header, target); err != nil {
+			return err
+		}
+
+		if err := e.usage.Add(header, 0); err != nil {
+			return err
+		}
+
+		if err := ExtractSymlink(target, header, e.dirPerms); err != nil {
+			return err
+		}
+
+		e.symlinks = append(e.symlinks, target)
+
+		return nil
+	case tar.TypeLink:
+		source, err := e.linkSource(header)
+		if err != nil {
+			return err
+		}
+
+		if err := e.usage.Add(header, 0); err != nil {
+			return err
+		}
+
+		return ExtractHardlink(target, source, e.dirPerms)
 	default:
 		return nil
 	}
 }
 
+// Verify checks that no symlink extracted so far resolves outside the target directory.
+// Symlink targets may be created by later entries, so this completes the checks made
+// while extracting once all entries have been written. Dangling symlinks are allowed.
+func (e *Extractor) Verify() error {
+	root, err := filepath.EvalSymlinks(e.targetDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	for _, link := range e.symlinks {
+		resolved, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+
+		if !within(root, resolved) {
+			name, _ := filepath.Rel(e.targetDir, link)
+
+			return &UnsafeEntryError{Name: name, Reason: "symlink resolves outside the target directory"}
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the path of an entry in the target directory.
+// The entry path must stay in the target directory, and so must its parent directory once
+// the symlinks written by previous entries are resolved.
+func (e *Extractor) resolve(header *tar.Header) (string, error) {
+	// Check for absolute paths in tar entry name (path traversal attempt)
+	if filepath.IsAbs(header.Name) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "absolute path"}
+	}
+
+	//nolint:gosec // Path traversal is checked below
+	target := filepath.Join(e.targetDir, header.Name)
+
+	// Ensure we don't extract outside the target directory (path traversal protection)
+	if !within(e.targetDir, target) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "path escapes the target directory"}
+	}
+
+	parent, err := e.evalExisting(filepath.Dir(target))
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(e.targetDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	if !within(root, parent) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "parent directory is a symlink outside the target directory"}
+	}
+
+	return target, nil
+}
+
+// evalExisting resolves the symlinks of the longest existing prefix of path.
+func (e *Extractor) evalExisting(path string) (string, error) {
+	missing := ""
+
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = filepath.Dir(path)
+	}
+}
+
+// checkSymlink rejects symlinks whose target, resolved from the directory holding the link,
+// is outside the target directory. Absolute targets are always rejected, as they would point
+// to the host filesystem rather than to the extracted content.
+func (e *Extractor) checkSymlink(header *tar.Header, target string) error {
+	if filepath.IsAbs(header.Linkname) {
+		return &UnsafeEntryError{Name: header.Name, Reason: "absolute symlink target " + header.Linkname}
+	}
+
+	if !within(e.targetDir, filepath.Join(filepath.Dir(target), header.Linkname)) {
+		return &UnsafeEntryError{Name: header.Name, Reason: "symlink target " + header.Linkname + " escapes the target directory"}
+	}
+
+	return nil
+}
+
+// linkSource returns the path of the file a hardlink points to, which must be a regular file
+// previously extracted into the target directory.
+func (e *Extractor) linkSource(header *tar.Header) (string, error) {
+	if filepath.IsAbs(header.Linkname) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "absolute hardlink target " + header.Linkname}
+	}
+
+	//nolint:gosec // Path traversal is checked below
+	source := filepath.Join(e.targetDir, header.Linkname)
+	if !within(e.targetDir, source) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "hardlink target " + header.Linkname + " escapes the target directory"}
+	}
+
+	resolved, err := e.evalExisting(source)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(e.targetDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	if !within(root, resolved) {
+		return "", &UnsafeEntryError{Name: header.Name, Reason: "hardlink target " + header.Linkname + " resolves outside the target directory"}
+	}
+
+	info, err := os.Lstat(resolved)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", &CorruptArchiveError{Err: fmt.Errorf("hardlink %s points to %s, which is not a previously extracted file", header.Name, header.Linkname)}
+	}
+
+	return resolved, nil
+}
+
+// within returns true if path is dir or is located in dir.
+func within(dir string, path string) bool {
+	path = filepath.Clean(path)
+
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
 // ExtractDirectory creates a directory with the specified permissions.
 func ExtractDirectory(target string, perms os.FileMode) error {
 	if err := os.MkdirAll(target, perms); err != nil {
@@ -74,12 +358,17 @@ func ExtractDirectory(target string, perms os.FileMode) error {
 // ExtractFile creates a file and writes its contents from the tar reader.
 // The file is created with the mode from the tar header.
 // Parent directories are created with the specified dirPerms if needed.
+// An existing symlink at target is replaced rather than written through.
 func ExtractFile(target string, header *tar.Header, tr *tar.Reader, dirPerms os.FileMode) error {
 	// Create parent directory if needed
 	if err := os.MkdirAll(filepath.Dir(target), dirPerms); err != nil {
 		return fmt.Errorf("failed to create parent directory: %w", err)
 	}
 
+	if err := removeSymlink(target); err != nil {
+		return err
+	}
+
 	// Create file with mode from tar header
 	//nolint:gosec // File path is validated in ExtractEntry
 	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
@@ -90,13 +379,34 @@ func ExtractFile(target string, header *tar.Header, tr *tar.Reader, dirPerms os.
 		_ = f.Close()
 	}()
 
-	if _, err := io.Copy(f, tr); err != nil {
+	// Failing to read the content means the archive is truncated or corrupt, unlike failing to write it
+	r := &recordingReader{reader: tr}
+	if _, err := io.Copy(f, r); err != nil {
+		if r.err != nil {
+			return &CorruptArchiveError{Err: fmt.Errorf("failed to read content of %s: %w", header.Name, r.err)}
+		}
+
 		return fmt.Errorf("failed to write file %s: %w", target, err)
 	}
 
 	return nil
 }
 
+// recordingReader records the read error of the wrapped reader.
+type recordingReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return n, err
+}
+
 // ExtractSymlink creates a symbolic link.
 // Parent directories are created with the specified dirPerms if needed.
 func ExtractSymlink(target string, header *tar.Header, dirPerms os.FileMode) error {
@@ -115,3 +425,35 @@ func ExtractSymlink(target string, header *tar.Header, dirPerms os.FileMode) err
 
 	return nil
 }
+
+// ExtractHardlink creates a hard link to source.
+// Parent directories are created with the specified dirPerms if needed.
+func ExtractHardlink(target string, source string, dirPerms os.FileMode) error {
+	// Create parent directory if needed
+	if err := os.MkdirAll(filepath.Dir(target), dirPerms); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	// Remove existing file/link if present
+	_ = os.Remove(target)
+
+	if err := os.Link(source, target); err != nil {
+		return fmt.Errorf("failed to create hardlink %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// removeSymlink removes target if it is a symlink.
+func removeSymlink(target string) error {
+	info, err := os.Lstat(target)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+
+	if err := os.Remove(target); err != nil {
+		return fmt.Errorf("failed to replace symlink %s: %w", target, err)
+	}
+
+	return nil
+}
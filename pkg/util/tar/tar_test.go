@@ -3,8 +3,10 @@ package tar_test
 import (
 	"archive/tar"
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	tarutil "github.com/lburgazzoli/olm-extractor/pkg/util/tar"
@@ -563,3 +565,179 @@ func TestExtractEntryIntegration(t *testing.T) {
 		g.Expect(linkInfo.Mode() & os.ModeSymlink).To(Equal(os.ModeSymlink))
 	})
 }
+
+// entry is a tar entry, with the content of regular files.
+type entry struct {
+	header  tar.Header
+	content string
+}
+
+// newArchive writes entries to an in-memory tar archive.
+func newArchive(t *testing.T, entries ...entry) *bytes.Buffer {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := e.header
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(e.content))
+		}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+
+		g.Expect(tw.WriteHeader(&h)).To(Succeed())
+
+		_, err := tw.Write([]byte(e.content))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+
+	return &buf
+}
+
+func file(name string, content string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeReg}, content: content}
+}
+
+func symlink(name string, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target}}
+}
+
+func hardlink(name string, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func TestExtractor(t *testing.T) {
+	extract := func(t *testing.T, limits tarutil.Limits, entries ...entry) (string, error) {
+		t.Helper()
+
+		dir := t.TempDir()
+		e := tarutil.NewExtractor(dir, 0750, limits)
+
+		if err := e.ExtractAll(newArchive(t, entries...)); err != nil {
+			return dir, err
+		}
+
+		return dir, e.Verify()
+	}
+
+	t.Run("extracts hardlinks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir, err := extract(t, tarutil.DefaultLimits,
+			file("manifests/csv.yaml", "kind: CSV"),
+			hardlink("manifests/link.yaml", "manifests/csv.yaml"),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "manifests", "link.yaml")))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(Equal("kind: CSV"))
+	})
+
+	t.Run("extracts symlinks within the target directory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir, err := extract(t, tarutil.DefaultLimits,
+			file("data/csv.yaml", "kind: CSV"),
+			symlink("manifests", "data"),
+			file("manifests/crd.yaml", "kind: CRD"),
+		)
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(filepath.Join(dir, "data", "crd.yaml")).To(BeARegularFile())
+	})
+
+	unsafe := []struct {
+		name    string
+		entries []entry
+	}{
+		{
+			name:    "rejects symlinks escaping the target directory",
+			entries: []entry{symlink("manifests/link", "../../outside")},
+		},
+		{
+			name:    "rejects absolute symlinks",
+			entries: []entry{symlink("manifests/link", "/etc/passwd")},
+		},
+		{
+			name:    "rejects hardlinks escaping the target directory",
+			entries: []entry{hardlink("manifests/link", "../outside")},
+		},
+		{
+			name: "rejects symlinks resolving outside through other symlinks",
+			entries: []entry{
+				symlink("a/b/up", "../.."),
+				symlink("a/b/escape", "up/.."),
+			},
+		},
+	}
+
+	for _, tt := range unsafe {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := extract(t, tarutil.DefaultLimits, tt.entries...)
+
+			var unsafeErr *tarutil.UnsafeEntryError
+			g.Expect(errors.As(err, &unsafeErr)).To(BeTrue(), "unexpected error: %v", err)
+		})
+	}
+
+	t.Run("rejects writing through symlinks outside the target directory", func(t *testing.T) {
+		g := NewWithT(t)
+
+		dir := t.TempDir()
+		outside := t.TempDir()
+		g.Expect(os.Symlink(outside, filepath.Join(dir, "manifests"))).To(Succeed())
+
+		err := tarutil.NewExtractor(dir, 0750, tarutil.DefaultLimits).
+			ExtractAll(newArchive(t, file("manifests/csv.yaml", "kind: CSV")))
+
+		var unsafeErr *tarutil.UnsafeEntryError
+		g.Expect(errors.As(err, &unsafeErr)).To(BeTrue(), "unexpected error: %v", err)
+		g.Expect(filepath.Join(outside, "csv.yaml")).ToNot(BeAnExistingFile())
+	})
+
+	limits := []struct {
+		name   string
+		limits tarutil.Limits
+		limit  string
+	}{
+		{name: "enforces the file size limit", limits: tarutil.Limits{MaxFileSize: 4}, limit: "file size"},
+		{name: "enforces the total size limit", limits: tarutil.Limits{MaxTotalSize: 12}, limit: "total size"},
+		{name: "enforces the file count limit", limits: tarutil.Limits{MaxFiles: 1}, limit: "file count"},
+	}
+
+	for _, tt := range limits {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := extract(t, tt.limits,
+				file("manifests/csv.yaml", "kind: CSV"),
+				file("manifests/crd.yaml", "kind: CRD"),
+			)
+
+			var limitErr *tarutil.LimitError
+			g.Expect(errors.As(err, &limitErr)).To(BeTrue(), "unexpected error: %v", err)
+			g.Expect(limitErr.Limit).To(Equal(tt.limit))
+		})
+	}
+
+	t.Run("reports truncated archives as corrupt", func(t *testing.T) {
+		g := NewWithT(t)
+
+		archive := newArchive(t, file("manifests/csv.yaml", strings.Repeat("x", 4096)))
+		truncated := bytes.NewReader(archive.Bytes()[:1024])
+
+		err := tarutil.NewExtractor(t.TempDir(), 0750, tarutil.DefaultLimits).ExtractAll(truncated)
+
+		var corruptErr *tarutil.CorruptArchiveError
+		g.Expect(errors.As(err, &corruptErr)).To(BeTrue(), "unexpected error: %v", err)
+	})
+}